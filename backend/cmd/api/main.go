@@ -8,12 +8,15 @@ import (
 	"github.com/KingscliffHH/app/config"
 
 	// "github.com/KingscliffHH/app/internal/api/healthcheck"
-	"github.com/KingscliffHH/app/internal/api/handlers"
+	"github.com/KingscliffHH/app/internal/api"
 	"github.com/KingscliffHH/app/internal/auth"
+	"github.com/KingscliffHH/app/internal/events"
+	"github.com/KingscliffHH/app/internal/lifecycle"
+	"github.com/KingscliffHH/app/internal/notifications"
 	"github.com/KingscliffHH/app/internal/storage"
+	"github.com/KingscliffHH/app/internal/trash"
+	"github.com/KingscliffHH/app/internal/webhooks"
 	"github.com/KingscliffHH/app/pkg/shutdown"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 )
 
 var Version = "undefined"
@@ -59,101 +62,78 @@ func run(env config.Env) (func(), error) {
 		return nil, err
 	}
 
-	// create the server
-	app := echo.New()
-
-	// middlewares
-	app.Pre(middleware.RemoveTrailingSlash())
-	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-	}))
-	app.Use(middleware.Logger())
-
-	// app.Static("/assets", "assets")
-
-	// // Index redirects to /projects
-	// app.GET("/", func(c echo.Context) error {
-	// 	return c.Redirect(http.StatusFound, "/projects")
-	// })
+	transport, err := notifications.NewTransport(env.Notifications)
+	if err != nil {
+		return nil, err
+	}
 
-	// Users
 	pst := storage.NewPreferenceStorage(mongoStorage.DB)
-	ust, err := storage.NewUserStorage(env.Auth0.Api.Domain, env.Auth0.Api.ClientID, env.Auth0.Api.ClientSecret, env.Auth0.Api.Audience, pst)
-
+	nst := storage.NewNotificationStorage(mongoStorage.DB)
+	users, err := newUserStorage(env, mongoStorage, pst, notifications.PasswordResetNotifier(nst, env.Notifications.AppURL))
 	if err != nil {
 		return nil, err
 	}
 
-	{
-		ph := handlers.NewUserHandler(ust, env.S3Bucket)
-		g := app.Group("/users", authenticator.Middleware())
-		ga := g.Group("", authenticator.HasRoles([]string{"admin"}))
-		ga.POST("", ph.CreateUser)
-		ga.GET("/:id", ph.GetUser)
-		ga.PUT("/:id", ph.UpdateUser)
-		ga.DELETE("/:id", ph.DeleteUser)
-
-		ga.POST("/avatar", ph.UploadAvatar)
-
-		g.GET("", ph.ListUsers)
-		g.GET("/me", ph.GetMe)
+	ust := storage.NewCachedUserStorage(users, env.UserCacheTTL)
+
+	// changes to projects and benchmarks are published once stored, emails
+	// and webhook deliveries are queued on them and sent in the background
+	bus := events.NewBus()
+	prst := storage.NewPublishingProjectStorage(storage.NewProjectStorage(mongoStorage.DB, ust), bus)
+	bst := storage.NewPublishingBenchmarkStorage(storage.NewBenchmarkStorage(mongoStorage.DB), bus)
+
+	notifier := notifications.NewNotifier(nst, ust, env.Notifications.AppURL, env.Notifications.AdminEmails)
+	bus.Subscribe(notifier.Handle)
+
+	wst := storage.NewWebhookStorage(mongoStorage.DB)
+	bus.Subscribe(webhooks.NewDispatcher(wst).Handle)
+
+	stores := api.Storages{
+		Users:          ust,
+		Projects:       prst,
+		Benchmarks:     bst,
+		Preferences:    pst,
+		MetricsHistory: storage.NewMetricsHistoryStorage(mongoStorage.DB),
+		Milestones:     storage.NewMilestoneStorage(mongoStorage.DB),
+		Audit:          storage.NewAuditStorage(mongoStorage.DB),
+		Notifications:  nst,
+		Webhooks:       wst,
 	}
 
-	// Projects
-	{
-		st := storage.NewProjectStorage(mongoStorage.DB, ust)
-		ph := handlers.NewProjectHandler(st)
-		g := app.Group("/projects", authenticator.Middleware())
+	// the API issues its own tokens with the local identity provider
+	if authenticator.Issuer() != nil {
+		credentials, ok := users.(storage.CredentialStorage)
+		if !ok {
+			return nil, fmt.Errorf("user storage of %s identity provider can't authenticate users", env.IdentityProvider)
+		}
 
-		g.GET("", ph.ListProjects)
-		g.POST("", ph.CreateProject, authenticator.HasRoles([]string{"admin"}))
-		g.GET("/:id", ph.GetProject)
-		g.PUT("/:id", ph.UpdateProject, authenticator.HasRoles([]string{"admin"}))
-		g.DELETE("/:id", ph.DeleteProject, authenticator.HasRoles([]string{"admin"}))
+		rst, err := storage.NewRefreshTokenStorage(mongoStorage.DB, env.JWT.RefreshTokenTTL)
+		if err != nil {
+			return nil, err
+		}
 
-		g.PUT("/:id/metrics", ph.UpdateMetrics, authenticator.HasRoles([]string{"admin", "member"}))
-		g.PATCH("/:id/completed", ph.MarkCompleted, authenticator.HasRoles([]string{"admin", "member"}))
+		stores.Credentials = credentials
+		stores.RefreshTokens = rst
 	}
 
-	// Benchmarks
-	{
-		st := storage.NewBenchmarkStorage(mongoStorage.DB)
-		ph := handlers.NewBenchmarkHandler(st)
-		g := app.Group("/benchmarks", authenticator.Middleware())
-		ga := g.Group("", authenticator.HasRoles([]string{"admin"}))
+	// create the server
+	app := api.NewRouter(authenticator, stores, env.S3Bucket)
 
-		ga.POST("", ph.CreateBenchmark)
-		ga.GET("/:id", ph.GetBenchmark)
-		ga.PUT("/:id", ph.UpdateBenchmark)
-		ga.DELETE("/:id", ph.DeleteBenchmark)
+	purger := trash.NewPurger(env.TrashRetention, time.Hour, map[string]trash.PurgeFunc{
+		"projects":   prst.PurgeTrashedProjects,
+		"benchmarks": bst.PurgeTrashed,
+		"users":      ust.PurgeTrashed,
+	})
+	purger.Start()
 
-		g.GET("", ph.ListBenchmarks)
-	}
+	worker := lifecycle.NewWorker(prst, ust, env.AccessExpiryWarning, time.Hour, notifier.AccessExpiring)
+	worker.Start()
 
-	// Preferences
-	{
-		st := storage.NewPreferenceStorage(mongoStorage.DB)
-		ph := handlers.NewPreferenceHandler(st)
-		g := app.Group("/preferences")
+	sender := notifications.NewSender(nst, transport, time.Minute)
+	sender.Start()
 
-		g.GET("/organisations", ph.GetOrganisations)
-	}
-	// PreferenceStorage
-	// Errors
-	// app.HTTPErrorHandler = func(err error, c echo.Context) {
-	// 	code := http.StatusInternalServerError
-	// 	msg := ""
-	// 	if he, ok := err.(*echo.HTTPError); ok {
-	// 		code = he.Code
-	// 		msg = he.Message.(string)
-	// 	}
-	// 	if code == http.StatusNotFound {
-	// 		utils.Render(c, code, errors.NotFound(msg))
-	// 		return
-	// 	}
-	// 	utils.Render(c, code, errors.InternalServerError())
-	// }
+	deliverer := webhooks.NewSender(wst, nil, 10*time.Second)
+	deliverer.Start()
 
 	// start the server
 	go func() {
@@ -165,5 +145,31 @@ func run(env config.Env) (func(), error) {
 
 	return func() {
 		app.Close()
+		ust.Close()
+		purger.Close()
+		worker.Close()
+		sender.Close()
+		deliverer.Close()
 	}, nil
 }
+
+// newUserStorage returns the user storage of the configured identity provider.
+func newUserStorage(env config.Env, mongoStorage *storage.MongoStorage, pst storage.PreferenceStorage, notify storage.PasswordResetNotifier) (storage.UserStorage, error) {
+	if env.IdentityProvider != "local" {
+		return storage.NewUserStorage(env.Auth0.Api.Domain, env.Auth0.Api.ClientID, env.Auth0.Api.ClientSecret, env.Auth0.Api.Audience, pst)
+	}
+
+	users, err := storage.NewLocalUserStorage(mongoStorage.DB, pst, notify)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.LocalAdmin.Email != "" {
+		err = users.EnsureAdmin(env.LocalAdmin.Email, env.LocalAdmin.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
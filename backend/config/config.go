@@ -2,7 +2,11 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +18,40 @@ type Auth0Config struct {
 	Audience     string
 }
 
+// JWTConfig configures the tokens the API issues itself when using the local
+// identity provider.
+type JWTConfig struct {
+	Issuer   string
+	Audience string
+	// SigningKeyFile is a PEM encoded RSA private key. To rotate it, move the
+	// current file to PreviousKeyFiles and set a new one, tokens signed with
+	// previous keys stay valid until they expire.
+	SigningKeyFile   string
+	PreviousKeyFiles []string
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+}
+
+// NotificationsConfig configures the emails sent to users.
+type NotificationsConfig struct {
+	// Transport is how emails are sent, "log", "file", "smtp" or "ses".
+	Transport string
+	From      string
+	// Dir is where the file transport writes emails.
+	Dir  string
+	SMTP struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+	}
+	SESRegion string
+	// AppURL is the address of the frontend, links in emails point to it.
+	AppURL string
+	// AdminEmails are told about the projects that are completed.
+	AdminEmails []string
+}
+
 type Env struct {
 	MONGODB_URI  string
 	MONGODB_NAME string
@@ -21,8 +59,25 @@ type Env struct {
 		App Auth0Config
 		Api Auth0Config
 	}
-	ListenAddr string
-	S3Bucket   string
+	ListenAddr   string
+	S3Bucket     string
+	UserCacheTTL time.Duration
+	// TrashRetention is how long deleted items stay in the trash before
+	// they are purged.
+	TrashRetention time.Duration
+	// AccessExpiryWarning is how long before access to a completed project
+	// ends its lead and client representative are warned.
+	AccessExpiryWarning time.Duration
+	// IdentityProvider selects where users are stored, "auth0" or "local".
+	IdentityProvider string
+	// LocalAdmin is created on startup when using the local identity
+	// provider, if its email is set.
+	LocalAdmin struct {
+		Email    string
+		Password string
+	}
+	JWT           JWTConfig
+	Notifications NotificationsConfig
 }
 
 func LoadConfig() (Env, error) {
@@ -31,7 +86,53 @@ func LoadConfig() (Env, error) {
 
 	godotenv.Load()
 
-	return Env{
+	userCacheTTL := 5 * time.Minute
+	if v := os.Getenv("USER_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return Env{}, fmt.Errorf("invalid USER_CACHE_TTL: %w", err)
+		}
+		// the cache is refreshed every TTL
+		if ttl <= 0 {
+			return Env{}, fmt.Errorf("invalid USER_CACHE_TTL %q, must be positive", v)
+		}
+		userCacheTTL = ttl
+	}
+
+	trashRetention := 30 * 24 * time.Hour
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		retention, err := time.ParseDuration(v)
+		if err != nil {
+			return Env{}, fmt.Errorf("invalid TRASH_RETENTION: %w", err)
+		}
+		// anything else would purge the trash as soon as it is filled
+		if retention <= 0 {
+			return Env{}, fmt.Errorf("invalid TRASH_RETENTION %q, must be positive", v)
+		}
+		trashRetention = retention
+	}
+
+	accessExpiryWarning := 7 * 24 * time.Hour
+	if v := os.Getenv("ACCESS_EXPIRY_WARNING"); v != "" {
+		warning, err := time.ParseDuration(v)
+		if err != nil {
+			return Env{}, fmt.Errorf("invalid ACCESS_EXPIRY_WARNING: %w", err)
+		}
+		if warning <= 0 {
+			return Env{}, fmt.Errorf("invalid ACCESS_EXPIRY_WARNING %q, must be positive", v)
+		}
+		accessExpiryWarning = warning
+	}
+
+	identityProvider := os.Getenv("IDENTITY_PROVIDER")
+	if identityProvider == "" {
+		identityProvider = "auth0"
+	}
+	if identityProvider != "auth0" && identityProvider != "local" {
+		return Env{}, fmt.Errorf("invalid IDENTITY_PROVIDER %q, must be auth0 or local", identityProvider)
+	}
+
+	env := Env{
 		MONGODB_URI:  os.Getenv("MONGODB_URI"),
 		MONGODB_NAME: os.Getenv("MONGODB_NAME"),
 		Auth0: struct {
@@ -50,7 +151,122 @@ func LoadConfig() (Env, error) {
 				Audience:     os.Getenv("AUTH0_API_AUDIENCE"),
 			},
 		},
-		ListenAddr: *listenAddr,
-		S3Bucket:   os.Getenv("S3_BUCKET"),
-	}, nil
+		ListenAddr:          *listenAddr,
+		S3Bucket:            os.Getenv("S3_BUCKET"),
+		UserCacheTTL:        userCacheTTL,
+		TrashRetention:      trashRetention,
+		AccessExpiryWarning: accessExpiryWarning,
+		IdentityProvider:    identityProvider,
+	}
+	jwt, err := loadJWTConfig()
+	if err != nil {
+		return Env{}, err
+	}
+	env.JWT = jwt
+
+	notifications, err := loadNotificationsConfig()
+	if err != nil {
+		return Env{}, err
+	}
+	env.Notifications = notifications
+
+	env.LocalAdmin.Email = os.Getenv("LOCAL_ADMIN_EMAIL")
+	env.LocalAdmin.Password = os.Getenv("LOCAL_ADMIN_PASSWORD")
+	if env.LocalAdmin.Email != "" && env.LocalAdmin.Password == "" {
+		return Env{}, fmt.Errorf("LOCAL_ADMIN_PASSWORD is required with LOCAL_ADMIN_EMAIL")
+	}
+
+	return env, nil
+}
+
+func loadJWTConfig() (JWTConfig, error) {
+	cfg := JWTConfig{
+		Issuer:          os.Getenv("JWT_ISSUER"),
+		Audience:        os.Getenv("JWT_AUDIENCE"),
+		SigningKeyFile:  os.Getenv("JWT_SIGNING_KEY_FILE"),
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 30 * 24 * time.Hour,
+	}
+
+	if cfg.Issuer == "" {
+		cfg.Issuer = "project-dashboard"
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = "project-dashboard"
+	}
+
+	if v := os.Getenv("JWT_PREVIOUS_KEY_FILES"); v != "" {
+		for _, file := range strings.Split(v, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				cfg.PreviousKeyFiles = append(cfg.PreviousKeyFiles, file)
+			}
+		}
+	}
+
+	if v := os.Getenv("JWT_ACCESS_TOKEN_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JWT_ACCESS_TOKEN_TTL: %w", err)
+		}
+		cfg.AccessTokenTTL = ttl
+	}
+
+	if v := os.Getenv("JWT_REFRESH_TOKEN_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JWT_REFRESH_TOKEN_TTL: %w", err)
+		}
+		cfg.RefreshTokenTTL = ttl
+	}
+
+	return cfg, nil
+}
+
+func loadNotificationsConfig() (NotificationsConfig, error) {
+	cfg := NotificationsConfig{
+		Transport: os.Getenv("NOTIFICATIONS_TRANSPORT"),
+		From:      os.Getenv("EMAIL_FROM"),
+		Dir:       os.Getenv("NOTIFICATIONS_DIR"),
+		SESRegion: os.Getenv("SES_REGION"),
+		AppURL:    strings.TrimSuffix(os.Getenv("APP_URL"), "/"),
+	}
+
+	if cfg.Transport == "" {
+		cfg.Transport = "log"
+	}
+	if cfg.Transport != "log" && cfg.Transport != "file" && cfg.Transport != "smtp" && cfg.Transport != "ses" {
+		return cfg, fmt.Errorf("invalid NOTIFICATIONS_TRANSPORT %q, must be log, file, smtp or ses", cfg.Transport)
+	}
+	if cfg.From == "" && (cfg.Transport == "smtp" || cfg.Transport == "ses") {
+		return cfg, fmt.Errorf("EMAIL_FROM is required with the %s transport", cfg.Transport)
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "emails"
+	}
+	if cfg.SESRegion == "" {
+		cfg.SESRegion = "ap-southeast-2"
+	}
+
+	cfg.SMTP.Host = os.Getenv("SMTP_HOST")
+	cfg.SMTP.Username = os.Getenv("SMTP_USERNAME")
+	cfg.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	cfg.SMTP.Port = 587
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+		cfg.SMTP.Port = port
+	}
+	if cfg.SMTP.Host == "" && cfg.Transport == "smtp" {
+		return cfg, fmt.Errorf("SMTP_HOST is required with the smtp transport")
+	}
+
+	for _, email := range strings.Split(os.Getenv("NOTIFICATIONS_ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			cfg.AdminEmails = append(cfg.AdminEmails, email)
+		}
+	}
+
+	return cfg, nil
 }
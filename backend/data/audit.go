@@ -0,0 +1,39 @@
+package data
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditUpdate   AuditAction = "update"
+	AuditDelete   AuditAction = "delete"
+	AuditRestore  AuditAction = "restore"
+	AuditPurge    AuditAction = "purge"
+	AuditComplete AuditAction = "complete"
+)
+
+// Resource types recorded in the audit log.
+const (
+	ResourceProject   = "project"
+	ResourceMetrics   = "metrics"
+	ResourceMilestone = "milestone"
+	ResourceBenchmark = "benchmark"
+	ResourceUser      = "user"
+	ResourceWebhook   = "webhook"
+)
+
+// AuditEntry records a single change made through the API. Entries are never
+// updated or deleted.
+type AuditEntry struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Actor        Member             `json:"actor"`
+	Action       AuditAction        `json:"action"`
+	ResourceType string             `json:"resourceType"`
+	ResourceID   string             `json:"resourceId"`
+	Changes      []Change           `json:"changes,omitempty"`
+	RequestID    string             `json:"requestId,omitempty"`
+	CreatedAt    primitive.DateTime `json:"createdAt"`
+	// ProjectID is the project a milestone belongs to.
+	ProjectID string `json:"projectId,omitempty"`
+}
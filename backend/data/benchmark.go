@@ -15,6 +15,10 @@ type Benchmark struct {
 	TotalConstructionCostPerLaneKm           float64            `json:"totalConstructionCostPerLaneKm" form:"totalConstructionCostPerLaneKm" binding:"required"`
 	CubicMetreRateForEarthworksPerM3         float64            `json:"cubicMetreRateForEarthworksPerM3" form:"cubicMetreRateForEarthworksPerM3" binding:"required"`
 	SquareMetreRateForPavementPerBridgePerM2 float64            `json:"squareMetreRateForPavementPerBridgePerM2" form:"squareMetreRateForPavementPerBridgePerM2" binding:"required"`
+
+	// DeletedAt is set while the benchmark is in the trash.
+	DeletedAt *primitive.DateTime `json:"deletedAt,omitempty"`
+	DeletedBy string              `json:"deletedBy,omitempty"`
 }
 
 func (b *Benchmark) Validate() (*ValidationErrorMap, error) {
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change is a single field that differs between two values. Field is the json
+// path of the value, e.g. "keyRisks[0].score".
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Diff compares two values of the same type field by field and returns every
+// leaf value that changed between them. Either value may be nil.
+func Diff(from, to interface{}) []Change {
+	changes := []Change{}
+	a, b := reflect.ValueOf(from), reflect.ValueOf(to)
+	if !a.IsValid() && !b.IsValid() {
+		return changes
+	}
+
+	diffValue("", a, b, &changes)
+	return changes
+}
+
+func diffValue(path string, a, b reflect.Value, changes *[]Change) {
+	var t reflect.Type
+	if a.IsValid() {
+		t = a.Type()
+	} else {
+		t = b.Type()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if a.IsValid() {
+			a = a.Elem()
+		}
+		if b.IsValid() {
+			b = b.Elem()
+		}
+		if !a.IsValid() && !b.IsValid() {
+			return
+		}
+		diffValue(path, a, b, changes)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			var fa, fb reflect.Value
+			if a.IsValid() {
+				fa = a.Field(i)
+			}
+			if b.IsValid() {
+				fb = b.Field(i)
+			}
+			diffValue(joinPath(path, jsonName(field)), fa, fb, changes)
+		}
+	case reflect.Slice:
+		n := 0
+		if a.IsValid() {
+			n = a.Len()
+		}
+		if b.IsValid() && b.Len() > n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			var ea, eb reflect.Value
+			if a.IsValid() && i < a.Len() {
+				ea = a.Index(i)
+			}
+			if b.IsValid() && i < b.Len() {
+				eb = b.Index(i)
+			}
+			diffValue(fmt.Sprintf("%s[%d]", path, i), ea, eb, changes)
+		}
+	default:
+		var oldValue, newValue interface{}
+		if a.IsValid() {
+			oldValue = a.Interface()
+		}
+		if b.IsValid() {
+			newValue = b.Interface()
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, Change{Field: path, Old: oldValue, New: newValue})
+		}
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MetricsSnapshot is an immutable copy of a project's metrics taken every time
+// they are updated.
+type MetricsSnapshot struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProjectID primitive.ObjectID `json:"projectId"`
+	Version   int                `json:"version"`
+	Author    Member             `json:"author"`
+	Reason    string             `json:"reason"`
+	CreatedAt primitive.DateTime `json:"createdAt"`
+	Metrics   *Metrics           `json:"metrics,omitempty"`
+}
+
+// DiffMetrics compares two metrics field by field and returns every leaf value
+// that changed between them.
+func DiffMetrics(from, to *Metrics) []Change {
+	return Diff(from, to)
+}
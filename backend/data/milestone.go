@@ -0,0 +1,113 @@
+package data
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MilestoneCost is the cost of the project as estimated at a milestone.
+type MilestoneCost struct {
+	BaseValue          float64 `json:"baseValue"`
+	P90OutturnCost     float64 `json:"p90OutturnCost"`
+	P90RiskContingency float64 `json:"p90RiskContingency"`
+	P50OutturnCost     float64 `json:"p50OutturnCost"`
+	P50RiskContingency float64 `json:"p50RiskContingency"`
+}
+
+// Milestone is a stage of a project with its own dates, deliverables and cost
+// snapshot.
+type Milestone struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProjectID     primitive.ObjectID `json:"projectId"`
+	Name          string             `json:"name"`
+	LevelOfDesign string             `json:"levelOfDesign"`
+	PlannedDate   primitive.DateTime `json:"plannedDate"`
+	ForecastDate  primitive.DateTime `json:"forecastDate"`
+	// ActualDate is set once the milestone is reached.
+	ActualDate *primitive.DateTime `json:"actualDate,omitempty"`
+	Progress   int                 `json:"progress"`
+	Packages   []Package           `json:"packages"`
+	Cost       MilestoneCost       `json:"cost"`
+	CreatedAt  primitive.DateTime  `json:"createdAt"`
+	UpdatedAt  primitive.DateTime  `json:"updatedAt"`
+}
+
+func (m *Milestone) Reached() bool {
+	return m.ActualDate != nil
+}
+
+func (m *Milestone) Validate() (*ValidationErrorMap, error) {
+	errors := make(ValidationErrorMap)
+
+	if m.Name == "" {
+		errors["name"] = "name is required"
+	}
+
+	if m.PlannedDate == 0 {
+		errors["plannedDate"] = "planned date is required"
+	}
+
+	if m.Progress < 0 || m.Progress > 100 {
+		errors["progress"] = "progress must be between 0 and 100"
+	}
+
+	for i, pkg := range m.Packages {
+		if pkg.Description == "" {
+			errors[fmt.Sprintf("package-%d", i)] = "description is required"
+		} else if pkg.Progress < 0 || pkg.Progress > 100 {
+			errors[fmt.Sprintf("package-%d", i)] = "progress must be between 0 and 100"
+		}
+	}
+
+	if len(errors) > 0 {
+		return &errors, fmt.Errorf("validation error")
+	}
+
+	return nil, nil
+}
+
+// MilestoneList is the milestones of a project in planned order along with
+// the current one.
+type MilestoneList struct {
+	Items []*Milestone `json:"items"`
+	// CurrentID is the first milestone that hasn't been reached, nil once
+	// they all are.
+	CurrentID *primitive.ObjectID `json:"currentId,omitempty"`
+}
+
+// NewMilestoneList derives the current milestone of milestones sorted by
+// planned date.
+func NewMilestoneList(milestones []*Milestone) *MilestoneList {
+	list := &MilestoneList{Items: milestones}
+	if current := CurrentMilestone(milestones); current != nil {
+		list.CurrentID = &current.ID
+	}
+
+	return list
+}
+
+// CostMilestone returns the milestone of milestones sorted by planned date
+// whose cost is the project's current one: the current milestone, or the last
+// one once they are all reached. It is nil without milestones.
+func CostMilestone(milestones []*Milestone) *Milestone {
+	if current := CurrentMilestone(milestones); current != nil {
+		return current
+	}
+	if len(milestones) > 0 {
+		return milestones[len(milestones)-1]
+	}
+	return nil
+}
+
+// CurrentMilestone returns the first of milestones sorted by planned date that
+// hasn't been reached, or nil.
+func CurrentMilestone(milestones []*Milestone) *Milestone {
+	for _, milestone := range milestones {
+		if !milestone.Reached() {
+			return milestone
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NotificationEvent is something users are emailed about.
+type NotificationEvent string
+
+const (
+	NotifyLeadAssigned     NotificationEvent = "leadAssigned"
+	NotifyMetricsPublished NotificationEvent = "metricsPublished"
+	NotifyProjectCompleted NotificationEvent = "projectCompleted"
+	NotifyAccessExpiring   NotificationEvent = "accessExpiring"
+	NotifyPasswordReset    NotificationEvent = "passwordReset"
+)
+
+var NotificationEvents = []NotificationEvent{
+	NotifyLeadAssigned,
+	NotifyMetricsPublished,
+	NotifyProjectCompleted,
+	NotifyAccessExpiring,
+	NotifyPasswordReset,
+}
+
+// Mandatory reports whether users can't opt out of the event.
+func (e NotificationEvent) Mandatory() bool {
+	return e == NotifyPasswordReset
+}
+
+func (e NotificationEvent) Valid() bool {
+	for _, event := range NotificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationPreferences are the events a user doesn't want to be emailed
+// about.
+type NotificationPreferences struct {
+	UserID string              `json:"userId" bson:"_id"`
+	OptOut []NotificationEvent `json:"optOut"`
+}
+
+func (p *NotificationPreferences) Validate() (*ValidationErrorMap, error) {
+	errors := make(ValidationErrorMap)
+
+	for i, event := range p.OptOut {
+		if !event.Valid() {
+			errors[fmt.Sprintf("optOut-%d", i)] = fmt.Sprintf("unknown event %q", event)
+		} else if event.Mandatory() {
+			errors[fmt.Sprintf("optOut-%d", i)] = fmt.Sprintf("can't opt out of %s emails", event)
+		}
+	}
+
+	if len(errors) > 0 {
+		return &errors, fmt.Errorf("validation error")
+	}
+
+	return nil, nil
+}
+
+// OptedOut reports whether the user doesn't want to be emailed about event.
+func (p *NotificationPreferences) OptedOut(event NotificationEvent) bool {
+	if event.Mandatory() {
+		return false
+	}
+
+	for _, e := range p.OptOut {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type EmailStatus string
+
+const (
+	EmailPending EmailStatus = "pending"
+	EmailSent    EmailStatus = "sent"
+	// EmailFailed is set once an email ran out of attempts.
+	EmailFailed EmailStatus = "failed"
+)
+
+// Email is a message in the outbox, it is kept once sent.
+type Email struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Event   NotificationEvent  `json:"event"`
+	UserID  string             `json:"userId,omitempty"`
+	To      string             `json:"to"`
+	Subject string             `json:"subject"`
+	Body    string             `json:"body"`
+	Status  EmailStatus        `json:"status"`
+	// Attempts counts the failed sends.
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when a pending email is due.
+	NextAttemptAt primitive.DateTime  `json:"nextAttemptAt"`
+	LastError     string              `json:"lastError,omitempty"`
+	CreatedAt     primitive.DateTime  `json:"createdAt"`
+	SentAt        *primitive.DateTime `json:"sentAt,omitempty"`
+}
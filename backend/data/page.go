@@ -0,0 +1,9 @@
+package data
+
+// Page is one page of a cursor paginated list. NextCursor is empty on the last
+// page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
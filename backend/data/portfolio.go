@@ -0,0 +1,45 @@
+package data
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PortfolioSummary aggregates the projects a user can see.
+type PortfolioSummary struct {
+	Projects int              `json:"projects"`
+	ByStatus []PortfolioCount `json:"byStatus"`
+	ByRegion []PortfolioCount `json:"byRegion"`
+	ByClient []PortfolioCount `json:"byClient"`
+	// Commercial is left out for clients.
+	Commercial *PortfolioCommercial `json:"commercial,omitempty"`
+	// P50OutturnCost and P90OutturnCost sum the cost of each project at its
+	// current milestone.
+	P50OutturnCost float64 `json:"p50OutturnCost"`
+	P90OutturnCost float64 `json:"p90OutturnCost"`
+	// Overdue are the projects with a workstream anticipated to complete
+	// after the estimated completion date.
+	Overdue []*OverdueProject `json:"overdue"`
+}
+
+// PortfolioCount is the number of projects with the same value of a field,
+// counts are sorted from the most common value.
+type PortfolioCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+type PortfolioCommercial struct {
+	ContractedValue float64 `json:"contractedValue"`
+	AccrualToDate   float64 `json:"accrualToDate"`
+}
+
+type OverdueProject struct {
+	ID                      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name                    string             `json:"name"`
+	Client                  string             `json:"client"`
+	Region                  string             `json:"region"`
+	EstimatedCompletionDate primitive.DateTime `json:"estimatedCompletionDate"`
+	// AnticipatedCompletionDate is the latest anticipated completion of the
+	// workstreams in scope.
+	AnticipatedCompletionDate primitive.DateTime `json:"anticipatedCompletionDate"`
+}
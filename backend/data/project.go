@@ -3,6 +3,7 @@ package data
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -65,7 +66,36 @@ type TotalProjectCostPerMilestone struct {
 	P90RiskContingency float64            `json:"p90RiskContingency"`
 	P50OutturnCost     float64            `json:"p50OutturnCost"`
 	P50RiskContingency float64            `json:"p50RiskContingency"`
-	CurrentMilstone    bool               `json:"currentMilstone"`
+	// Deprecated: the current milestone is derived from the project's
+	// milestones, see CurrentMilestone.
+	CurrentMilstone bool `json:"currentMilstone"`
+}
+
+// CurrentCostRow returns the index of the cost row of the current milestone,
+// or -1. With milestones it is the row at the level of design of
+// CostMilestone, without it is the row flagged current, or else the latest
+// one, as before projects had milestones.
+func CurrentCostRow(milestones []*Milestone, rows []TotalProjectCostPerMilestone) int {
+	if milestone := CostMilestone(milestones); milestone != nil {
+		for i := range rows {
+			if strings.EqualFold(strings.TrimSpace(rows[i].LevelOfDesign), strings.TrimSpace(milestone.LevelOfDesign)) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	latest := -1
+	for i := range rows {
+		if rows[i].CurrentMilstone {
+			return i
+		}
+		if latest < 0 || rows[i].Date > rows[latest].Date {
+			latest = i
+		}
+	}
+
+	return latest
 }
 
 type KeyCostDriver struct {
@@ -147,6 +177,55 @@ func (m *Metrics) Validate() (*ValidationErrorMap, error) {
 	return nil, nil
 }
 
+// MetricsSection names a part of Metrics that can be hidden from a role.
+type MetricsSection string
+
+const (
+	SectionProgressToDate               MetricsSection = "progressToDate"
+	SectionAnticipatedCompletionDate    MetricsSection = "anticipatedCompletionDate"
+	SectionCommercialInformation        MetricsSection = "commercialInformation"
+	SectionOptionOutturnCosts           MetricsSection = "optionOutturnCosts"
+	SectionTotalProjectCostPerMilestone MetricsSection = "totalProjectCostPerMilestone"
+	SectionKeyCostDrivers               MetricsSection = "keyCostDrivers"
+	SectionKeyRisks                     MetricsSection = "keyRisks"
+	SectionKeyRiskScores                MetricsSection = "keyRiskScores"
+	SectionValueManagementOpportunities MetricsSection = "valueManagementOpportunities"
+	SectionDesignPackages               MetricsSection = "designPackages"
+	SectionPackages                     MetricsSection = "packages"
+	SectionBenchmarking                 MetricsSection = "benchmarking"
+)
+
+var MetricsSections = []MetricsSection{
+	SectionProgressToDate,
+	SectionAnticipatedCompletionDate,
+	SectionCommercialInformation,
+	SectionOptionOutturnCosts,
+	SectionTotalProjectCostPerMilestone,
+	SectionKeyCostDrivers,
+	SectionKeyRisks,
+	SectionKeyRiskScores,
+	SectionValueManagementOpportunities,
+	SectionDesignPackages,
+	SectionPackages,
+	SectionBenchmarking,
+}
+
+func (s MetricsSection) Valid() bool {
+	for _, section := range MetricsSections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	StatusCompleted = "completed"
+	// StatusArchived is set on completed projects once their access period
+	// is over, only admins can still see them.
+	StatusArchived = "archived"
+)
+
 type Project struct {
 	ID                   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name                 string             `json:"name" form:"name" binding:"required"`
@@ -163,8 +242,85 @@ type Project struct {
 	Scope          ScopeOfEngagement  `json:"scope"`
 	StartDate      primitive.DateTime `json:"startDate" form:"startDate"`
 	CompletionDate primitive.DateTime `json:"completionDate" form:"completionDate"`
-	Status         string             `json:"status" form:"status"`
-	Metrics        Metrics            `json:"metrics"`
+	// Status is one of Statuses and only changes through StatusTransitions.
+	Status         string         `json:"status" form:"status"`
+	StatusHistory  []StatusChange `json:"statusHistory,omitempty"`
+	Metrics        Metrics        `json:"metrics"`
+	MetricsVersion int            `json:"metricsVersion"`
+	Revision       int            `json:"revision"`
+	// ClientVisibleSections opts the client representative into seeing
+	// sections that are hidden from clients by default.
+	ClientVisibleSections []MetricsSection `json:"clientVisibleSections"`
+	// DeletedAt is set while the project is in the trash.
+	DeletedAt *primitive.DateTime `json:"deletedAt,omitempty"`
+	DeletedBy string              `json:"deletedBy,omitempty"`
+	// ArchivedAt is when the lifecycle worker archived the project.
+	ArchivedAt *primitive.DateTime `json:"archivedAt,omitempty"`
+	// ExpiryWarnedAt is when the lead and client representative were warned
+	// that access to the project is about to expire.
+	ExpiryWarnedAt *primitive.DateTime `json:"expiryWarnedAt,omitempty"`
+}
+
+// AccessExpiresAt returns when access to a completed or archived project
+// ends, it is zero for projects that aren't completed.
+func (p *Project) AccessExpiresAt() time.Time {
+	if p.Status != StatusCompleted && p.Status != StatusArchived {
+		return time.Time{}
+	}
+
+	return p.CompletionDate.Time().AddDate(0, 0, p.Scope.RemainsAccessibleForNDays)
+}
+
+// AccessExpired reports whether the project is archived, or completed and past
+// its access period but not archived yet.
+func (p *Project) AccessExpired(now time.Time) bool {
+	if p.Status == StatusArchived {
+		return true
+	}
+
+	return p.Status == StatusCompleted && now.After(p.AccessExpiresAt())
+}
+
+// ProjectSummary is the subset of a project shown in project lists.
+type ProjectSummary struct {
+	ID                      primitive.ObjectID `json:"id"`
+	Name                    string             `json:"name"`
+	Client                  string             `json:"client"`
+	Region                  string             `json:"region"`
+	CIProjectNumber         string             `json:"ciProjectNumber"`
+	ClientProjectNumber     string             `json:"clientProjectNumber"`
+	ProjectLead             Member             `json:"projectLead"`
+	StartDate               primitive.DateTime `json:"startDate"`
+	CompletionDate          primitive.DateTime `json:"completionDate"`
+	EstimatedCompletionDate primitive.DateTime `json:"estimatedCompletionDate"`
+	Status                  string             `json:"status"`
+	CurrentLevelOfDesign    string             `json:"currentLevelOfDesign"`
+}
+
+// Summary returns the summary of the project, its milestones sorted by planned
+// date deciding its current level of design like they decide its cost.
+func (p *Project) Summary(milestones []*Milestone) *ProjectSummary {
+	summary := &ProjectSummary{
+		ID:                      p.ID,
+		Name:                    p.Name,
+		Client:                  p.Client,
+		Region:                  p.Region,
+		CIProjectNumber:         p.CIProjectNumber,
+		ClientProjectNumber:     p.ClientProjectNumber,
+		ProjectLead:             p.Team.ProjectLead,
+		StartDate:               p.StartDate,
+		CompletionDate:          p.CompletionDate,
+		EstimatedCompletionDate: p.Scope.EstimatedCompletionDate,
+		Status:                  p.Status,
+	}
+
+	if milestone := CostMilestone(milestones); milestone != nil {
+		summary.CurrentLevelOfDesign = milestone.LevelOfDesign
+	} else if i := CurrentCostRow(nil, p.Metrics.TotalProjectCostPerMilestone); i >= 0 {
+		summary.CurrentLevelOfDesign = p.Metrics.TotalProjectCostPerMilestone[i].LevelOfDesign
+	}
+
+	return summary
 }
 
 func (p *Project) Validate() (*ValidationErrorMap, error) {
@@ -210,6 +366,10 @@ func (p *Project) Validate() (*ValidationErrorMap, error) {
 		errors["startDate"] = "start date is required"
 	}
 
+	if p.Status != "" && !ValidStatus(p.Status) {
+		errors["status"] = "unknown status"
+	}
+
 	fmt.Println("dates", p.StartDate, p.CompletionDate, p.Scope.EstimatedCompletionDate)
 
 	if len(errors) > 0 {
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StatusDraft  = "draft"
+	StatusActive = "active"
+	StatusOnHold = "on-hold"
+)
+
+// Statuses lists the project statuses in lifecycle order.
+var Statuses = []string{StatusDraft, StatusActive, StatusOnHold, StatusCompleted, StatusArchived}
+
+// StatusTransition is a status change a project can go through.
+type StatusTransition struct {
+	From string
+	To   string
+	// Roles are the relations to the project allowed to make the change,
+	// "admin" or "lead".
+	Roles []string
+}
+
+// StatusTransitions lists every allowed status change. Archived projects
+// become completed again by extending their access.
+var StatusTransitions = []StatusTransition{
+	{From: StatusDraft, To: StatusActive, Roles: []string{"admin"}},
+	{From: StatusActive, To: StatusOnHold, Roles: []string{"admin", "lead"}},
+	{From: StatusActive, To: StatusCompleted, Roles: []string{"admin", "lead"}},
+	{From: StatusOnHold, To: StatusActive, Roles: []string{"admin", "lead"}},
+	{From: StatusOnHold, To: StatusCompleted, Roles: []string{"admin", "lead"}},
+	{From: StatusCompleted, To: StatusActive, Roles: []string{"admin"}},
+	{From: StatusCompleted, To: StatusArchived, Roles: []string{"admin"}},
+	{From: StatusArchived, To: StatusActive, Roles: []string{"admin"}},
+}
+
+// metricsEditableStatuses are the statuses in which the metrics of a project
+// can be changed.
+var metricsEditableStatuses = []string{StatusDraft, StatusActive}
+
+// StatusChange records a change of a project's status.
+type StatusChange struct {
+	From      string             `json:"from"`
+	To        string             `json:"to"`
+	ChangedBy Member             `json:"changedBy"`
+	ChangedAt primitive.DateTime `json:"changedAt"`
+	Reason    string             `json:"reason,omitempty"`
+}
+
+// SystemMember is the author of status changes made by the API itself, e.g.
+// archiving expired projects.
+var SystemMember = Member{ID: "system", FullName: "System"}
+
+// NormalizeStatus maps the empty status of projects created before statuses
+// were introduced to active.
+func NormalizeStatus(status string) string {
+	if status == "" {
+		return StatusActive
+	}
+	return status
+}
+
+func ValidStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// FindTransition returns the transition from one status to another, ok is
+// false when the change isn't allowed.
+func FindTransition(from, to string) (transition StatusTransition, ok bool) {
+	from = NormalizeStatus(from)
+	for _, t := range StatusTransitions {
+		if t.From == from && t.To == to {
+			return t, true
+		}
+	}
+	return StatusTransition{}, false
+}
+
+// MetricsEditable reports whether the metrics of a project in the given status
+// can be changed.
+func MetricsEditable(status string) bool {
+	status = NormalizeStatus(status)
+	for _, s := range metricsEditableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
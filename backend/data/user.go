@@ -17,6 +17,8 @@ type User struct {
 	Organisation string `json:"organisation" form:"organisation" binding:"required"`
 	ClientRole   string `json:"clientRole" form:"clientRole" binding:"required"`
 	LastAccess   string `json:"lastAccess" form:"lastAccess" binding:"required"`
+	DeletedAt    string `json:"deletedAt,omitempty"`
+	DeletedBy    string `json:"deletedBy,omitempty"`
 }
 
 func (u *User) Validate() (*ValidationErrorMap, error) {
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEvent is a change webhooks can be told about.
+type WebhookEvent string
+
+const (
+	WebhookProjectCreated   WebhookEvent = "project.created"
+	WebhookProjectUpdated   WebhookEvent = "project.updated"
+	WebhookMetricsUpdated   WebhookEvent = "metrics.updated"
+	WebhookProjectCompleted WebhookEvent = "project.completed"
+	WebhookBenchmarkChanged WebhookEvent = "benchmark.changed"
+	// WebhookPing is sent to test an endpoint, it can't be subscribed to.
+	WebhookPing WebhookEvent = "ping"
+)
+
+// WebhookEvents lists the events webhooks can subscribe to.
+var WebhookEvents = []WebhookEvent{
+	WebhookProjectCreated,
+	WebhookProjectUpdated,
+	WebhookMetricsUpdated,
+	WebhookProjectCompleted,
+	WebhookBenchmarkChanged,
+}
+
+func (e WebhookEvent) Valid() bool {
+	for _, event := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is an endpoint the API posts events to. Deliveries are signed with
+// Secret, which is only returned when the webhook is created.
+type Webhook struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	URL         string             `json:"url"`
+	Description string             `json:"description"`
+	Events      []WebhookEvent     `json:"events"`
+	Active      bool               `json:"active"`
+	Secret      string             `json:"secret,omitempty"`
+	CreatedBy   string             `json:"createdBy"`
+	CreatedAt   primitive.DateTime `json:"createdAt"`
+	UpdatedAt   primitive.DateTime `json:"updatedAt"`
+}
+
+func (w *Webhook) Validate() (*ValidationErrorMap, error) {
+	errors := make(ValidationErrorMap)
+
+	u, err := url.Parse(strings.TrimSpace(w.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errors["url"] = "url must be an absolute http or https url"
+	}
+
+	if len(w.Events) == 0 {
+		errors["events"] = "at least one event is required"
+	}
+	for i, event := range w.Events {
+		if !event.Valid() {
+			errors[fmt.Sprintf("events-%d", i)] = fmt.Sprintf("unknown event %q", event)
+		}
+	}
+
+	if len(errors) > 0 {
+		return &errors, fmt.Errorf("validation error")
+	}
+
+	return nil, nil
+}
+
+// Subscribed reports whether the webhook is told about event.
+func (w *Webhook) Subscribed(event WebhookEvent) bool {
+	if !w.Active {
+		return false
+	}
+
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryFailed is set once a delivery ran out of attempts.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event posted, or to be posted, to a webhook. They are
+// kept as the delivery log of the webhook.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WebhookID primitive.ObjectID `json:"webhookId"`
+	Event     WebhookEvent       `json:"event"`
+	// Payload is the JSON body posted to the webhook.
+	Payload string         `json:"payload"`
+	Status  DeliveryStatus `json:"status"`
+	// Attempts counts the posts made.
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is due.
+	NextAttemptAt primitive.DateTime `json:"nextAttemptAt"`
+	// ResponseStatus and ResponseBody are the response to the last post,
+	// the body is truncated.
+	ResponseStatus int                 `json:"responseStatus,omitempty"`
+	ResponseBody   string              `json:"responseBody,omitempty"`
+	LastError      string              `json:"lastError,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt"`
+	DeliveredAt    *primitive.DateTime `json:"deliveredAt,omitempty"`
+	// ReplayOf is the delivery this one replays.
+	ReplayOf *primitive.ObjectID `json:"replayOf,omitempty"`
+}
@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+// Benchmark metric names, the same as their json fields in Benchmarking.
+const (
+	MetricTotalProjectCostP90                      = "totalProjectCostP90"
+	MetricTotalConstructionCostPerLaneKm           = "totalConstructionCostPerLaneKm"
+	MetricCubicMetreRateForEarthworksPerM3         = "cubicMetreRateForEarthworksPerM3"
+	MetricSquareMetreRateForPavementPerBridgePerM2 = "squareMetreRateForPavementPerBridgePerM2"
+)
+
+// BenchmarkComparison positions a project against the benchmarks it
+// references, on each of its enabled metrics.
+type BenchmarkComparison struct {
+	Benchmarks []*ComparedBenchmark `json:"benchmarks"`
+	Metrics    []*MetricComparison  `json:"metrics"`
+}
+
+type ComparedBenchmark struct {
+	// ID is zero and Name generic once the benchmark is anonymised.
+	ID          primitive.ObjectID `json:"id"`
+	Name        string             `json:"name"`
+	DisplayName bool               `json:"displayName"`
+	// GeographicLocation is only set when the project enables it.
+	GeographicLocation string             `json:"geographicLocation,omitempty"`
+	Values             map[string]float64 `json:"values"`
+}
+
+// MetricComparison is the project's value of a metric against the benchmarks
+// that have one. Benchmarks without a value are left out.
+type MetricComparison struct {
+	Metric     string  `json:"metric"`
+	Value      float64 `json:"value"`
+	Benchmarks int     `json:"benchmarks"`
+	// Percentile is the share of benchmarks below the project's value, ties
+	// counting half.
+	Percentile             float64 `json:"percentile"`
+	Min                    float64 `json:"min"`
+	Max                    float64 `json:"max"`
+	Median                 float64 `json:"median"`
+	DeltaFromMedian        float64 `json:"deltaFromMedian"`
+	DeltaFromMedianPercent float64 `json:"deltaFromMedianPercent"`
+}
+
+// benchmarkMetric is a metric of the project and how to read it from a
+// benchmark.
+type benchmarkMetric struct {
+	name    string
+	enabled bool
+	value   float64
+	of      func(b *data.Benchmark) float64
+}
+
+func benchmarkMetrics(b *data.Benchmarking) []benchmarkMetric {
+	return []benchmarkMetric{
+		{MetricTotalProjectCostP90, b.EnableTotalProjectCost, b.TotalProjectCostP90, func(b *data.Benchmark) float64 { return b.TotalProjectCostP90 }},
+		{MetricTotalConstructionCostPerLaneKm, b.EnableTotalConstructionCost, b.TotalConstructionCostPerLaneKm, func(b *data.Benchmark) float64 { return b.TotalConstructionCostPerLaneKm }},
+		{MetricCubicMetreRateForEarthworksPerM3, b.EnableCubicMetreRateForEarthworks, b.CubicMetreRateForEarthworksPerM3, func(b *data.Benchmark) float64 { return b.CubicMetreRateForEarthworksPerM3 }},
+		{MetricSquareMetreRateForPavementPerBridgePerM2, b.EnableSquareMetreRateForPavement, b.SquareMetreRateForPavementPerBridgePerM2, func(b *data.Benchmark) float64 { return b.SquareMetreRateForPavementPerBridgePerM2 }},
+	}
+}
+
+// CompareBenchmarks compares the project's benchmarking with the benchmarks it
+// references, in the order it references them. References to benchmarks that
+// aren't given, e.g. deleted ones, are skipped.
+func CompareBenchmarks(b *data.Benchmarking, benchmarks []*data.Benchmark) *BenchmarkComparison {
+	byID := map[primitive.ObjectID]*data.Benchmark{}
+	for _, benchmark := range benchmarks {
+		byID[benchmark.ID] = benchmark
+	}
+
+	metrics := []benchmarkMetric{}
+	for _, metric := range benchmarkMetrics(b) {
+		if metric.enabled {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	res := &BenchmarkComparison{Benchmarks: []*ComparedBenchmark{}, Metrics: []*MetricComparison{}}
+	values := map[string][]float64{}
+	for _, ref := range b.Benchmarks {
+		benchmark, ok := byID[ref.BenchmarkID]
+		if !ok {
+			continue
+		}
+
+		compared := &ComparedBenchmark{
+			ID:          benchmark.ID,
+			Name:        benchmark.Name,
+			DisplayName: ref.DisplayProjectName,
+			Values:      map[string]float64{},
+		}
+		if b.EnableGeographicLocation {
+			compared.GeographicLocation = benchmark.GeographicLocation
+		}
+
+		for _, metric := range metrics {
+			if value := metric.of(benchmark); value > 0 {
+				compared.Values[metric.name] = value
+				values[metric.name] = append(values[metric.name], value)
+			}
+		}
+
+		res.Benchmarks = append(res.Benchmarks, compared)
+	}
+
+	for _, metric := range metrics {
+		if len(values[metric.name]) > 0 {
+			res.Metrics = append(res.Metrics, compareMetric(metric.name, metric.value, values[metric.name]))
+		}
+	}
+
+	return res
+}
+
+func compareMetric(name string, value float64, values []float64) *MetricComparison {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	below := 0.0
+	for _, v := range sorted {
+		if v < value {
+			below++
+		} else if v == value {
+			below += 0.5
+		}
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+
+	return &MetricComparison{
+		Metric:                 name,
+		Value:                  value,
+		Benchmarks:             len(sorted),
+		Percentile:             percent(below, float64(len(sorted))),
+		Min:                    sorted[0],
+		Max:                    sorted[len(sorted)-1],
+		Median:                 median,
+		DeltaFromMedian:        value - median,
+		DeltaFromMedianPercent: percent(value-median, median),
+	}
+}
@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+func TestCompareBenchmarks(t *testing.T) {
+	benchmarks := []*data.Benchmark{
+		{ID: primitive.NewObjectID(), Name: "A", GeographicLocation: "NSW", TotalProjectCostP90: 100, CubicMetreRateForEarthworksPerM3: 10},
+		{ID: primitive.NewObjectID(), Name: "B", GeographicLocation: "VIC", TotalProjectCostP90: 200},
+		{ID: primitive.NewObjectID(), Name: "C", GeographicLocation: "QLD", TotalProjectCostP90: 300, CubicMetreRateForEarthworksPerM3: 30},
+		{ID: primitive.NewObjectID(), Name: "D", GeographicLocation: "WA", TotalProjectCostP90: 400},
+	}
+
+	benchmarking := &data.Benchmarking{
+		EnableTotalProjectCost:            true,
+		EnableCubicMetreRateForEarthworks: true,
+		TotalProjectCostP90:               300,
+		CubicMetreRateForEarthworksPerM3:  5,
+		TotalConstructionCostPerLaneKm:    1000,
+		Benchmarks: []data.ProjectBenchmark{
+			{BenchmarkID: benchmarks[3].ID, DisplayProjectName: true},
+			{BenchmarkID: benchmarks[0].ID},
+			{BenchmarkID: benchmarks[2].ID},
+			{BenchmarkID: benchmarks[1].ID},
+			{BenchmarkID: primitive.NewObjectID()},
+		},
+	}
+
+	res := CompareBenchmarks(benchmarking, benchmarks)
+
+	// in the project's order, without the missing benchmark or the location
+	require.Len(t, res.Benchmarks, 4)
+	assert.Equal(t, []string{"D", "A", "C", "B"}, []string{res.Benchmarks[0].Name, res.Benchmarks[1].Name, res.Benchmarks[2].Name, res.Benchmarks[3].Name})
+	assert.True(t, res.Benchmarks[0].DisplayName)
+	assert.Empty(t, res.Benchmarks[0].GeographicLocation)
+	assert.Equal(t, map[string]float64{MetricTotalProjectCostP90: 100, MetricCubicMetreRateForEarthworksPerM3: 10}, res.Benchmarks[1].Values)
+
+	// only enabled metrics, benchmarks without a value are left out
+	assert.Equal(t, []*MetricComparison{
+		{
+			Metric:                 MetricTotalProjectCostP90,
+			Value:                  300,
+			Benchmarks:             4,
+			Percentile:             62.5,
+			Min:                    100,
+			Max:                    400,
+			Median:                 250,
+			DeltaFromMedian:        50,
+			DeltaFromMedianPercent: 20,
+		},
+		{
+			Metric:                 MetricCubicMetreRateForEarthworksPerM3,
+			Value:                  5,
+			Benchmarks:             2,
+			Percentile:             0,
+			Min:                    10,
+			Max:                    30,
+			Median:                 20,
+			DeltaFromMedian:        -15,
+			DeltaFromMedianPercent: -75,
+		},
+	}, res.Metrics)
+
+	benchmarking.EnableGeographicLocation = true
+	assert.Equal(t, "WA", CompareBenchmarks(benchmarking, benchmarks).Benchmarks[0].GeographicLocation)
+}
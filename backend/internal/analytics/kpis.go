@@ -0,0 +1,238 @@
+// Package analytics derives the figures shown alongside a project's metrics,
+// so the UI, exports and API consumers all get the same numbers.
+package analytics
+
+import (
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+// KPIs are grouped by the metrics section they are derived from, a group is
+// nil when there isn't enough data to compute it.
+type KPIs struct {
+	Fee      *FeeKPIs      `json:"fee,omitempty"`
+	Cost     *CostKPIs     `json:"cost,omitempty"`
+	Progress *ProgressKPIs `json:"progress,omitempty"`
+	Schedule *ScheduleKPIs `json:"schedule,omitempty"`
+}
+
+// FeeKPIs are derived from the commercial information.
+type FeeKPIs struct {
+	// TotalFee is the contracted value plus the approved variations.
+	TotalFee      float64 `json:"totalFee"`
+	AccruedToDate float64 `json:"accruedToDate"`
+	RemainingFee  float64 `json:"remainingFee"`
+	SpentPercent  float64 `json:"spentPercent"`
+}
+
+// CostKPIs are derived from the cost of the current milestone.
+type CostKPIs struct {
+	LevelOfDesign         string  `json:"levelOfDesign"`
+	BaseValue             float64 `json:"baseValue"`
+	P50OutturnCost        float64 `json:"p50OutturnCost"`
+	P90OutturnCost        float64 `json:"p90OutturnCost"`
+	P50ContingencyPercent float64 `json:"p50ContingencyPercent"`
+	P90ContingencyPercent float64 `json:"p90ContingencyPercent"`
+	// Spread is the P90 outturn cost less the P50 one.
+	Spread        float64 `json:"spread"`
+	SpreadPercent float64 `json:"spreadPercent"`
+}
+
+// ProgressKPIs are derived from the progress of the workstreams in scope.
+type ProgressKPIs struct {
+	PercentComplete float64        `json:"percentComplete"`
+	Workstreams     map[string]int `json:"workstreams"`
+}
+
+// ScheduleKPIs compare the anticipated completion of each workstream in scope
+// with the estimated completion date of the project. Positive variances are
+// late.
+type ScheduleKPIs struct {
+	EstimatedCompletionDate primitive.DateTime   `json:"estimatedCompletionDate"`
+	VarianceDays            int                  `json:"varianceDays"`
+	Workstreams             []WorkstreamSchedule `json:"workstreams"`
+}
+
+type WorkstreamSchedule struct {
+	Workstream                string             `json:"workstream"`
+	AnticipatedCompletionDate primitive.DateTime `json:"anticipatedCompletionDate"`
+	VarianceDays              int                `json:"varianceDays"`
+}
+
+// Workstream names, the same as their json fields in ProgressToDate.
+const (
+	WorkstreamQuantification              = "quantification"
+	WorkstreamCostEstimation              = "costEstimation"
+	WorkstreamProbabilisticRiskAssessment = "probabilisticRiskAssessment"
+	WorkstreamBasisOfEstimateReport       = "basisOfEstimateReport"
+)
+
+// workstream is a workstream of the scope with its progress and anticipated
+// completion.
+type workstream struct {
+	name        string
+	inScope     bool
+	progress    int
+	anticipated primitive.DateTime
+}
+
+func workstreams(m *data.Metrics, scope *data.ScopeOfEngagement) []workstream {
+	return []workstream{
+		{WorkstreamQuantification, scope.Quantification, m.ProgressToDate.Quantification, m.AnticipatedCompletionDate.Quantification},
+		{WorkstreamCostEstimation, scope.CostEstimation, m.ProgressToDate.CostEstimation, m.AnticipatedCompletionDate.CostEstimation},
+		{WorkstreamProbabilisticRiskAssessment, scope.ProbabilisticRiskAssessment, m.ProgressToDate.ProbabilisticRiskAssessment, m.AnticipatedCompletionDate.ProbabilisticRiskAssessment},
+		{WorkstreamBasisOfEstimateReport, scope.BasisOfEstimateReport, m.ProgressToDate.BasisOfEstimateReport, m.AnticipatedCompletionDate.BasisOfEstimateReport},
+	}
+}
+
+// Compute derives the KPIs of a project from its metrics, scope and milestones
+// sorted by planned date.
+func Compute(m *data.Metrics, scope *data.ScopeOfEngagement, milestones []*data.Milestone) *KPIs {
+	ws := workstreams(m, scope)
+	return &KPIs{
+		Fee:      fee(&m.CommercialInformation),
+		Cost:     cost(CurrentCost(milestones, m.TotalProjectCostPerMilestone)),
+		Progress: progress(ws),
+		Schedule: schedule(ws, scope.EstimatedCompletionDate),
+	}
+}
+
+func fee(info *data.CommercialInformation) *FeeKPIs {
+	total := info.CIContractedValue + info.ApprovedVariationToDate
+	return &FeeKPIs{
+		TotalFee:      total,
+		AccruedToDate: info.CIAccrualToDate,
+		RemainingFee:  total - info.CIAccrualToDate,
+		SpentPercent:  percent(info.CIAccrualToDate, total),
+	}
+}
+
+func cost(row *data.TotalProjectCostPerMilestone) *CostKPIs {
+	if row == nil {
+		return nil
+	}
+
+	spread := row.P90OutturnCost - row.P50OutturnCost
+	return &CostKPIs{
+		LevelOfDesign:         row.LevelOfDesign,
+		BaseValue:             row.BaseValue,
+		P50OutturnCost:        row.P50OutturnCost,
+		P90OutturnCost:        row.P90OutturnCost,
+		P50ContingencyPercent: percent(row.P50RiskContingency, row.BaseValue),
+		P90ContingencyPercent: percent(row.P90RiskContingency, row.BaseValue),
+		Spread:                spread,
+		SpreadPercent:         percent(spread, row.P50OutturnCost),
+	}
+}
+
+// CurrentCost returns the cost of the milestone of a project that is current,
+// see data.CostMilestone. The cost rows of the metrics only decide it for
+// projects without milestones, see data.CurrentCostRow.
+func CurrentCost(milestones []*data.Milestone, rows []data.TotalProjectCostPerMilestone) *data.TotalProjectCostPerMilestone {
+	if milestone := data.CostMilestone(milestones); milestone != nil {
+		return &data.TotalProjectCostPerMilestone{
+			LevelOfDesign:      milestone.LevelOfDesign,
+			Date:               milestone.PlannedDate,
+			BaseValue:          milestone.Cost.BaseValue,
+			P90OutturnCost:     milestone.Cost.P90OutturnCost,
+			P90RiskContingency: milestone.Cost.P90RiskContingency,
+			P50OutturnCost:     milestone.Cost.P50OutturnCost,
+			P50RiskContingency: milestone.Cost.P50RiskContingency,
+		}
+	}
+
+	if i := data.CurrentCostRow(nil, rows); i >= 0 {
+		return &rows[i]
+	}
+	return nil
+}
+
+func progress(workstreams []workstream) *ProgressKPIs {
+	res := &ProgressKPIs{Workstreams: map[string]int{}}
+	total := 0
+	for _, w := range workstreams {
+		if w.inScope {
+			res.Workstreams[w.name] = w.progress
+			total += w.progress
+		}
+	}
+
+	if len(res.Workstreams) == 0 {
+		return nil
+	}
+
+	res.PercentComplete = round(float64(total) / float64(len(res.Workstreams)))
+	return res
+}
+
+func schedule(workstreams []workstream, estimated primitive.DateTime) *ScheduleKPIs {
+	if estimated == 0 {
+		return nil
+	}
+
+	res := &ScheduleKPIs{EstimatedCompletionDate: estimated, Workstreams: []WorkstreamSchedule{}}
+	for _, w := range workstreams {
+		if !w.inScope || w.anticipated == 0 {
+			continue
+		}
+
+		variance := days(w.anticipated.Time().Sub(estimated.Time()))
+		res.Workstreams = append(res.Workstreams, WorkstreamSchedule{
+			Workstream:                w.name,
+			AnticipatedCompletionDate: w.anticipated,
+			VarianceDays:              variance,
+		})
+
+		if len(res.Workstreams) == 1 || variance > res.VarianceDays {
+			res.VarianceDays = variance
+		}
+	}
+
+	if len(res.Workstreams) == 0 {
+		return nil
+	}
+
+	return res
+}
+
+// percent returns part as a percentage of whole, 0 when whole is.
+func percent(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+
+	return round(part / whole * 100)
+}
+
+// round rounds to two decimals.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// days rounds a duration to whole days.
+func days(d time.Duration) int {
+	return int(math.Round(d.Hours() / 24))
+}
+
+// AnticipatedCompletion returns the latest anticipated completion of the
+// workstreams in scope, 0 when none has one.
+func AnticipatedCompletion(m *data.Metrics, scope *data.ScopeOfEngagement) primitive.DateTime {
+	var latest primitive.DateTime
+	for _, w := range workstreams(m, scope) {
+		if w.inScope && w.anticipated > latest {
+			latest = w.anticipated
+		}
+	}
+
+	return latest
+}
+
+// Overdue reports whether a workstream in scope is anticipated to complete
+// after the estimated completion date of the project.
+func Overdue(m *data.Metrics, scope *data.ScopeOfEngagement) bool {
+	return scope.EstimatedCompletionDate > 0 && AnticipatedCompletion(m, scope) > scope.EstimatedCompletionDate
+}
@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+func date(year int, month time.Month, day int) primitive.DateTime {
+	return primitive.NewDateTimeFromTime(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+func TestCompute(t *testing.T) {
+	scope := &data.ScopeOfEngagement{
+		Quantification:          true,
+		CostEstimation:          true,
+		BasisOfEstimateReport:   true,
+		EstimatedCompletionDate: date(2024, 6, 1),
+	}
+
+	metrics := &data.Metrics{}
+	metrics.CommercialInformation = data.CommercialInformation{CIContractedValue: 100000, ApprovedVariationToDate: 20000, CIAccrualToDate: 30000}
+	metrics.ProgressToDate = data.ProgressToDate{Quantification: 100, CostEstimation: 50, ProbabilisticRiskAssessment: 90, BasisOfEstimateReport: 0}
+	metrics.AnticipatedCompletionDate = data.AnticipatedCompletionDate{
+		Quantification:              date(2024, 5, 20),
+		CostEstimation:              date(2024, 6, 15),
+		ProbabilisticRiskAssessment: date(2024, 9, 1),
+	}
+	metrics.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{
+		{LevelOfDesign: "Concept", Date: date(2024, 1, 1), BaseValue: 1000, P50OutturnCost: 1100, P50RiskContingency: 100, P90OutturnCost: 1300, P90RiskContingency: 300},
+		{LevelOfDesign: "Detailed", Date: date(2024, 3, 1), BaseValue: 800, P50OutturnCost: 900, P50RiskContingency: 100, P90OutturnCost: 1000, P90RiskContingency: 200},
+	}
+
+	kpis := Compute(metrics, scope, nil)
+
+	assert.Equal(t, &FeeKPIs{TotalFee: 120000, AccruedToDate: 30000, RemainingFee: 90000, SpentPercent: 25}, kpis.Fee)
+
+	// the latest milestone is used when none is flagged
+	assert.Equal(t, &CostKPIs{
+		LevelOfDesign:         "Detailed",
+		BaseValue:             800,
+		P50OutturnCost:        900,
+		P90OutturnCost:        1000,
+		P50ContingencyPercent: 12.5,
+		P90ContingencyPercent: 25,
+		Spread:                100,
+		SpreadPercent:         11.11,
+	}, kpis.Cost)
+
+	// only the workstreams in scope count
+	assert.Equal(t, 50.0, kpis.Progress.PercentComplete)
+	assert.Equal(t, map[string]int{"quantification": 100, "costEstimation": 50, "basisOfEstimateReport": 0}, kpis.Progress.Workstreams)
+
+	// workstreams without an anticipated date are left out of the schedule
+	assert.Equal(t, 14, kpis.Schedule.VarianceDays)
+	assert.Equal(t, []WorkstreamSchedule{
+		{Workstream: "quantification", AnticipatedCompletionDate: date(2024, 5, 20), VarianceDays: -12},
+		{Workstream: "costEstimation", AnticipatedCompletionDate: date(2024, 6, 15), VarianceDays: 14},
+	}, kpis.Schedule.Workstreams)
+
+	metrics.TotalProjectCostPerMilestone[0].CurrentMilstone = true
+	assert.Equal(t, "Concept", Compute(metrics, scope, nil).Cost.LevelOfDesign)
+
+	// the milestones decide it over the flag
+	reached := date(2024, 1, 10)
+	milestones := []*data.Milestone{
+		{LevelOfDesign: "Concept", PlannedDate: date(2024, 1, 1), ActualDate: &reached},
+		{LevelOfDesign: "detailed", PlannedDate: date(2024, 3, 1), Cost: data.MilestoneCost{BaseValue: 700, P50OutturnCost: 770, P90OutturnCost: 840}},
+	}
+	cost := Compute(metrics, scope, milestones).Cost
+	assert.Equal(t, "detailed", cost.LevelOfDesign)
+	assert.Equal(t, 700.0, cost.BaseValue)
+	assert.Equal(t, 1, data.CurrentCostRow(milestones, metrics.TotalProjectCostPerMilestone))
+
+	// the last one once they are all reached
+	milestones[1].ActualDate = &reached
+	assert.Equal(t, 840.0, Compute(metrics, scope, milestones).Cost.P90OutturnCost)
+	milestones[1].LevelOfDesign = "Tender"
+	assert.Equal(t, -1, data.CurrentCostRow(milestones, metrics.TotalProjectCostPerMilestone))
+}
+
+func TestComputeWithoutData(t *testing.T) {
+	kpis := Compute(&data.Metrics{}, &data.ScopeOfEngagement{}, nil)
+
+	assert.Equal(t, &FeeKPIs{}, kpis.Fee)
+	assert.Nil(t, kpis.Cost)
+	assert.Nil(t, kpis.Progress)
+	assert.Nil(t, kpis.Schedule)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+type auditHandler struct {
+	storage st.AuditStorage
+}
+
+func NewAuditHandler(storage st.AuditStorage) *auditHandler {
+	return &auditHandler{storage: storage}
+}
+
+// ListEntries returns the audit log, newest first, e.g.
+// ?actor=auth0|123&resourceType=project&resourceId=...&from=2024-01-01&to=2024-02-01
+func (h *auditHandler) ListEntries(c echo.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+
+	filter.ActorID = c.QueryParam("actor")
+	filter.ResourceID = c.QueryParam("resourceId")
+	if resourceType := c.QueryParam("resourceType"); resourceType != "" {
+		filter.ResourceTypes = strings.Split(resourceType, ",")
+	}
+
+	res, err := h.storage.GetEntries(filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ProjectActivity returns the changes made to a project, its metrics and
+// milestones, without the metrics sections the current user may not see. It
+// must be mounted behind ProjectHandler.Authorize.
+func (h *auditHandler) ProjectActivity(c echo.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+
+	filter.ProjectID = c.Param("id")
+	filter.ResourceTypes = []string{data.ResourceProject, data.ResourceMetrics, data.ResourceMilestone}
+
+	res, err := h.storage.GetEntries(filter)
+	if err != nil {
+		return err
+	}
+
+	hidden := hiddenSections(c)
+	for _, entry := range res.Items {
+		entry.Changes = redaction.Changes(entry.Changes, hidden)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// auditFilter reads paging and the time range from the query string.
+func auditFilter(c echo.Context) (st.AuditFilter, error) {
+	filter := st.AuditFilter{
+		Limit:  defaultAuditPageSize,
+		Cursor: c.QueryParam("cursor"),
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return filter, apperror.BadRequest("invalid limit")
+		}
+		filter.Limit = min(n, maxAuditPageSize)
+	}
+
+	var err error
+	if from := c.QueryParam("from"); from != "" {
+		filter.From, err = parseDate(from)
+		if err != nil {
+			return filter, apperror.BadRequest("invalid from date")
+		}
+	}
+
+	if to := c.QueryParam("to"); to != "" {
+		filter.To, err = parseDate(to)
+		if err != nil {
+			return filter, apperror.BadRequest("invalid to date")
+		}
+	}
+
+	return filter, nil
+}
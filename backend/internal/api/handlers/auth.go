@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// authHandler logs users of the local identity provider in and hands out the
+// API's own tokens.
+type authHandler struct {
+	users  st.CredentialStorage
+	tokens st.RefreshTokenStorage
+	issuer *auth.Issuer
+}
+
+func NewAuthHandler(users st.CredentialStorage, tokens st.RefreshTokenStorage, issuer *auth.Issuer) *authHandler {
+	return &authHandler{users: users, tokens: tokens, issuer: issuer}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+func (h *authHandler) Login(c echo.Context) error {
+	payload := &struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil {
+		return apperror.BadRequest("invalid credentials")
+	}
+
+	errors := make(data.ValidationErrorMap)
+	if strings.TrimSpace(payload.Email) == "" {
+		errors["email"] = "email is required"
+	}
+	if payload.Password == "" {
+		errors["password"] = "password is required"
+	}
+	if len(errors) > 0 {
+		return apperror.Validation(errors)
+	}
+
+	user, roles, err := h.users.Authenticate(payload.Email, payload.Password)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := h.tokens.Create(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return h.respond(c, user, roles, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new access token and refresh token.
+func (h *authHandler) Refresh(c echo.Context) error {
+	payload := &struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil || payload.RefreshToken == "" {
+		return st.ErrInvalidRefreshToken
+	}
+
+	userID, refreshToken, err := h.tokens.Rotate(payload.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	// roles are read again so changes apply from the next refresh
+	user, roles, err := h.users.GetWithRoles(userID)
+	if apperror.IsKind(err, apperror.KindNotFound) {
+		h.tokens.Revoke(refreshToken)
+		return st.ErrInvalidRefreshToken
+	} else if err != nil {
+		return err
+	}
+
+	return h.respond(c, user, roles, refreshToken)
+}
+
+func (h *authHandler) Logout(c echo.Context) error {
+	payload := &struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil || payload.RefreshToken == "" {
+		return apperror.BadRequest("refresh token is required")
+	}
+
+	err = h.tokens.Revoke(payload.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RequestPasswordReset always answers 202 so it can't be used to find out
+// which emails have an account.
+func (h *authHandler) RequestPasswordReset(c echo.Context) error {
+	payload := &struct {
+		Email string `json:"email"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil || strings.TrimSpace(payload.Email) == "" {
+		return apperror.Validation(map[string]string{"email": "email is required"})
+	}
+
+	err = h.users.RequestPasswordReset(payload.Email)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *authHandler) ResetPassword(c echo.Context) error {
+	payload := &struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil {
+		return apperror.BadRequest("invalid password reset")
+	}
+
+	if len(payload.Password) < 8 {
+		return apperror.Validation(map[string]string{"password": "password must be at least 8 characters"})
+	}
+
+	err = h.users.ResetPassword(payload.Token, payload.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys access tokens are signed with.
+func (h *authHandler) JWKS(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.issuer.JWKS())
+}
+
+func (h *authHandler) respond(c echo.Context, user *data.User, roles []string, refreshToken string) error {
+	accessToken, expiresAt, err := h.issuer.Issue(user.ID, user.Email, roles)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, &tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+	})
+}
@@ -1,26 +1,39 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/spreadsheet"
 	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
 )
 
 type benchmarkHandler struct {
 	storage st.BenchmarkStorage
+	audit   *audit.Recorder
 }
 
-func NewBenchmarkHandler(storage st.BenchmarkStorage) *benchmarkHandler {
-	return &benchmarkHandler{storage: storage}
+func NewBenchmarkHandler(storage st.BenchmarkStorage, recorder *audit.Recorder) *benchmarkHandler {
+	return &benchmarkHandler{storage: storage, audit: recorder}
 }
 
 func (p *benchmarkHandler) ListBenchmarks(c echo.Context) error {
 	res, err := p.storage.GetAll()
 	if err != nil {
-		return c.String(500, "error getting benchmarks")
+		return err
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -30,26 +43,57 @@ func (p *benchmarkHandler) GetBenchmark(c echo.Context) error {
 	id := c.Param("id")
 	res, err := p.storage.GetById(id)
 	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "benchmark not found"}
+		return err
 	}
 
 	return c.JSON(http.StatusOK, res)
 }
 
+// CompareProject compares the project in the :id param with the benchmarks it
+// references. It must be mounted behind ProjectHandler.Authorize.
+func (p *benchmarkHandler) CompareProject(c echo.Context) error {
+	project, _ := c.Get(projectContextKey).(*data.Project)
+	subject, _ := c.Get(subjectContextKey).(*auth.Subject)
+	if project == nil || subject == nil {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	if utils.Contains(hiddenSections(c), data.SectionBenchmarking) {
+		return apperror.Forbidden("benchmarking is hidden")
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, ref := range project.Metrics.Benchmarking.Benchmarks {
+		ids = append(ids, ref.BenchmarkID)
+	}
+
+	benchmarks, err := p.storage.GetByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	res := analytics.CompareBenchmarks(&project.Metrics.Benchmarking, benchmarks)
+	redaction.BenchmarkComparison(res, auth.ProjectPolicy{}.Relation(subject, project))
+
+	return c.JSON(http.StatusOK, res)
+}
+
 func (p *benchmarkHandler) CreateBenchmark(c echo.Context) error {
 	// uses echo bind to get form values
 	benchmark := &data.Benchmark{}
 	c.Bind(benchmark)
 	errors, err := benchmark.Validate()
 	if err != nil {
-		return c.JSON(400, errors)
+		return apperror.Validation(*errors)
 	}
 
 	res, err := p.storage.Create(benchmark)
 	if err != nil {
-		return c.String(500, "error creating benchmark")
+		return err
 	}
 
+	p.audit.Record(c, data.AuditCreate, data.ResourceBenchmark, res.ID.Hex(), nil, res)
+
 	return c.JSON(http.StatusCreated, res)
 }
 
@@ -59,27 +103,249 @@ func (p *benchmarkHandler) UpdateBenchmark(c echo.Context) error {
 	c.Bind(benchmark)
 	errors, err := benchmark.Validate()
 	if err != nil {
-		return c.JSON(400, errors)
+		return apperror.Validation(*errors)
+	}
+
+	before, err := p.storage.GetById(id)
+	if err != nil {
+		return err
 	}
 
 	res, err := p.storage.Update(id, benchmark)
 	if err != nil {
-		return c.String(500, err.Error())
+		return err
 	}
 
+	p.audit.Record(c, data.AuditUpdate, data.ResourceBenchmark, id, before, res)
+
 	return c.JSON(http.StatusAccepted, res)
 }
 
+// DeleteBenchmark moves the benchmark to the trash, unless a project still
+// uses it.
 func (p *benchmarkHandler) DeleteBenchmark(c echo.Context) error {
-	id := c.Param("id")
-	err := p.storage.Delete(id)
+	subject, err := auth.SubjectFromContext(c)
 	if err != nil {
-		return c.String(500, "error deleting benchmark")
+		return apperror.Unauthorized(err.Error())
 	}
 
+	err = p.storage.Delete(c.Param("id"), subject.ID)
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditDelete, data.ResourceBenchmark, c.Param("id"), nil, nil)
+
 	return c.JSON(http.StatusNoContent, nil)
 }
 
+// Benchmark import modes. Create fails rows whose name is already in the
+// library, upsert updates the benchmark with that name instead.
+const (
+	importModeCreate = "create"
+	importModeUpsert = "upsert"
+)
+
+// Import row actions.
+const (
+	importActionCreate = "create"
+	importActionUpdate = "update"
+	importActionFail   = "fail"
+)
+
+type importRow struct {
+	Row    int                     `json:"row"`
+	Name   string                  `json:"name"`
+	Action string                  `json:"action"`
+	ID     *primitive.ObjectID     `json:"id,omitempty"`
+	Errors data.ValidationErrorMap `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	DryRun  bool        `json:"dryRun"`
+	Mode    string      `json:"mode"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Failed  int         `json:"failed"`
+	Rows    []importRow `json:"rows"`
+}
+
+// ImportBenchmarks imports the benchmarks of the CSV or XLSX file in the
+// "file" form field. Valid rows are written even when others fail, unless
+// dryRun is set, in which case nothing is. The optional "mapping" field is a
+// JSON object mapping column headers to benchmark fields.
+func (p *benchmarkHandler) ImportBenchmarks(c echo.Context) error {
+	mode := strings.ToLower(c.FormValue("mode"))
+	if mode == "" {
+		mode = importModeCreate
+	}
+	if mode != importModeCreate && mode != importModeUpsert {
+		return apperror.BadRequest("mode must be create or upsert")
+	}
+
+	dryRun := false
+	if v := c.FormValue("dryRun"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			return apperror.BadRequest("dryRun must be true or false")
+		}
+	}
+
+	mapping := map[string]string{}
+	if v := c.FormValue("mapping"); v != "" {
+		err := json.Unmarshal([]byte(v), &mapping)
+		if err != nil {
+			return apperror.BadRequest("mapping must be a JSON object of column names to fields")
+		}
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return apperror.BadRequest("file is required")
+	}
+
+	format, err := spreadsheet.FormatOf(header.Filename)
+	if err != nil {
+		return err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	table, err := spreadsheet.Read(file, format)
+	if err != nil {
+		return err
+	}
+
+	rows, err := spreadsheet.ParseBenchmarks(table, mapping)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.storage.GetAll()
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]*data.Benchmark{}
+	for _, benchmark := range existing {
+		byName[benchmarkKey(benchmark.Name)] = benchmark
+	}
+
+	report := &importReport{DryRun: dryRun, Mode: mode, Rows: []importRow{}}
+	// seen holds the rows of the file by name, to fail duplicates.
+	seen := map[string]int{}
+	for _, row := range rows {
+		benchmark := row.Benchmark
+		res := importRow{Row: row.Row, Name: benchmark.Name, Errors: row.Errors}
+		if errors, err := benchmark.Validate(); err != nil {
+			for field, message := range *errors {
+				if _, ok := res.Errors[field]; !ok {
+					res.Errors[field] = message
+				}
+			}
+		}
+
+		key := benchmarkKey(benchmark.Name)
+		if first, ok := seen[key]; ok && key != "" {
+			res.Errors["name"] = "duplicates the name of row " + strconv.Itoa(first)
+		} else {
+			seen[key] = row.Row
+		}
+
+		before := byName[key]
+		if before != nil && mode == importModeCreate {
+			if _, ok := res.Errors["name"]; !ok {
+				res.Errors["name"] = "a benchmark with this name already exists"
+			}
+		}
+
+		if len(res.Errors) > 0 {
+			res.Action = importActionFail
+			report.Failed++
+			report.Rows = append(report.Rows, res)
+			continue
+		}
+
+		res.Errors = nil
+		if before == nil {
+			res.Action = importActionCreate
+			report.Created++
+		} else {
+			res.Action = importActionUpdate
+			res.ID = &before.ID
+			report.Updated++
+		}
+
+		if !dryRun {
+			stored, err := p.importBenchmark(c, before, benchmark)
+			if err != nil {
+				return err
+			}
+			res.ID = &stored.ID
+		}
+
+		report.Rows = append(report.Rows, res)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// importBenchmark creates benchmark, or updates before with it when set, and
+// returns the benchmark as stored.
+func (p *benchmarkHandler) importBenchmark(c echo.Context, before *data.Benchmark, benchmark *data.Benchmark) (*data.Benchmark, error) {
+	if before == nil {
+		res, err := p.storage.Create(benchmark)
+		if err != nil {
+			return nil, err
+		}
+
+		p.audit.Record(c, data.AuditCreate, data.ResourceBenchmark, res.ID.Hex(), nil, res)
+		return res, nil
+	}
+
+	res, err := p.storage.Update(before.ID.Hex(), benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	res.ID = before.ID
+	p.audit.Record(c, data.AuditUpdate, data.ResourceBenchmark, before.ID.Hex(), before, res)
+	return res, nil
+}
+
+// ExportBenchmarks downloads the benchmark library in the format read by
+// ImportBenchmarks, CSV unless the format param is xlsx.
+func (p *benchmarkHandler) ExportBenchmarks(c echo.Context) error {
+	format, err := spreadsheet.ParseFormat(c.QueryParam("format"))
+	if err != nil {
+		return err
+	}
+
+	benchmarks, err := p.storage.GetAll()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = spreadsheet.Write(&buf, format, spreadsheet.BenchmarkSheet(benchmarks))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="benchmarks.`+string(format)+`"`)
+	return c.Blob(http.StatusOK, format.ContentType(), buf.Bytes())
+}
+
+// benchmarkKey is the name benchmarks are matched by on import.
+func benchmarkKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
 // func (p *benchmarkHandler) UpdateBenchmark(c echo.Context) error {
 // 	id := c.Param("id")
 // 	benchmark := &data.Benchmark{}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// statusKinds maps the status of errors raised by echo itself, e.g. an
+// unknown route, to the kind reported to the client.
+var statusKinds = map[int]apperror.Kind{
+	http.StatusBadRequest:           apperror.KindBadRequest,
+	http.StatusUnauthorized:         apperror.KindUnauthorized,
+	http.StatusForbidden:            apperror.KindForbidden,
+	http.StatusNotFound:             apperror.KindNotFound,
+	http.StatusConflict:             apperror.KindConflict,
+	http.StatusPreconditionFailed:   apperror.KindPreconditionFailed,
+	http.StatusPreconditionRequired: apperror.KindPreconditionReq,
+	http.StatusBadGateway:           apperror.KindUpstream,
+}
+
+// HTTPErrorHandler writes every error returned by a handler or middleware as
+// an apperror.Problem. Internal and upstream causes are logged, never sent.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr, status := toAppError(err)
+	if status >= 500 {
+		fmt.Println("error handling", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, appErr.Problem(requestID))
+	}
+	if err != nil {
+		fmt.Println("error writing error response", err)
+	}
+}
+
+func toAppError(err error) (*apperror.Error, int) {
+	if he, ok := err.(*echo.HTTPError); ok {
+		kind, ok := statusKinds[he.Code]
+		if !ok {
+			kind = apperror.KindInternal
+		}
+
+		message := http.StatusText(he.Code)
+		if m, ok := he.Message.(string); ok && he.Code < 500 {
+			message = m
+		}
+
+		return &apperror.Error{Kind: kind, Message: message, Err: he.Internal}, he.Code
+	}
+
+	appErr := apperror.As(err)
+	return appErr, appErr.Status()
+}
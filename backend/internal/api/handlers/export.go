@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/spreadsheet"
+)
+
+// ExportProject downloads the metrics of the project in the :id param as a
+// workbook, with the same sections hidden as from its JSON. It must be mounted
+// behind Authorize.
+func (p *ProjectHandler) ExportProject(c echo.Context) error {
+	project, _ := c.Get(projectContextKey).(*data.Project)
+	subject, _ := c.Get(subjectContextKey).(*auth.Subject)
+	if project == nil || subject == nil {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	milestones, err := projectMilestones(p.milestones, project)
+	if err != nil {
+		return err
+	}
+
+	hidden := redaction.Project(project, p.policy.Relation(subject, project))
+	return workbook(c, projectFilename(project, "metrics"), spreadsheet.ProjectSheets(project, milestones, hidden, time.Now())...)
+}
+
+// ExportPortfolio downloads the projects the current user can see as a
+// workbook, with the same filters as ListProjects but without paging.
+func (p *ProjectHandler) ExportPortfolio(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	filter, ok := p.policy.ListFilter(subject)
+	if !ok {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	opts, err := projectListOptions(c)
+	if err != nil {
+		return err
+	}
+
+	if opts.Status == data.StatusArchived && !subject.HasRole("admin") {
+		return apperror.Forbidden("only admins can list archived projects")
+	}
+
+	opts.Limit = maxProjectPageSize
+	opts.Cursor = ""
+	projects := []*data.ProjectSummary{}
+	for {
+		page, err := p.storage.ListProjects(filter, opts)
+		if err != nil {
+			return err
+		}
+
+		projects = append(projects, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	return workbook(c, "portfolio", spreadsheet.PortfolioSheet(projects))
+}
+
+// workbook sends sheets as an XLSX attachment.
+func workbook(c echo.Context, filename string, sheets ...spreadsheet.Sheet) error {
+	var buf bytes.Buffer
+	err := spreadsheet.Write(&buf, spreadsheet.XLSX, sheets...)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.xlsx"`, filename))
+	return c.Blob(http.StatusOK, spreadsheet.XLSX.ContentType(), buf.Bytes())
+}
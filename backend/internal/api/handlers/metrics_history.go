@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+type metricsHistoryHandler struct {
+	storage st.MetricsHistoryStorage
+}
+
+func NewMetricsHistoryHandler(storage st.MetricsHistoryStorage) *metricsHistoryHandler {
+	return &metricsHistoryHandler{storage: storage}
+}
+
+func (h *metricsHistoryHandler) ListSnapshots(c echo.Context) error {
+	res, err := h.storage.GetSnapshots(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *metricsHistoryHandler) GetSnapshot(c echo.Context) error {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return apperror.BadRequest("invalid version")
+	}
+
+	res, err := h.storage.GetSnapshot(c.Param("id"), version)
+	if err != nil {
+		return err
+	}
+
+	redaction.Metrics(res.Metrics, hiddenSections(c))
+	return c.JSON(http.StatusOK, res)
+}
+
+// DiffSnapshots compares the metrics of two versions given as the "from" and
+// "to" query params.
+func (h *metricsHistoryHandler) DiffSnapshots(c echo.Context) error {
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return apperror.BadRequest("invalid from version")
+	}
+
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return apperror.BadRequest("invalid to version")
+	}
+
+	fromSnapshot, err := h.storage.GetSnapshot(c.Param("id"), from)
+	if err != nil {
+		return err
+	}
+
+	toSnapshot, err := h.storage.GetSnapshot(c.Param("id"), to)
+	if err != nil {
+		return err
+	}
+
+	// hidden sections are masked on both sides so they never show up as changes
+	hidden := hiddenSections(c)
+	redaction.Metrics(fromSnapshot.Metrics, hidden)
+	redaction.Metrics(toSnapshot.Metrics, hidden)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"changes": data.DiffMetrics(fromSnapshot.Metrics, toSnapshot.Metrics),
+	})
+}
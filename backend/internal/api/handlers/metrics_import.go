@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/spreadsheet"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+type metricsImport struct {
+	Confirmed bool `json:"confirmed"`
+	// Revision is the project revision the changes apply to, to send back
+	// in If-Match when confirming.
+	Revision int           `json:"revision"`
+	Changes  []data.Change `json:"changes"`
+	Metrics  *data.Metrics `json:"metrics"`
+}
+
+// ImportMetrics reads the cost per milestone, cost drivers and risks of the
+// estimating workbook in the "file" form field into the project's metrics.
+// It returns the changes it would make, and only saves them when confirm is
+// set, with the revision of the preview in If-Match.
+func (p *ProjectHandler) ImportMetrics(c echo.Context) error {
+	project, subject, err := p.authorize(c, auth.ActionUpdateMetrics)
+	if err != nil {
+		return err
+	}
+
+	confirm := false
+	if v := c.QueryParam("confirm"); v != "" {
+		confirm, err = strconv.ParseBool(v)
+		if err != nil {
+			return apperror.BadRequest("confirm must be true or false")
+		}
+	}
+
+	revision := project.Revision
+	if confirm {
+		revision, err = ifMatchRevision(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !data.MetricsEditable(project.Status) {
+		return apperror.BadRequest(fmt.Sprintf("can't update the metrics of a project that is %s", project.Status))
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return apperror.BadRequest("file is required")
+	}
+
+	if format, _ := spreadsheet.FormatOf(header.Filename); format != spreadsheet.XLSX {
+		return apperror.BadRequest("the estimating workbook must be an xlsx file")
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sheets, err := spreadsheet.ReadWorkbook(file)
+	if err != nil {
+		return err
+	}
+
+	metrics := project.Metrics
+	errors, err := spreadsheet.ParseMetrics(sheets, &metrics)
+	if err != nil {
+		return err
+	}
+
+	if invalid, err := metrics.Validate(); err != nil {
+		for field, message := range *invalid {
+			errors[field] = message
+		}
+	}
+	if len(errors) > 0 {
+		return apperror.Validation(errors)
+	}
+
+	res := &metricsImport{Revision: revision, Changes: data.DiffMetrics(&project.Metrics, &metrics), Metrics: &metrics}
+	if !confirm {
+		c.Response().Header().Set("ETag", etag(revision))
+		return c.JSON(http.StatusOK, res)
+	}
+
+	reason := c.QueryParam("reason")
+	if reason == "" {
+		reason = "imported from " + header.Filename
+	}
+
+	author := data.Member{ID: subject.ID, Email: subject.Email}
+	res.Metrics, err = p.storage.UpdateMetrics(project.ID.Hex(), &metrics, revision, author, reason)
+	if err == st.ErrRevisionMismatch {
+		return p.preconditionFailed(c, project.ID.Hex())
+	} else if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditUpdate, data.ResourceMetrics, project.ID.Hex(), &project.Metrics, res.Metrics)
+
+	res.Confirmed = true
+	res.Revision = revision + 1
+	c.Response().Header().Set("ETag", etag(res.Revision))
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// milestoneHandler serves the milestones of a project. It must be mounted
+// behind ProjectHandler.Authorize.
+type milestoneHandler struct {
+	storage st.MilestoneStorage
+	audit   *audit.Recorder
+}
+
+func NewMilestoneHandler(storage st.MilestoneStorage, recorder *audit.Recorder) *milestoneHandler {
+	return &milestoneHandler{storage: storage, audit: recorder}
+}
+
+// ListMilestones returns the milestones of the project by planned date, along
+// with the current one.
+func (h *milestoneHandler) ListMilestones(c echo.Context) error {
+	milestones, err := h.storage.GetMilestones(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	hidden := hiddenSections(c)
+	for _, milestone := range milestones {
+		redaction.Milestone(milestone, hidden)
+	}
+
+	return c.JSON(http.StatusOK, data.NewMilestoneList(milestones))
+}
+
+func (h *milestoneHandler) GetMilestone(c echo.Context) error {
+	res, err := h.storage.GetMilestone(c.Param("id"), c.Param("milestoneId"))
+	if err != nil {
+		return err
+	}
+
+	redaction.Milestone(res, hiddenSections(c))
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *milestoneHandler) CreateMilestone(c echo.Context) error {
+	milestone, err := h.bind(c)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.storage.CreateMilestone(c.Param("id"), milestone)
+	if err != nil {
+		return err
+	}
+
+	h.audit.RecordForProject(c, c.Param("id"), data.AuditCreate, data.ResourceMilestone, res.ID.Hex(), nil, res)
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (h *milestoneHandler) UpdateMilestone(c echo.Context) error {
+	milestone, err := h.bind(c)
+	if err != nil {
+		return err
+	}
+
+	before, err := h.storage.GetMilestone(c.Param("id"), c.Param("milestoneId"))
+	if err != nil {
+		return err
+	}
+
+	res, err := h.storage.UpdateMilestone(c.Param("id"), c.Param("milestoneId"), milestone)
+	if err != nil {
+		return err
+	}
+
+	h.audit.RecordForProject(c, c.Param("id"), data.AuditUpdate, data.ResourceMilestone, res.ID.Hex(), before, res)
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *milestoneHandler) DeleteMilestone(c echo.Context) error {
+	err := h.editable(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.storage.DeleteMilestone(c.Param("id"), c.Param("milestoneId"))
+	if err != nil {
+		return err
+	}
+
+	h.audit.RecordForProject(c, c.Param("id"), data.AuditDelete, data.ResourceMilestone, c.Param("milestoneId"), nil, nil)
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// bind reads and validates the milestone in the request body.
+func (h *milestoneHandler) bind(c echo.Context) (*data.Milestone, error) {
+	err := h.editable(c)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone := &data.Milestone{}
+	err = c.Bind(milestone)
+	if err != nil {
+		return nil, apperror.BadRequest("invalid milestone")
+	}
+
+	errors, err := milestone.Validate()
+	if err != nil {
+		return nil, apperror.Validation(*errors)
+	}
+
+	return milestone, nil
+}
+
+// editable checks the milestones can be changed in the project's status, the
+// same as its metrics.
+func (h *milestoneHandler) editable(c echo.Context) error {
+	project, _ := c.Get(projectContextKey).(*data.Project)
+	if project == nil {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	if !data.MetricsEditable(project.Status) {
+		return apperror.BadRequest(fmt.Sprintf("can't update the milestones of a project that is %s", project.Status))
+	}
+
+	return nil
+}
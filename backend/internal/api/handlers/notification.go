@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+type notificationHandler struct {
+	storage st.NotificationStorage
+}
+
+func NewNotificationHandler(storage st.NotificationStorage) *notificationHandler {
+	return &notificationHandler{storage: storage}
+}
+
+// GetPreferences returns the events the current user opted out of.
+func (h *notificationHandler) GetPreferences(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	res, err := h.storage.GetNotificationPreferences(subject.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// UpdatePreferences replaces the events the current user opted out of.
+func (h *notificationHandler) UpdatePreferences(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	prefs := &data.NotificationPreferences{}
+	err = c.Bind(prefs)
+	if err != nil {
+		return apperror.BadRequest("invalid preferences")
+	}
+
+	errors, err := prefs.Validate()
+	if err != nil {
+		return apperror.Validation(*errors)
+	}
+
+	prefs.UserID = subject.ID
+	if prefs.OptOut == nil {
+		prefs.OptOut = []data.NotificationEvent{}
+	}
+
+	res, err := h.storage.UpdateNotificationPreferences(prefs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -20,7 +20,7 @@ func (p *preferenceHander) GetOrganisations(c echo.Context) error {
 	res, err := p.storage.GetOrganisations()
 	if err != nil {
 		fmt.Println(err)
-		return &echo.HTTPError{Code: 404, Message: "organisations not found"}
+		return err
 	}
 
 	return c.JSON(http.StatusOK, res)
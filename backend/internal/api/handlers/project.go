@@ -3,67 +3,268 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
 	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
 	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
-	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// projectResponse is a project as sent to a client, along with the metrics
+// sections that were hidden from them.
+type projectResponse struct {
+	*data.Project
+	KPIs             *analytics.KPIs       `json:"kpis,omitempty"`
+	RedactedSections []data.MetricsSection `json:"redactedSections,omitempty"`
+}
+
+// context keys set by the Authorize middleware
+const (
+	projectContextKey = "project"
+	subjectContextKey = "subject"
 )
 
 type ProjectHandler struct {
-	storage st.ProjectStorage
+	storage    st.ProjectStorage
+	milestones st.MilestoneStorage
+	policy     auth.ProjectPolicy
+	audit      *audit.Recorder
 }
 
-func NewProjectHandler(storage st.ProjectStorage) *ProjectHandler {
-	return &ProjectHandler{storage: storage}
+// NewProjectHandler returns the project handler, milestones may be nil when
+// they aren't stored.
+func NewProjectHandler(storage st.ProjectStorage, milestones st.MilestoneStorage, recorder *audit.Recorder) *ProjectHandler {
+	return &ProjectHandler{storage: storage, milestones: milestones, audit: recorder}
 }
 
-func (p *ProjectHandler) ListProjects(c echo.Context) error {
-	userToken := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
-	roles := userToken.CustomClaims.(*auth.CustomClaims).Roles
-	user_id := userToken.RegisteredClaims.Subject
-
-	filter := bson.M{}
-	if utils.Contains(roles, "admin") {
-		fmt.Println("user is admin")
-	} else if utils.Contains(roles, "member") {
-		filter = bson.M{
-			"$or": bson.A{
-				bson.M{"team.projectlead.id": user_id},
-				bson.M{"team.teammembers.id": user_id},
-			},
+// authorize loads the project in the :id param and checks the current user
+// may perform action on it.
+func (p *ProjectHandler) authorize(c echo.Context, action auth.Action) (*data.Project, *auth.Subject, error) {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return nil, nil, apperror.Unauthorized(err.Error())
+	}
+
+	project, err := p.storage.GetProject(c.Param("id"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !p.policy.Can(subject, action, project) {
+		return nil, nil, apperror.Forbidden("unauthorized")
+	}
+
+	return project, subject, nil
+}
+
+// Authorize is a middleware for routes under /projects/:id that aren't served
+// by ProjectHandler itself.
+func (p *ProjectHandler) Authorize(action auth.Action) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			project, subject, err := p.authorize(c, action)
+			if err != nil {
+				return err
+			}
+
+			c.Set(projectContextKey, project)
+			c.Set(subjectContextKey, subject)
+			return next(c)
 		}
-		fmt.Println("user is member")
-	} else if utils.Contains(roles, "client") {
-		filter = bson.M{"clientrepresentative.id": user_id}
-		fmt.Println("user is client")
-	} else {
-		fmt.Println("user is unknown")
-		return c.String(http.StatusForbidden, "unauthorized")
+	}
+}
+
+// hiddenSections returns the metrics sections the current user may not see,
+// based on the project and subject stored by ProjectHandler.Authorize.
+func hiddenSections(c echo.Context) []data.MetricsSection {
+	project, _ := c.Get(projectContextKey).(*data.Project)
+	subject, _ := c.Get(subjectContextKey).(*auth.Subject)
+	if project == nil || subject == nil {
+		return data.MetricsSections
+	}
+
+	return redaction.HiddenSections(auth.ProjectPolicy{}.Relation(subject, project), project)
+}
+
+func (p *ProjectHandler) ListProjects(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	filter, ok := p.policy.ListFilter(subject)
+	if !ok {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	opts, err := projectListOptions(c)
+	if err != nil {
+		return err
+	}
+
+	if opts.Status == data.StatusArchived && !subject.HasRole("admin") {
+		return apperror.Forbidden("only admins can list archived projects")
+	}
+
+	res, err := p.storage.ListProjects(filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// PortfolioSummary aggregates the projects the current user can see, with the
+// same filters as ListProjects. Clients don't get the commercial totals.
+func (p *ProjectHandler) PortfolioSummary(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	filter, ok := p.policy.ListFilter(subject)
+	if !ok {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	opts, err := projectListOptions(c)
+	if err != nil {
+		return err
 	}
 
-	res, err := p.storage.GetProjects(filter)
-	// res, err := p.storage.GetProjects(bson.M{})
+	if opts.Status == data.StatusArchived && !subject.HasRole("admin") {
+		return apperror.Forbidden("only admins can list archived projects")
+	}
+
+	res, err := p.storage.PortfolioSummary(filter, opts)
 	if err != nil {
-		return c.String(500, "error getting projects")
+		return err
+	}
+
+	if !subject.HasRole("admin") && !subject.HasRole("member") {
+		res.Commercial = nil
 	}
 
 	return c.JSON(http.StatusOK, res)
 }
 
+const (
+	defaultProjectPageSize = 50
+	maxProjectPageSize     = 200
+)
+
+// projectListOptions reads paging, sorting and filtering from the query
+// string, e.g. ?limit=20&sort=startDate&order=desc&status=completed&from=2024-01-01
+func projectListOptions(c echo.Context) (st.ProjectListOptions, error) {
+	opts := st.ProjectListOptions{
+		Limit:  defaultProjectPageSize,
+		Cursor: c.QueryParam("cursor"),
+		Sort:   c.QueryParam("sort"),
+		Desc:   c.QueryParam("order") == "desc",
+		Status: c.QueryParam("status"),
+		Region: c.QueryParam("region"),
+		Client: c.QueryParam("client"),
+		Lead:   c.QueryParam("lead"),
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return opts, apperror.BadRequest("invalid limit")
+		}
+		opts.Limit = min(n, maxProjectPageSize)
+	}
+
+	var err error
+	if from := c.QueryParam("from"); from != "" {
+		opts.StartFrom, err = parseDate(from)
+		if err != nil {
+			return opts, apperror.BadRequest("invalid from date")
+		}
+	}
+
+	if to := c.QueryParam("to"); to != "" {
+		opts.StartTo, err = parseDate(to)
+		if err != nil {
+			return opts, apperror.BadRequest("invalid to date")
+		}
+	}
+
+	return opts, nil
+}
+
+// parseDate accepts either a plain date or a full RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
 func (p *ProjectHandler) GetProject(c echo.Context) error {
-	id := c.Param("id")
-	res, err := p.storage.GetProject(id)
+	project, subject, err := p.authorize(c, auth.ActionView)
+	if err != nil {
+		return err
+	}
+
+	milestones, err := projectMilestones(p.milestones, project)
+	if err != nil {
+		return err
+	}
+
+	res := &projectResponse{Project: project, KPIs: analytics.Compute(&project.Metrics, &project.Scope, milestones)}
+	res.RedactedSections = redaction.Project(project, p.policy.Relation(subject, project))
+	redaction.KPIs(res.KPIs, res.RedactedSections)
+
+	c.Response().Header().Set("ETag", etag(project.Revision))
+	return c.JSON(http.StatusOK, res)
+}
+
+// UpdateClientVisibility sets which of the sections hidden from clients by
+// default the project's client representative may see.
+func (p *ProjectHandler) UpdateClientVisibility(c echo.Context) error {
+	payload := &struct {
+		Sections []data.MetricsSection `json:"sections"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil {
+		return apperror.BadRequest("invalid sections")
+	}
+
+	errors := make(data.ValidationErrorMap)
+	for i, section := range payload.Sections {
+		if !section.Valid() {
+			errors[fmt.Sprintf("section-%d", i)] = fmt.Sprintf("unknown section %q", section)
+		}
+	}
+	if len(errors) > 0 {
+		return apperror.Validation(errors)
+	}
+
+	before, err := p.storage.GetProject(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	res, err := p.storage.UpdateClientVisibility(c.Param("id"), payload.Sections)
 	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "project not found"}
+		return err
 	}
 
+	p.audit.Record(c, data.AuditUpdate, data.ResourceProject, res.ID.Hex(), before, res)
+
+	c.Response().Header().Set("ETag", etag(res.Revision))
 	return c.JSON(http.StatusOK, res)
 }
 
@@ -73,140 +274,277 @@ func (p *ProjectHandler) CreateProject(c echo.Context) error {
 	c.Bind(project)
 	errors, err := project.Validate()
 	if err != nil {
-		return c.JSON(400, errors)
+		return apperror.Validation(*errors)
 	}
 
 	// project.StartDate = primitive.NewDateTimeFromTime(time.Now())
 
+	// projects start as drafts unless created active, the rest of the
+	// lifecycle goes through UpdateStatus
+	if project.Status == "" {
+		project.Status = data.StatusDraft
+	}
+	if project.Status != data.StatusDraft && project.Status != data.StatusActive {
+		return apperror.Validation(map[string]string{"status": "new projects must be draft or active"})
+	}
+	project.StatusHistory = nil
+
 	res, err := p.storage.CreateProject(project)
 	if err != nil {
-		return c.String(500, "error creating project")
+		return err
 	}
 
+	p.audit.Record(c, data.AuditCreate, data.ResourceProject, res.ID.Hex(), nil, res)
+
 	return c.JSON(http.StatusCreated, res)
 }
 
 func (p *ProjectHandler) UpdateProject(c echo.Context) error {
 	id := c.Param("id")
+	revision, err := ifMatchRevision(c)
+	if err != nil {
+		return err
+	}
+
 	project := &data.Project{}
 	c.Bind(project)
 	errors, err := project.Validate()
 	if err != nil {
-		return c.JSON(400, errors)
+		return apperror.Validation(*errors)
 	}
 
-	res, err := p.storage.UpdateProject(id, project)
+	before, err := p.storage.GetProject(id)
 	if err != nil {
-		return c.String(500, err.Error())
+		return err
 	}
 
+	res, err := p.storage.UpdateProject(id, project, revision)
+	if err == st.ErrRevisionMismatch {
+		return p.preconditionFailed(c, id)
+	} else if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditUpdate, data.ResourceProject, id, before, res)
+
+	c.Response().Header().Set("ETag", etag(res.Revision))
 	return c.JSON(http.StatusAccepted, res)
 }
 
 func (p *ProjectHandler) UpdateMetrics(c echo.Context) error {
-	userToken := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
-	roles := userToken.CustomClaims.(*auth.CustomClaims).Roles
-	user_id := userToken.RegisteredClaims.Subject
-
-	if utils.Contains(roles, "admin") {
-		fmt.Println("user is admin")
-	} else if utils.Contains(roles, "member") {
-		//check if user is project lead
-		fmt.Println("user is member")
-		project, err := p.storage.GetProject(c.Param("id"))
-		if err != nil {
-			return &echo.HTTPError{Code: 404, Message: "project not found"}
-		}
-
-		if project.Team.ProjectLead.ID != user_id {
-			return &echo.HTTPError{Code: 403, Message: "unauthorized"}
-		}
-	} else {
-		fmt.Println("user is unknown")
-		return c.String(http.StatusBadRequest, "unknown user role")
+	project, subject, err := p.authorize(c, auth.ActionUpdateMetrics)
+	if err != nil {
+		return err
 	}
 
 	id := c.Param("id")
-
-	project, err := p.storage.GetProject(id)
+	revision, err := ifMatchRevision(c)
 	if err != nil {
-		return &echo.HTTPError{Code: 400, Message: "project not found"}
+		return err
 	}
 
-	if project.Status == "completed" {
-		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "can't update a completed project"}
+	if !data.MetricsEditable(project.Status) {
+		return apperror.BadRequest(fmt.Sprintf("can't update the metrics of a project that is %s", project.Status))
 	}
 
 	metrics := &data.Metrics{}
 	err = c.Bind(metrics)
 	if err != nil {
-		return &echo.HTTPError{Code: 400, Message: "invalid metrics"}
+		return apperror.BadRequest("invalid metrics")
 	}
 
 	errors, err := metrics.Validate()
 	if err != nil {
-		return c.JSON(400, errors)
+		return apperror.Validation(*errors)
 	}
 
 	fmt.Println("metrics", metrics.TotalProjectCostPerMilestone)
 
-	res, err := p.storage.UpdateMetrics(id, metrics)
-	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "metrics update failed"}
+	author := data.Member{ID: subject.ID, Email: subject.Email}
+	res, err := p.storage.UpdateMetrics(id, metrics, revision, author, c.QueryParam("reason"))
+	if err == st.ErrRevisionMismatch {
+		return p.preconditionFailed(c, id)
+	} else if err != nil {
+		return err
 	}
 
+	p.audit.Record(c, data.AuditUpdate, data.ResourceMetrics, id, &project.Metrics, res)
+
+	c.Response().Header().Set("ETag", etag(revision+1))
 	return c.JSON(http.StatusOK, res)
 }
 
-func (p *ProjectHandler) MarkCompleted(c echo.Context) error {
-	userToken := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
-	roles := userToken.CustomClaims.(*auth.CustomClaims).Roles
-	user_id := userToken.RegisteredClaims.Subject
-
-	if utils.Contains(roles, "admin") {
-		fmt.Println("user is admin")
-	} else if utils.Contains(roles, "member") {
-		//check if user is project lead
-		fmt.Println("user is member")
-		project, err := p.storage.GetProject(c.Param("id"))
-		if err != nil {
-			return &echo.HTTPError{Code: 404, Message: "project not found"}
-		}
+// UpdateStatus moves the project to another status, if data.StatusTransitions
+// allows it and the current user may make the change.
+func (p *ProjectHandler) UpdateStatus(c echo.Context) error {
+	payload := &struct {
+		Status         string             `json:"status"`
+		Reason         string             `json:"reason"`
+		CompletionDate primitive.DateTime `json:"completionDate"`
+	}{}
+	err := c.Bind(payload)
+	if err != nil {
+		return apperror.BadRequest("invalid status")
+	}
 
-		if project.Team.ProjectLead.ID != user_id {
-			return &echo.HTTPError{Code: 403, Message: "unauthorized"}
-		}
-	} else {
-		fmt.Println("user is unknown")
-		return c.String(http.StatusBadRequest, "unknown user role")
+	if !data.ValidStatus(payload.Status) {
+		return apperror.Validation(map[string]string{"status": "unknown status"})
 	}
 
-	id := c.Param("id")
+	return p.changeStatus(c, payload.Status, payload.Reason, payload.CompletionDate)
+}
 
+// MarkCompleted completes the project on the given date.
+func (p *ProjectHandler) MarkCompleted(c echo.Context) error {
 	payload := &struct {
 		CompletionDate primitive.DateTime `json:"completionDate" form:"completionDate"`
 	}{}
 	err := c.Bind(payload)
 	if err != nil {
-		return &echo.HTTPError{Code: 400, Message: "invalid date"}
+		return apperror.BadRequest("invalid date")
 	}
 
 	fmt.Println("mark complete", payload)
 
-	res, err := p.storage.MarkCompleted(id, payload.CompletionDate)
+	return p.changeStatus(c, data.StatusCompleted, "", payload.CompletionDate)
+}
+
+// ReopenProject puts a completed or archived project back in progress.
+func (p *ProjectHandler) ReopenProject(c echo.Context) error {
+	return p.changeStatus(c, data.StatusActive, "reopened", 0)
+}
+
+// changeStatus moves the project in the :id param to the given status on
+// behalf of the current user. completionDate is used when completing the
+// project and defaults to now.
+func (p *ProjectHandler) changeStatus(c echo.Context, to, reason string, completionDate primitive.DateTime) error {
+	project, subject, err := p.authorize(c, auth.ActionView)
+	if err != nil {
+		return err
+	}
+
+	from := data.NormalizeStatus(project.Status)
+	if _, ok := data.FindTransition(from, to); !ok {
+		return apperror.Conflict(fmt.Sprintf("can't change the status of a project from %s to %s", from, to))
+	}
+
+	if !p.policy.CanChangeStatus(subject, project, to) {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	if completionDate == 0 {
+		completionDate = now
+	}
+
+	change := data.StatusChange{
+		From:      from,
+		To:        to,
+		ChangedBy: data.Member{ID: subject.ID, Email: subject.Email},
+		ChangedAt: now,
+		Reason:    reason,
+	}
+	res, err := p.storage.UpdateStatus(c.Param("id"), change, completionDate)
 	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "project not found"}
+		return err
+	}
+
+	action := data.AuditUpdate
+	if to == data.StatusCompleted {
+		action = data.AuditComplete
 	}
+	p.audit.Record(c, action, data.ResourceProject, res.ID.Hex(), project, res)
 
+	c.Response().Header().Set("ETag", etag(res.Revision))
 	return c.JSON(http.StatusOK, res)
 }
 
+// ExtendAccess lengthens the access period of a completed or archived project,
+// archived projects become visible again.
+func (p *ProjectHandler) ExtendAccess(c echo.Context) error {
+	project, subject, err := p.authorize(c, auth.ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	payload := &struct {
+		Days int `json:"days"`
+	}{}
+	err = c.Bind(payload)
+	if err != nil {
+		return apperror.BadRequest("invalid days")
+	}
+
+	if payload.Days < 1 {
+		return apperror.Validation(map[string]string{"days": "days must be at least 1"})
+	}
+
+	if project.Status == data.StatusCompleted || project.Status == data.StatusArchived {
+		extended := *project
+		extended.Scope.RemainsAccessibleForNDays += payload.Days
+		if extended.AccessExpiresAt().Before(time.Now()) {
+			return apperror.Validation(map[string]string{"days": "access would still be expired"})
+		}
+	}
+
+	res, err := p.storage.ExtendAccess(c.Param("id"), payload.Days, data.Member{ID: subject.ID, Email: subject.Email})
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditUpdate, data.ResourceProject, res.ID.Hex(), project, res)
+
+	c.Response().Header().Set("ETag", etag(res.Revision))
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteProject moves the project to the trash. It can be restored until it's
+// purged.
 func (p *ProjectHandler) DeleteProject(c echo.Context) error {
-	id := c.Param("id")
-	err := p.storage.DeleteProject(id)
+	_, subject, err := p.authorize(c, auth.ActionDelete)
 	if err != nil {
-		return c.String(500, "error deleting project")
+		return err
 	}
 
+	err = p.storage.DeleteProject(c.Param("id"), subject.ID)
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditDelete, data.ResourceProject, c.Param("id"), nil, nil)
+
 	return c.JSON(http.StatusNoContent, nil)
 }
+
+// preconditionFailed answers a stale update with the project as it currently
+// is, so the client can merge its changes and retry.
+func (p *ProjectHandler) preconditionFailed(c echo.Context, id string) error {
+	current, err := p.storage.GetProject(id)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", etag(current.Revision))
+	return c.JSON(http.StatusPreconditionFailed, current)
+}
+
+func etag(revision int) string {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// ifMatchRevision reads the project revision the client based its update on
+// from the If-Match header.
+func ifMatchRevision(c echo.Context) (int, error) {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		return 0, apperror.PreconditionRequired("If-Match header is required")
+	}
+
+	value := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	revision, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, apperror.BadRequest("invalid If-Match header")
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/redaction"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/report"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+type reportHandler struct {
+	benchmarks st.BenchmarkStorage
+	milestones st.MilestoneStorage
+}
+
+// NewReportHandler returns the report handler, milestones may be nil when
+// they aren't stored.
+func NewReportHandler(benchmarks st.BenchmarkStorage, milestones st.MilestoneStorage) *reportHandler {
+	return &reportHandler{benchmarks: benchmarks, milestones: milestones}
+}
+
+// ProjectReport renders the PDF report of the project in the :id param, with
+// the same sections hidden as from its JSON. It must be mounted behind
+// ProjectHandler.Authorize.
+func (h *reportHandler) ProjectReport(c echo.Context) error {
+	project, _ := c.Get(projectContextKey).(*data.Project)
+	subject, _ := c.Get(subjectContextKey).(*auth.Subject)
+	if project == nil || subject == nil {
+		return apperror.Forbidden("unauthorized")
+	}
+
+	milestones, err := projectMilestones(h.milestones, project)
+	if err != nil {
+		return err
+	}
+
+	relation := auth.ProjectPolicy{}.Relation(subject, project)
+	kpis := analytics.Compute(&project.Metrics, &project.Scope, milestones)
+	hidden := redaction.Project(project, relation)
+	redaction.KPIs(kpis, hidden)
+
+	r := &report.Report{Project: project, Hidden: hidden, KPIs: kpis, Milestones: milestones, GeneratedAt: time.Now()}
+	if len(project.Metrics.Benchmarking.Benchmarks) > 0 {
+		ids := []primitive.ObjectID{}
+		for _, ref := range project.Metrics.Benchmarking.Benchmarks {
+			ids = append(ids, ref.BenchmarkID)
+		}
+
+		benchmarks, err := h.benchmarks.GetByIDs(ids)
+		if err != nil {
+			return err
+		}
+
+		r.Benchmarks = analytics.CompareBenchmarks(&project.Metrics.Benchmarking, benchmarks)
+		redaction.BenchmarkComparison(r.Benchmarks, relation)
+	}
+
+	var buf bytes.Buffer
+	err = report.Write(&buf, r)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.pdf"`, projectFilename(project, "report")))
+	return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// projectMilestones returns the milestones of the project by planned date,
+// none when milestones aren't stored.
+func projectMilestones(milestones st.MilestoneStorage, project *data.Project) ([]*data.Milestone, error) {
+	if milestones == nil {
+		return nil, nil
+	}
+
+	return milestones.GetMilestones(project.ID.Hex())
+}
+
+// projectFilename names a file about a project after its number, falling
+// back to its id.
+func projectFilename(project *data.Project, suffix string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, project.CIProjectNumber)
+	if name == "" {
+		name = project.ID.Hex()
+	}
+
+	return name + "-" + suffix
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// trashHandler lets admins list, restore and purge deleted projects,
+// benchmarks and users.
+type trashHandler struct {
+	projects   st.ProjectStorage
+	benchmarks st.BenchmarkStorage
+	users      st.UserStorage
+	audit      *audit.Recorder
+}
+
+func NewTrashHandler(projects st.ProjectStorage, benchmarks st.BenchmarkStorage, users st.UserStorage, recorder *audit.Recorder) *trashHandler {
+	return &trashHandler{projects: projects, benchmarks: benchmarks, users: users, audit: recorder}
+}
+
+func (t *trashHandler) ListProjects(c echo.Context) error {
+	res, err := t.projects.GetTrashedProjects()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (t *trashHandler) RestoreProject(c echo.Context) error {
+	err := t.projects.RestoreProject(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditRestore, data.ResourceProject, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *trashHandler) PurgeProject(c echo.Context) error {
+	err := t.projects.PurgeProject(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditPurge, data.ResourceProject, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *trashHandler) ListBenchmarks(c echo.Context) error {
+	res, err := t.benchmarks.GetTrashed()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (t *trashHandler) RestoreBenchmark(c echo.Context) error {
+	err := t.benchmarks.Restore(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditRestore, data.ResourceBenchmark, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *trashHandler) PurgeBenchmark(c echo.Context) error {
+	err := t.benchmarks.Purge(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditPurge, data.ResourceBenchmark, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *trashHandler) ListUsers(c echo.Context) error {
+	res, err := t.users.GetTrashed()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (t *trashHandler) RestoreUser(c echo.Context) error {
+	err := t.users.Restore(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditRestore, data.ResourceUser, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (t *trashHandler) PurgeUser(c echo.Context) error {
+	err := t.users.Purge(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	t.audit.Record(c, data.AuditPurge, data.ResourceUser, c.Param("id"), nil, nil)
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -3,43 +3,81 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
-	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/labstack/echo/v4"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
 	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
 )
 
 type userHandler struct {
 	storage  st.UserStorage
 	s3Bucket string
+	audit    *audit.Recorder
 }
 
-func NewUserHandler(storage st.UserStorage, s3Bucket string) *userHandler {
-	return &userHandler{storage: storage, s3Bucket: s3Bucket}
+func NewUserHandler(storage st.UserStorage, s3Bucket string, recorder *audit.Recorder) *userHandler {
+	return &userHandler{storage: storage, s3Bucket: s3Bucket, audit: recorder}
 }
 
+// userPageSize is the number of users in a page of the unfiltered listing.
+const userPageSize = 100
+
+// ListUsers returns a page of the users, the page query param being the
+// NextCursor of the previous one. Without the q, type or organisation params
+// it pages through the whole directory, otherwise through the search results.
+// It must be mounted for admins and members only.
 func (u *userHandler) ListUsers(c echo.Context) error {
+	q := c.QueryParam("q")
+	role := c.QueryParam("type")
+	organisation := c.QueryParam("organisation")
+
+	n := 0
+	if page := c.QueryParam("page"); page != "" {
+		var err error
+		n, err = strconv.Atoi(page)
+		if err != nil || n < 0 {
+			return apperror.BadRequest("invalid page")
+		}
+	}
+
+	if q == "" && role == "" && organisation == "" {
+		users, err := u.storage.GetAll()
+		if err != nil {
+			return err
+		}
+
+		start := min(n*userPageSize, len(users))
+		end := min(start+userPageSize, len(users))
+		res := &data.Page[*data.User]{Items: users[start:end], Total: int64(len(users))}
+		if end < len(users) {
+			res.NextCursor = strconv.Itoa(n + 1)
+		}
 
-	res2, err := u.storage.GetAll()
+		return c.JSON(http.StatusOK, res)
+	}
+
+	res, err := u.storage.Search(q, role, organisation, n)
 	if err != nil {
-		return c.String(500, "error getting users")
+		return err
 	}
 
-	return c.JSON(http.StatusOK, res2)
+	return c.JSON(http.StatusOK, res)
 }
 
 func (u *userHandler) GetUser(c echo.Context) error {
 	id := c.Param("id")
 	res, err := u.storage.GetById(id)
 	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "user not found"}
+		return err
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -52,14 +90,16 @@ func (u *userHandler) CreateUser(c echo.Context) error {
 
 	errors, err := user.Validate()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, errors)
+		return apperror.Validation(*errors)
 	}
 
 	res, err := u.storage.Create(user)
 	if err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+		return err
 	}
 
+	u.audit.Record(c, data.AuditCreate, data.ResourceUser, res.ID, nil, res)
+
 	return c.JSON(http.StatusCreated, res)
 }
 
@@ -104,33 +144,50 @@ func (u *userHandler) UpdateUser(c echo.Context) error {
 	c.Bind(user)
 	errors, err := user.Validate()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, errors)
+		return apperror.Validation(*errors)
+	}
+
+	before, err := u.storage.GetById(id)
+	if err != nil {
+		return err
 	}
 
 	res, err := u.storage.Update(id, user)
 	if err != nil {
-		return c.String(500, err.Error())
+		return err
 	}
 
+	u.audit.Record(c, data.AuditUpdate, data.ResourceUser, id, before, res)
+
 	return c.JSON(http.StatusAccepted, res)
 }
 
+// DeleteUser blocks the user and moves them to the trash.
 func (u *userHandler) DeleteUser(c echo.Context) error {
-	id := c.Param("id")
-	err := u.storage.Delete(id)
+	subject, err := auth.SubjectFromContext(c)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return apperror.Unauthorized(err.Error())
 	}
 
+	err = u.storage.Delete(c.Param("id"), subject.ID)
+	if err != nil {
+		return err
+	}
+
+	u.audit.Record(c, data.AuditDelete, data.ResourceUser, c.Param("id"), nil, nil)
+
 	return c.NoContent(http.StatusNoContent)
 }
 
 func (u *userHandler) GetMe(c echo.Context) error {
-	userToken := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
 
-	res, err := u.storage.GetById(userToken.RegisteredClaims.Subject)
+	res, err := u.storage.GetById(subject.ID)
 	if err != nil {
-		return &echo.HTTPError{Code: 404, Message: "user not found"}
+		return err
 	}
 
 	return c.JSON(http.StatusOK, res)
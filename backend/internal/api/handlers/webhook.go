@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/webhooks"
+)
+
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 200
+)
+
+type webhookHandler struct {
+	storage st.WebhookStorage
+	audit   *audit.Recorder
+}
+
+func NewWebhookHandler(storage st.WebhookStorage, recorder *audit.Recorder) *webhookHandler {
+	return &webhookHandler{storage: storage, audit: recorder}
+}
+
+// webhookPayload is a webhook as sent by admins, webhooks are active unless
+// said otherwise.
+type webhookPayload struct {
+	URL         string              `json:"url"`
+	Description string              `json:"description"`
+	Events      []data.WebhookEvent `json:"events"`
+	Active      *bool               `json:"active"`
+}
+
+func (p *webhookHandler) bind(c echo.Context) (*data.Webhook, error) {
+	payload := &webhookPayload{}
+	err := c.Bind(payload)
+	if err != nil {
+		return nil, apperror.BadRequest("invalid webhook")
+	}
+
+	webhook := &data.Webhook{
+		URL:         strings.TrimSpace(payload.URL),
+		Description: payload.Description,
+		Events:      payload.Events,
+		Active:      payload.Active == nil || *payload.Active,
+	}
+
+	errors, err := webhook.Validate()
+	if err != nil {
+		return nil, apperror.Validation(*errors)
+	}
+
+	return webhook, nil
+}
+
+// withoutSecret returns a copy of the webhook that can be listed or audited.
+func withoutSecret(webhook *data.Webhook) *data.Webhook {
+	res := *webhook
+	res.Secret = ""
+	return &res
+}
+
+func (p *webhookHandler) ListWebhooks(c echo.Context) error {
+	res, err := p.storage.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for i, webhook := range res {
+		res[i] = withoutSecret(webhook)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (p *webhookHandler) GetWebhook(c echo.Context) error {
+	res, err := p.storage.GetWebhook(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, withoutSecret(res))
+}
+
+// CreateWebhook registers a webhook with a new secret, the only response the
+// secret is returned in.
+func (p *webhookHandler) CreateWebhook(c echo.Context) error {
+	subject, err := auth.SubjectFromContext(c)
+	if err != nil {
+		return apperror.Unauthorized(err.Error())
+	}
+
+	webhook, err := p.bind(c)
+	if err != nil {
+		return err
+	}
+
+	webhook.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		return err
+	}
+	webhook.CreatedBy = subject.ID
+
+	res, err := p.storage.CreateWebhook(webhook)
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditCreate, data.ResourceWebhook, res.ID.Hex(), nil, withoutSecret(res))
+
+	return c.JSON(http.StatusCreated, res)
+}
+
+func (p *webhookHandler) UpdateWebhook(c echo.Context) error {
+	id := c.Param("id")
+	webhook, err := p.bind(c)
+	if err != nil {
+		return err
+	}
+
+	before, err := p.storage.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.storage.UpdateWebhook(id, webhook)
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditUpdate, data.ResourceWebhook, id, withoutSecret(before), withoutSecret(res))
+
+	return c.JSON(http.StatusOK, withoutSecret(res))
+}
+
+// DeleteWebhook deletes the webhook along with its delivery log.
+func (p *webhookHandler) DeleteWebhook(c echo.Context) error {
+	err := p.storage.DeleteWebhook(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	p.audit.Record(c, data.AuditDelete, data.ResourceWebhook, c.Param("id"), nil, nil)
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// ListDeliveries returns the delivery log of the webhook, newest first, up to
+// ?limit deliveries.
+func (p *webhookHandler) ListDeliveries(c echo.Context) error {
+	limit := defaultDeliveryPageSize
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return apperror.BadRequest("invalid limit")
+		}
+		limit = min(n, maxDeliveryPageSize)
+	}
+
+	webhook, err := p.storage.GetWebhook(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	res, err := p.storage.GetDeliveries(webhook.ID.Hex(), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// PingWebhook queues a ping to the webhook.
+func (p *webhookHandler) PingWebhook(c echo.Context) error {
+	webhook, err := p.storage.GetWebhook(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	res, err := webhooks.Ping(p.storage, webhook)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, res)
+}
+
+// ReplayDelivery queues the payload of a delivery of the webhook again.
+func (p *webhookHandler) ReplayDelivery(c echo.Context) error {
+	webhook, err := p.storage.GetWebhook(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	delivery, err := p.storage.GetDelivery(c.Param("deliveryId"))
+	if err != nil {
+		return err
+	}
+	if delivery.WebhookID != webhook.ID {
+		return apperror.NotFound("delivery")
+	}
+
+	res, err := webhooks.Replay(p.storage, delivery)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, res)
+}
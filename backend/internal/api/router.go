@@ -0,0 +1,220 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/api/handlers"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/audit"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// Storages are the storages the API is served from. Users, Projects,
+// Benchmarks and Preferences are required. The routes of the others are left
+// out when they are nil, and nothing is audited without Audit.
+type Storages struct {
+	Users          storage.UserStorage
+	Projects       storage.ProjectStorage
+	Benchmarks     storage.BenchmarkStorage
+	Preferences    storage.PreferenceStorage
+	MetricsHistory storage.MetricsHistoryStorage
+	Milestones     storage.MilestoneStorage
+	Audit          storage.AuditStorage
+	Notifications  storage.NotificationStorage
+	Webhooks       storage.WebhookStorage
+
+	// Credentials and RefreshTokens serve the /auth routes when the
+	// authenticator issues its own tokens.
+	Credentials   storage.CredentialStorage
+	RefreshTokens storage.RefreshTokenStorage
+}
+
+// NewRouter returns the API with all its middlewares and routes, ready to be
+// started or served with httptest.
+func NewRouter(authenticator *auth.Authenticator, stores Storages, s3Bucket string) *echo.Echo {
+	app := echo.New()
+
+	// middlewares
+	app.Pre(middleware.RemoveTrailingSlash())
+	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "If-Match"},
+		ExposeHeaders: []string{"ETag", echo.HeaderXRequestID},
+	}))
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Logger())
+
+	var recorder *audit.Recorder
+	if stores.Audit != nil {
+		recorder = audit.NewRecorder(stores.Audit)
+	}
+
+	// Users
+	{
+		ph := handlers.NewUserHandler(stores.Users, s3Bucket, recorder)
+		g := app.Group("/users", authenticator.Middleware())
+		ga := g.Group("", authenticator.HasRoles([]string{"admin"}))
+		ga.POST("", ph.CreateUser)
+		ga.GET("/:id", ph.GetUser)
+		ga.PUT("/:id", ph.UpdateUser)
+		ga.DELETE("/:id", ph.DeleteUser)
+
+		ga.POST("/avatar", ph.UploadAvatar)
+
+		g.GET("", ph.ListUsers, authenticator.HasRoles([]string{"admin", "member"}))
+		g.GET("/me", ph.GetMe)
+
+		if stores.Notifications != nil {
+			nh := handlers.NewNotificationHandler(stores.Notifications)
+			g.GET("/me/notifications", nh.GetPreferences)
+			g.PUT("/me/notifications", nh.UpdatePreferences)
+		}
+	}
+
+	// Auth, only when the API issues its own tokens
+	if issuer := authenticator.Issuer(); issuer != nil && stores.Credentials != nil && stores.RefreshTokens != nil {
+		ah := handlers.NewAuthHandler(stores.Credentials, stores.RefreshTokens, issuer)
+		g := app.Group("/auth")
+
+		g.POST("/login", ah.Login)
+		g.POST("/refresh", ah.Refresh)
+		g.POST("/logout", ah.Logout)
+		g.POST("/password-reset", ah.RequestPasswordReset)
+		g.POST("/password-reset/confirm", ah.ResetPassword)
+
+		app.GET("/.well-known/jwks.json", ah.JWKS)
+	}
+
+	// Projects
+	{
+		ph := handlers.NewProjectHandler(stores.Projects, stores.Milestones, recorder)
+		g := app.Group("/projects", authenticator.Middleware())
+
+		g.GET("", ph.ListProjects)
+		g.GET("/export.xlsx", ph.ExportPortfolio)
+		g.POST("", ph.CreateProject, authenticator.HasRoles([]string{"admin"}))
+		g.GET("/:id", ph.GetProject)
+		g.GET("/:id/export.xlsx", ph.ExportProject, ph.Authorize(auth.ActionView))
+		g.PUT("/:id", ph.UpdateProject, authenticator.HasRoles([]string{"admin"}))
+		g.DELETE("/:id", ph.DeleteProject, authenticator.HasRoles([]string{"admin"}))
+
+		g.PUT("/:id/metrics", ph.UpdateMetrics, authenticator.HasRoles([]string{"admin", "member"}))
+		g.POST("/:id/metrics/import", ph.ImportMetrics, authenticator.HasRoles([]string{"admin", "member"}))
+		g.PATCH("/:id/completed", ph.MarkCompleted, authenticator.HasRoles([]string{"admin", "member"}))
+		g.PATCH("/:id/status", ph.UpdateStatus, authenticator.HasRoles([]string{"admin", "member"}))
+		g.PUT("/:id/visibility", ph.UpdateClientVisibility, authenticator.HasRoles([]string{"admin"}))
+		g.POST("/:id/extend-access", ph.ExtendAccess, authenticator.HasRoles([]string{"admin"}))
+		g.POST("/:id/reopen", ph.ReopenProject, authenticator.HasRoles([]string{"admin"}))
+
+		if stores.MetricsHistory != nil {
+			hh := handlers.NewMetricsHistoryHandler(stores.MetricsHistory)
+			gh := g.Group("/:id/metrics/history", ph.Authorize(auth.ActionView))
+			gh.GET("", hh.ListSnapshots)
+			gh.GET("/diff", hh.DiffSnapshots)
+			gh.GET("/:version", hh.GetSnapshot)
+		}
+
+		if stores.Milestones != nil {
+			mh := handlers.NewMilestoneHandler(stores.Milestones, recorder)
+			gm := g.Group("/:id/milestones")
+			view := ph.Authorize(auth.ActionView)
+			edit := []echo.MiddlewareFunc{authenticator.HasRoles([]string{"admin", "member"}), ph.Authorize(auth.ActionUpdateMetrics)}
+
+			gm.GET("", mh.ListMilestones, view)
+			gm.GET("/:milestoneId", mh.GetMilestone, view)
+			gm.POST("", mh.CreateMilestone, edit...)
+			gm.PUT("/:milestoneId", mh.UpdateMilestone, edit...)
+			gm.DELETE("/:milestoneId", mh.DeleteMilestone, edit...)
+		}
+
+		bh := handlers.NewBenchmarkHandler(stores.Benchmarks, recorder)
+		g.GET("/:id/benchmarks/comparison", bh.CompareProject, ph.Authorize(auth.ActionView))
+
+		rh := handlers.NewReportHandler(stores.Benchmarks, stores.Milestones)
+		g.GET("/:id/report.pdf", rh.ProjectReport, ph.Authorize(auth.ActionView))
+
+		if stores.Audit != nil {
+			ah := handlers.NewAuditHandler(stores.Audit)
+			g.GET("/:id/activity", ah.ProjectActivity, ph.Authorize(auth.ActionView))
+		}
+	}
+
+	// Portfolio
+	{
+		ph := handlers.NewProjectHandler(stores.Projects, stores.Milestones, recorder)
+		g := app.Group("/portfolio", authenticator.Middleware())
+
+		g.GET("/summary", ph.PortfolioSummary)
+	}
+
+	// Benchmarks
+	{
+		ph := handlers.NewBenchmarkHandler(stores.Benchmarks, recorder)
+		g := app.Group("/benchmarks", authenticator.Middleware())
+		ga := g.Group("", authenticator.HasRoles([]string{"admin"}))
+
+		ga.POST("", ph.CreateBenchmark)
+		ga.POST("/import", ph.ImportBenchmarks)
+		ga.GET("/export", ph.ExportBenchmarks)
+		ga.GET("/:id", ph.GetBenchmark)
+		ga.PUT("/:id", ph.UpdateBenchmark)
+		ga.DELETE("/:id", ph.DeleteBenchmark)
+
+		g.GET("", ph.ListBenchmarks)
+	}
+
+	// Audit
+	if stores.Audit != nil {
+		ah := handlers.NewAuditHandler(stores.Audit)
+		g := app.Group("/audit", authenticator.Middleware(), authenticator.HasRoles([]string{"admin"}))
+
+		g.GET("", ah.ListEntries)
+	}
+
+	// Webhooks
+	if stores.Webhooks != nil {
+		wh := handlers.NewWebhookHandler(stores.Webhooks, recorder)
+		g := app.Group("/webhooks", authenticator.Middleware(), authenticator.HasRoles([]string{"admin"}))
+
+		g.GET("", wh.ListWebhooks)
+		g.POST("", wh.CreateWebhook)
+		g.GET("/:id", wh.GetWebhook)
+		g.PUT("/:id", wh.UpdateWebhook)
+		g.DELETE("/:id", wh.DeleteWebhook)
+		g.POST("/:id/ping", wh.PingWebhook)
+		g.GET("/:id/deliveries", wh.ListDeliveries)
+		g.POST("/:id/deliveries/:deliveryId/replay", wh.ReplayDelivery)
+	}
+
+	// Trash
+	{
+		th := handlers.NewTrashHandler(stores.Projects, stores.Benchmarks, stores.Users, recorder)
+		g := app.Group("/trash", authenticator.Middleware(), authenticator.HasRoles([]string{"admin"}))
+
+		g.GET("/projects", th.ListProjects)
+		g.POST("/projects/:id/restore", th.RestoreProject)
+		g.DELETE("/projects/:id", th.PurgeProject)
+
+		g.GET("/benchmarks", th.ListBenchmarks)
+		g.POST("/benchmarks/:id/restore", th.RestoreBenchmark)
+		g.DELETE("/benchmarks/:id", th.PurgeBenchmark)
+
+		g.GET("/users", th.ListUsers)
+		g.POST("/users/:id/restore", th.RestoreUser)
+		g.DELETE("/users/:id", th.PurgeUser)
+	}
+
+	// Preferences
+	{
+		ph := handlers.NewPreferenceHandler(stores.Preferences)
+		g := app.Group("/preferences")
+
+		g.GET("/organisations", ph.GetOrganisations)
+	}
+
+	// Errors
+	app.HTTPErrorHandler = handlers.HTTPErrorHandler
+
+	return app
+}
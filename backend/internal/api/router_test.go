@@ -0,0 +1,1090 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/config"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/spreadsheet"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/webhooks"
+)
+
+// testAPI is the API served from in-memory storages, with tokens signed by a
+// throwaway key.
+type testAPI struct {
+	t        *testing.T
+	router   *echo.Echo
+	issuer   *auth.Issuer
+	projects storage.ProjectStorage
+	webhooks storage.WebhookStorage
+	// published are the events published by the storages.
+	published []events.Event
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	issuer, err := auth.NewIssuer(config.JWTConfig{Issuer: "test", Audience: "test", AccessTokenTTL: time.Hour})
+	require.NoError(t, err)
+
+	pst := storage.NewMemoryPreferenceStorage()
+	users := storage.NewMemoryUserStorage(pst)
+	milestones := storage.NewMemoryMilestoneStorage()
+	projects := storage.NewMemoryProjectStorage(users, milestones)
+
+	bus := events.NewBus()
+	a := &testAPI{
+		t:        t,
+		issuer:   issuer,
+		projects: storage.NewPublishingProjectStorage(projects, bus),
+		webhooks: storage.NewMemoryWebhookStorage(),
+	}
+	bus.Subscribe(func(e events.Event) { a.published = append(a.published, e) })
+	bus.Subscribe(webhooks.NewDispatcher(a.webhooks).Handle)
+
+	a.router = NewRouter(auth.NewWithIssuer(issuer), Storages{
+		Users:         users,
+		Projects:      a.projects,
+		Benchmarks:    storage.NewPublishingBenchmarkStorage(storage.NewMemoryBenchmarkStorage(projects), bus),
+		Preferences:   pst,
+		Milestones:    milestones,
+		Notifications: storage.NewMemoryNotificationStorage(),
+		Webhooks:      a.webhooks,
+	}, "")
+
+	return a
+}
+
+// token returns an access token for the user with the given roles.
+func (a *testAPI) token(userID string, roles ...string) string {
+	token, _, err := a.issuer.Issue(userID, userID+"@example.com", roles)
+	require.NoError(a.t, err)
+	return token
+}
+
+// request sends body as JSON, headers are given as name, value pairs.
+func (a *testAPI) request(method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		require.NoError(a.t, json.NewEncoder(&payload).Encode(body))
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// upload sends content as the "file" field of a multipart form, fields are
+// given as name, value pairs.
+func (a *testAPI) upload(path, token, filename, content string, fields ...string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, a.uploadRequest(path, token, filename, content, fields...))
+	return rec
+}
+
+func (a *testAPI) uploadRequest(path, token, filename, content string, fields ...string) *http.Request {
+	var payload bytes.Buffer
+	form := multipart.NewWriter(&payload)
+	for i := 0; i+1 < len(fields); i += 2 {
+		require.NoError(a.t, form.WriteField(fields[i], fields[i+1]))
+	}
+	file, err := form.CreateFormFile("file", filename)
+	require.NoError(a.t, err)
+	_, err = file.Write([]byte(content))
+	require.NoError(a.t, err)
+	require.NoError(a.t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, path, &payload)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	return req
+}
+
+// createProject stores a project led by lead with the given team members and
+// client representative.
+func (a *testAPI) createProject(name, lead string, members []string, client string) *data.Project {
+	project := &data.Project{
+		Name:                name,
+		Client:              "Client",
+		Region:              "NSW",
+		CIProjectNumber:     "CI-" + name,
+		ClientProjectNumber: "CP-" + name,
+		Team:                data.ProjectTeam{ProjectLead: data.Member{ID: lead}, TeamMembers: []data.Member{}},
+		StartDate:           primitive.NewDateTimeFromTime(time.Now()),
+		Status:              "active",
+	}
+	project.ClientRepresentative.ID = client
+	project.Scope.RemainsAccessibleForNDays = 30
+	for _, member := range members {
+		project.Team.TeamMembers = append(project.Team.TeamMembers, data.Member{ID: member})
+	}
+
+	created, err := a.projects.CreateProject(project)
+	require.NoError(a.t, err)
+	return created
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	var v T
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v), rec.Body.String())
+	return v
+}
+
+func TestListProjectsFiltersByRole(t *testing.T) {
+	a := newTestAPI(t)
+	a.createProject("Alpha", "lead-1", []string{"member-1"}, "client-1")
+	a.createProject("Bravo", "lead-2", []string{"lead-1"}, "client-2")
+	a.createProject("Charlie", "lead-2", nil, "client-1")
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		want   []string
+	}{
+		{"admin sees every project", a.token("admin", "admin"), http.StatusOK, []string{"Alpha", "Bravo", "Charlie"}},
+		{"member sees the projects they lead or are on", a.token("lead-1", "member"), http.StatusOK, []string{"Alpha", "Bravo"}},
+		{"team member", a.token("member-1", "member"), http.StatusOK, []string{"Alpha"}},
+		{"lead of several projects", a.token("lead-2", "member"), http.StatusOK, []string{"Bravo", "Charlie"}},
+		{"client sees the projects they represent", a.token("client-1", "client"), http.StatusOK, []string{"Alpha", "Charlie"}},
+		{"member of no project", a.token("outsider", "member"), http.StatusOK, []string{}},
+		{"client id with member role", a.token("client-1", "member"), http.StatusOK, []string{}},
+		{"no roles", a.token("lead-1"), http.StatusForbidden, nil},
+		{"no token", "", http.StatusUnauthorized, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.request(http.MethodGet, "/projects", tt.token, nil)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.want == nil {
+				return
+			}
+
+			page := decode[data.Page[*data.ProjectSummary]](t, rec)
+			names := []string{}
+			for _, project := range page.Items {
+				names = append(names, project.Name)
+			}
+			sort.Strings(names)
+
+			assert.Equal(t, tt.want, names)
+			assert.Equal(t, int64(len(tt.want)), page.Total)
+		})
+	}
+}
+
+func TestListProjectsPaging(t *testing.T) {
+	a := newTestAPI(t)
+	for _, name := range []string{"Delta", "Alpha", "Charlie", "Bravo", "Echo"} {
+		a.createProject(name, "lead-1", nil, "client-1")
+	}
+
+	token := a.token("admin", "admin")
+	names := []string{}
+	path := "/projects?limit=2"
+	for i := 0; i < 5; i++ {
+		rec := a.request(http.MethodGet, path, token, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		page := decode[data.Page[*data.ProjectSummary]](t, rec)
+		assert.Equal(t, int64(5), page.Total)
+		for _, project := range page.Items {
+			names = append(names, project.Name)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/projects?limit=2&cursor=" + page.NextCursor
+	}
+
+	assert.Equal(t, []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo"}, names)
+}
+
+func TestUpdateMetricsLeadOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  func(a *testAPI) string
+		status int
+	}{
+		{"lead", func(a *testAPI) string { return a.token("lead-1", "member") }, http.StatusOK},
+		{"admin", func(a *testAPI) string { return a.token("admin", "admin") }, http.StatusOK},
+		{"team member", func(a *testAPI) string { return a.token("member-1", "member") }, http.StatusForbidden},
+		{"lead of another project", func(a *testAPI) string { return a.token("lead-2", "member") }, http.StatusForbidden},
+		{"client representative", func(a *testAPI) string { return a.token("client-1", "client") }, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t)
+			project := a.createProject("Alpha", "lead-1", []string{"member-1"}, "client-1")
+
+			metrics := &data.Metrics{KeyRisks: []data.KeyRisk{{Description: "Flooding", Score: "high"}}}
+			rec := a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/metrics", tt.token(a), metrics, "If-Match", `"0"`)
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+
+			stored, err := a.projects.GetProject(project.ID.Hex())
+			require.NoError(t, err)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+				assert.Equal(t, metrics.KeyRisks, stored.Metrics.KeyRisks)
+				assert.Equal(t, 1, stored.MetricsVersion)
+			} else {
+				assert.Empty(t, stored.Metrics.KeyRisks)
+				assert.Equal(t, 0, stored.Revision)
+			}
+		})
+	}
+}
+
+func TestUpdateMetricsRevision(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	token := a.token("lead-1", "member")
+	path := "/projects/" + project.ID.Hex() + "/metrics"
+
+	rec := a.request(http.MethodPut, path, token, &data.Metrics{})
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodPut, path, token, &data.Metrics{}, "If-Match", `"0"`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// a second update based on the same revision lost the race
+	rec = a.request(http.MethodPut, path, token, &data.Metrics{}, "If-Match", `"0"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, 1, decode[data.Project](t, rec).Revision)
+}
+
+func TestCompletedProjectIsLocked(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	token := a.token("lead-1", "member")
+
+	completion := map[string]interface{}{"completionDate": time.Now().UTC().Format(time.RFC3339)}
+	rec := a.request(http.MethodPatch, "/projects/"+project.ID.Hex()+"/completed", token, completion)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "completed", decode[data.Project](t, rec).Status)
+
+	rec = a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/metrics", token, &data.Metrics{}, "If-Match", `"1"`)
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	problem := decode[apperror.Problem](t, rec)
+	assert.Equal(t, apperror.KindBadRequest, problem.Code)
+	assert.Equal(t, "can't update the metrics of a project that is completed", problem.Message)
+
+	// admins are held to the same rule
+	rec = a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/metrics", a.token("admin", "admin"), &data.Metrics{}, "If-Match", `"1"`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
+
+func TestValidationErrors(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	admin := a.token("admin", "admin")
+
+	t.Run("create project", func(t *testing.T) {
+		rec := a.request(http.MethodPost, "/projects", admin, map[string]string{"name": "New project"})
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+		problem := decode[apperror.Problem](t, rec)
+		assert.Equal(t, apperror.KindValidation, problem.Code)
+		assert.NotContains(t, problem.Fields, "name")
+		for _, field := range []string{"client", "region", "ciProjectNumber", "clientProjectNumber", "clientRepresentative", "projectLead", "startDate"} {
+			assert.Contains(t, problem.Fields, field)
+		}
+	})
+
+	t.Run("update metrics", func(t *testing.T) {
+		metrics := &data.Metrics{}
+		metrics.Benchmarking.Benchmarks = []data.ProjectBenchmark{{DisplayProjectName: true}}
+
+		rec := a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/metrics", admin, metrics, "If-Match", `"0"`)
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+		problem := decode[apperror.Problem](t, rec)
+		assert.Equal(t, apperror.KindValidation, problem.Code)
+		assert.Equal(t, map[string]string{"benchmark-0": "benchmark is required"}, problem.Fields)
+	})
+
+	t.Run("client visibility", func(t *testing.T) {
+		payload := map[string]interface{}{"sections": []string{"keyRisks", "secrets"}}
+
+		rec := a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/visibility", admin, payload)
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+		problem := decode[apperror.Problem](t, rec)
+		assert.Equal(t, apperror.KindValidation, problem.Code)
+		assert.Contains(t, problem.Fields, "section-1")
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		rec := a.request(http.MethodGet, "/projects/not-an-id", admin, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+}
+
+func TestArchivedProjectAccess(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	change := data.StatusChange{From: data.StatusActive, To: data.StatusCompleted}
+	_, err := a.projects.UpdateStatus(project.ID.Hex(), change, primitive.NewDateTimeFromTime(time.Now().AddDate(0, 0, -40)))
+	require.NoError(t, err)
+
+	path := "/projects/" + project.ID.Hex()
+	admin := a.token("admin", "admin")
+	lead := a.token("lead-1", "member")
+
+	// expired projects are locked out before the worker archives them
+	rec := a.request(http.MethodGet, path, lead, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	archived, err := a.projects.ArchiveExpired(time.Now())
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+
+	rec = a.request(http.MethodGet, path, lead, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodGet, "/projects?status=archived", lead, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodGet, path, admin, nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodGet, "/projects", admin, nil)
+	assert.Empty(t, decode[data.Page[*data.ProjectSummary]](t, rec).Items)
+	rec = a.request(http.MethodGet, "/projects?status=archived", admin, nil)
+	assert.Len(t, decode[data.Page[*data.ProjectSummary]](t, rec).Items, 1)
+
+	// extending by too little leaves the project archived
+	rec = a.request(http.MethodPost, path+"/extend-access", admin, map[string]int{"days": 5})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodPost, path+"/extend-access", admin, map[string]int{"days": 30})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, data.StatusCompleted, decode[data.Project](t, rec).Status)
+
+	rec = a.request(http.MethodGet, path, lead, nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodPost, path+"/reopen", lead, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodPost, path+"/reopen", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, data.StatusActive, decode[data.Project](t, rec).Status)
+
+	rec = a.request(http.MethodPost, path+"/reopen", admin, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+}
+
+func TestUpdateStatus(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.token("admin", "admin")
+	lead := a.token("lead-1", "member")
+
+	rec := a.request(http.MethodPost, "/projects", admin, map[string]interface{}{
+		"name":                 "Alpha",
+		"client":               "Client",
+		"region":               "Region",
+		"ciProjectNumber":      "CI-1",
+		"clientProjectNumber":  "CP-1",
+		"clientRepresentative": map[string]string{"id": "client-1"},
+		"team":                 map[string]interface{}{"projectLead": map[string]string{"id": "lead-1"}},
+		"startDate":            time.Now().UTC().Format(time.RFC3339),
+		"scope": map[string]interface{}{
+			"estimatedCompletionDate":   time.Now().AddDate(0, 6, 0).UTC().Format(time.RFC3339),
+			"remainsAccessibleForNDays": 30,
+		},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	project := decode[data.Project](t, rec)
+	assert.Equal(t, data.StatusDraft, project.Status)
+
+	path := "/projects/" + project.ID.Hex()
+	status := func(token, to string) *httptest.ResponseRecorder {
+		return a.request(http.MethodPatch, path+"/status", token, map[string]string{"status": to, "reason": "testing"})
+	}
+
+	// only admins activate drafts
+	rec = status(lead, data.StatusActive)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = status(admin, data.StatusActive)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = status(lead, data.StatusOnHold)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// no metrics edits while on hold
+	rec = a.request(http.MethodPut, path+"/metrics", lead, &data.Metrics{}, "If-Match", `"2"`)
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Equal(t, "can't update the metrics of a project that is on-hold", decode[apperror.Problem](t, rec).Message)
+
+	rec = status(lead, data.StatusArchived)
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+	rec = status(lead, "cancelled")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = status(a.token("member-1", "member"), data.StatusActive)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = status(lead, data.StatusCompleted)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	revision := rec.Header().Get("ETag")
+	completed := decode[data.Project](t, rec)
+	assert.NotZero(t, completed.CompletionDate)
+
+	history := completed.StatusHistory
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{data.StatusDraft, data.StatusActive, data.StatusOnHold}, []string{history[0].From, history[1].From, history[2].From})
+	assert.Equal(t, data.StatusCompleted, history[2].To)
+	assert.Equal(t, "lead-1", history[2].ChangedBy.ID)
+	assert.Equal(t, "testing", history[2].Reason)
+	assert.NotZero(t, history[2].ChangedAt)
+
+	// the status can't be changed by updating the project
+	completed.Status = data.StatusActive
+	rec = a.request(http.MethodPut, path, admin, completed, "If-Match", revision)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	// the response is the project as stored
+	res := decode[data.Project](t, rec)
+	assert.Equal(t, data.StatusCompleted, res.Status)
+	assert.Len(t, res.StatusHistory, 3)
+	// and so is the project subscribers are sent
+	event := a.published[len(a.published)-1]
+	assert.Equal(t, events.ProjectUpdated, event.Type)
+	assert.Equal(t, data.StatusCompleted, event.Project.Status)
+	assert.Equal(t, res.Revision, event.Project.Revision)
+	rec = a.request(http.MethodGet, path, admin, nil)
+	stored := decode[data.Project](t, rec)
+	assert.Equal(t, data.StatusCompleted, stored.Status)
+
+	// nor the metrics or the completion date access runs from
+	stored.Metrics.KeyCostDriversBaseValue = 42
+	stored.CompletionDate = primitive.NewDateTimeFromTime(time.Now().AddDate(1, 0, 0))
+	rec = a.request(http.MethodPut, path, admin, stored, "If-Match", rec.Header().Get("ETag"))
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodGet, path, admin, nil)
+	updated := decode[data.Project](t, rec)
+	assert.Zero(t, updated.Metrics.KeyCostDriversBaseValue)
+	assert.Equal(t, completed.MetricsVersion, updated.MetricsVersion)
+	assert.Equal(t, completed.CompletionDate, updated.CompletionDate)
+}
+
+func TestMilestones(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", []string{"member-1"}, "client-1")
+	other := a.createProject("Bravo", "lead-2", nil, "client-2")
+	path := "/projects/" + project.ID.Hex() + "/milestones"
+	lead := a.token("lead-1", "member")
+
+	create := func(name string, planned time.Time) data.Milestone {
+		rec := a.request(http.MethodPost, path, lead, map[string]interface{}{
+			"name":          name,
+			"levelOfDesign": "Concept",
+			"plannedDate":   planned.UTC().Format(time.RFC3339),
+			"packages":      []data.Package{{Description: "Drainage", Progress: 50}},
+			"cost":          data.MilestoneCost{BaseValue: 100, P90OutturnCost: 150},
+		})
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		return decode[data.Milestone](t, rec)
+	}
+
+	now := time.Now()
+	later := create("Detailed design", now.AddDate(0, 2, 0))
+	first := create("Concept design", now.AddDate(0, 1, 0))
+
+	rec := a.request(http.MethodGet, path, a.token("client-1", "client"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	list := decode[data.MilestoneList](t, rec)
+	require.Len(t, list.Items, 2)
+	assert.Equal(t, []string{"Concept design", "Detailed design"}, []string{list.Items[0].Name, list.Items[1].Name})
+	assert.Equal(t, first.ID, *list.CurrentID)
+
+	// reaching the first milestone makes the next one current
+	first.ActualDate = &first.PlannedDate
+	first.Progress = 100
+	rec = a.request(http.MethodPut, path+"/"+first.ID.Hex(), lead, first)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotNil(t, decode[data.Milestone](t, rec).ActualDate)
+
+	rec = a.request(http.MethodGet, path, lead, nil)
+	assert.Equal(t, later.ID, *decode[data.MilestoneList](t, rec).CurrentID)
+
+	t.Run("validation", func(t *testing.T) {
+		rec := a.request(http.MethodPost, path, lead, map[string]interface{}{"progress": 120})
+		require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+		problem := decode[apperror.Problem](t, rec)
+		assert.Equal(t, apperror.KindValidation, problem.Code)
+		for _, field := range []string{"name", "plannedDate", "progress"} {
+			assert.Contains(t, problem.Fields, field)
+		}
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		rec := a.request(http.MethodPost, path, a.token("member-1", "member"), first)
+		assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+		rec = a.request(http.MethodGet, path, a.token("lead-2", "member"), nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+		// milestones are only found through their own project
+		rec = a.request(http.MethodGet, "/projects/"+other.ID.Hex()+"/milestones/"+first.ID.Hex(), a.token("admin", "admin"), nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rec := a.request(http.MethodDelete, path+"/"+later.ID.Hex(), lead, nil)
+		require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+		rec = a.request(http.MethodGet, path, lead, nil)
+		list := decode[data.MilestoneList](t, rec)
+		assert.Len(t, list.Items, 1)
+		assert.Nil(t, list.CurrentID)
+	})
+
+	t.Run("locked with the metrics", func(t *testing.T) {
+		rec := a.request(http.MethodPatch, "/projects/"+project.ID.Hex()+"/status", lead, map[string]string{"status": data.StatusOnHold})
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		rec = a.request(http.MethodPut, path+"/"+first.ID.Hex(), lead, first)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	})
+}
+
+func TestProjectKPIs(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+
+	metrics := &data.Metrics{}
+	metrics.CommercialInformation = data.CommercialInformation{CIContractedValue: 1000, CIAccrualToDate: 250}
+	rec := a.request(http.MethodPut, "/projects/"+project.ID.Hex()+"/metrics", a.token("lead-1", "member"), metrics, "If-Match", `"0"`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	type response struct {
+		KPIs struct {
+			Fee *struct {
+				RemainingFee float64 `json:"remainingFee"`
+			} `json:"fee"`
+		} `json:"kpis"`
+	}
+
+	rec = a.request(http.MethodGet, "/projects/"+project.ID.Hex(), a.token("lead-1", "member"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	fee := decode[response](t, rec).KPIs.Fee
+	require.NotNil(t, fee)
+	assert.Equal(t, 750.0, fee.RemainingFee)
+
+	// the KPIs of hidden sections are left out
+	rec = a.request(http.MethodGet, "/projects/"+project.ID.Hex(), a.token("client-1", "client"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, decode[response](t, rec).KPIs.Fee)
+}
+
+func TestPortfolioSummary(t *testing.T) {
+	a := newTestAPI(t)
+	estimated := primitive.NewDateTimeFromTime(time.Now().AddDate(0, 3, 0))
+
+	// Alpha is overdue on its cost estimation, Bravo isn't
+	alpha := a.createProject("Alpha", "lead-1", nil, "client-1")
+	bravo := a.createProject("Bravo", "lead-2", []string{"lead-1"}, "client-2")
+	a.createProject("Charlie", "lead-2", nil, "client-2")
+
+	alpha.Client, alpha.Region = "Acme", "VIC"
+	bravo.Client = "Bolt"
+	for _, project := range []*data.Project{alpha, bravo} {
+		project.Scope.CostEstimation = true
+		project.Scope.EstimatedCompletionDate = estimated
+		_, err := a.projects.UpdateProject(project.ID.Hex(), project, 0)
+		require.NoError(t, err)
+	}
+
+	alphaMetrics := &data.Metrics{}
+	alphaMetrics.CommercialInformation = data.CommercialInformation{CIContractedValue: 1000, CIAccrualToDate: 400}
+	alphaMetrics.AnticipatedCompletionDate.CostEstimation = primitive.NewDateTimeFromTime(estimated.Time().AddDate(0, 1, 0))
+	alphaMetrics.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{
+		{Date: 1, P50OutturnCost: 100, P90OutturnCost: 150, CurrentMilstone: true},
+		{Date: 2, P50OutturnCost: 500, P90OutturnCost: 900},
+	}
+	_, err := a.projects.UpdateMetrics(alpha.ID.Hex(), alphaMetrics, 1, data.Member{}, "")
+	require.NoError(t, err)
+
+	bravoMetrics := &data.Metrics{}
+	bravoMetrics.CommercialInformation = data.CommercialInformation{CIContractedValue: 500, CIAccrualToDate: 100}
+	bravoMetrics.AnticipatedCompletionDate.CostEstimation = estimated
+	bravoMetrics.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{
+		{LevelOfDesign: "Concept", Date: 1, P50OutturnCost: 10, P90OutturnCost: 20},
+		{LevelOfDesign: "Design", Date: 2, P50OutturnCost: 30, P90OutturnCost: 40},
+	}
+	_, err = a.projects.UpdateMetrics(bravo.ID.Hex(), bravoMetrics, 1, data.Member{}, "")
+	require.NoError(t, err)
+
+	rec := a.request(http.MethodGet, "/portfolio/summary", a.token("admin", "admin"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	summary := decode[data.PortfolioSummary](t, rec)
+
+	assert.Equal(t, 3, summary.Projects)
+	assert.Equal(t, []data.PortfolioCount{{Key: data.StatusActive, Count: 3}}, summary.ByStatus)
+	assert.Equal(t, []data.PortfolioCount{{Key: "NSW", Count: 2}, {Key: "VIC", Count: 1}}, summary.ByRegion)
+	assert.Equal(t, []data.PortfolioCount{{Key: "Acme", Count: 1}, {Key: "Bolt", Count: 1}, {Key: "Client", Count: 1}}, summary.ByClient)
+	assert.Equal(t, &data.PortfolioCommercial{ContractedValue: 1500, AccrualToDate: 500}, summary.Commercial)
+	// the flagged milestone of Alpha and the latest of Bravo
+	assert.Equal(t, 130.0, summary.P50OutturnCost)
+	assert.Equal(t, 190.0, summary.P90OutturnCost)
+	require.Len(t, summary.Overdue, 1)
+	assert.Equal(t, "Alpha", summary.Overdue[0].Name)
+
+	admin := a.token("admin", "admin")
+	levels := func() map[string]string {
+		rec := a.request(http.MethodGet, "/projects", admin, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		res := map[string]string{}
+		for _, summary := range decode[data.Page[*data.ProjectSummary]](t, rec).Items {
+			res[summary.Name] = summary.CurrentLevelOfDesign
+		}
+		return res
+	}
+	// the latest row without a flagged one
+	assert.Equal(t, "Design", levels()["Bravo"])
+
+	// the milestones of a project decide its current cost over the rows
+	rec = a.request(http.MethodPost, "/projects/"+bravo.ID.Hex()+"/milestones", admin, map[string]interface{}{
+		"name":          "Tender",
+		"levelOfDesign": "Detailed",
+		"plannedDate":   time.Now().AddDate(0, 1, 0).UTC().Format(time.RFC3339),
+		"cost":          data.MilestoneCost{P50OutturnCost: 60, P90OutturnCost: 80},
+	})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodGet, "/portfolio/summary", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	summary = decode[data.PortfolioSummary](t, rec)
+	assert.Equal(t, 160.0, summary.P50OutturnCost)
+	assert.Equal(t, 230.0, summary.P90OutturnCost)
+	assert.Equal(t, "Detailed", levels()["Bravo"])
+	rec = a.request(http.MethodGet, "/projects/"+bravo.ID.Hex(), admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, &analytics.CostKPIs{LevelOfDesign: "Detailed", P50OutturnCost: 60, P90OutturnCost: 80, Spread: 20, SpreadPercent: 33.33}, decode[struct{ KPIs *analytics.KPIs }](t, rec).KPIs.Cost)
+
+	// members only get the projects they are on
+	rec = a.request(http.MethodGet, "/portfolio/summary", a.token("lead-1", "member"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	summary = decode[data.PortfolioSummary](t, rec)
+	assert.Equal(t, 2, summary.Projects)
+	assert.Equal(t, 1500.0, summary.Commercial.ContractedValue)
+
+	// clients don't get the commercial totals
+	rec = a.request(http.MethodGet, "/portfolio/summary?region=NSW", a.token("client-2", "client"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	summary = decode[data.PortfolioSummary](t, rec)
+	assert.Equal(t, 2, summary.Projects)
+	assert.Nil(t, summary.Commercial)
+
+	rec = a.request(http.MethodGet, "/portfolio/summary", a.token("lead-1"), nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
+
+func TestBenchmarkComparison(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	admin := a.token("admin", "admin")
+
+	ids := []primitive.ObjectID{}
+	for _, name := range []string{"Pacific Highway", "Hume Highway"} {
+		rec := a.request(http.MethodPost, "/benchmarks", admin, &data.Benchmark{Name: name, GeographicLocation: "NSW", TotalProjectCostP90: 100})
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		ids = append(ids, decode[data.Benchmark](t, rec).ID)
+	}
+
+	metrics := &data.Metrics{}
+	metrics.Benchmarking = data.Benchmarking{
+		EnableTotalProjectCost: true,
+		TotalProjectCostP90:    150,
+		Benchmarks:             []data.ProjectBenchmark{{BenchmarkID: ids[0], DisplayProjectName: true}, {BenchmarkID: ids[1]}},
+	}
+	_, err := a.projects.UpdateMetrics(project.ID.Hex(), metrics, 0, data.Member{}, "")
+	require.NoError(t, err)
+
+	path := "/projects/" + project.ID.Hex() + "/benchmarks/comparison"
+	names := func(token string) []string {
+		rec := a.request(http.MethodGet, path, token, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		names := []string{}
+		for _, benchmark := range decode[analytics.BenchmarkComparison](t, rec).Benchmarks {
+			names = append(names, benchmark.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Pacific Highway", "Hume Highway"}, names(a.token("lead-1", "member")))
+	assert.Equal(t, []string{"Pacific Highway", "Benchmark 2"}, names(a.token("client-1", "client")))
+
+	rec := a.request(http.MethodGet, path, a.token("client-2", "client"), nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
+
+func TestImportBenchmarks(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.token("admin", "admin")
+
+	rec := a.request(http.MethodPost, "/benchmarks", admin, &data.Benchmark{Name: "Pacific Highway", GeographicLocation: "NSW", TotalProjectCostP90: 100})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	pacific := decode[data.Benchmark](t, rec)
+
+	file := "Name,Location,P90\n" +
+		"pacific highway ,NSW,150\n" +
+		"Hume Highway,VIC,200\n" +
+		"Hume Highway,VIC,250\n" +
+		"Bruce Highway,,-1\n"
+	mapping := `{"Location": "geographicLocation", "P90": "totalProjectCostP90"}`
+
+	type report struct {
+		Created, Updated, Failed int
+		Rows                     []struct {
+			Row    int
+			Action string
+			ID     *primitive.ObjectID
+			Errors map[string]string
+		}
+	}
+	actions := func(r report) []string {
+		res := []string{}
+		for _, row := range r.Rows {
+			res = append(res, row.Action)
+		}
+		return res
+	}
+	names := func() []string {
+		rec := a.request(http.MethodGet, "/benchmarks", admin, nil)
+		res := []string{}
+		for _, benchmark := range decode[[]data.Benchmark](t, rec) {
+			res = append(res, fmt.Sprintf("%s %g", benchmark.Name, benchmark.TotalProjectCostP90))
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	rec = a.upload("/benchmarks/import", a.token("lead-1", "member"), "benchmarks.csv", file)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = a.upload("/benchmarks/import", admin, "benchmarks.csv", file, "mapping", mapping, "dryRun", "true")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res := decode[report](t, rec)
+	assert.Equal(t, []string{"fail", "create", "fail", "fail"}, actions(res))
+	assert.Equal(t, 1, res.Created)
+	assert.Equal(t, 3, res.Failed)
+	assert.Contains(t, res.Rows[0].Errors, "name")
+	assert.Equal(t, map[string]string{"name": "duplicates the name of row 3"}, res.Rows[2].Errors)
+	assert.Len(t, res.Rows[3].Errors, 2)
+	assert.Equal(t, []string{"Pacific Highway 100"}, names(), "dry runs write nothing")
+
+	rec = a.upload("/benchmarks/import", admin, "benchmarks.csv", file, "mapping", mapping, "mode", "upsert")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res = decode[report](t, rec)
+	assert.Equal(t, []string{"update", "create", "fail", "fail"}, actions(res))
+	assert.Equal(t, []string{"Hume Highway 200", "pacific highway 150"}, names())
+	require.NotNil(t, res.Rows[0].ID)
+	assert.Equal(t, pacific.ID, *res.Rows[0].ID)
+	require.NotNil(t, res.Rows[1].ID)
+	assert.False(t, res.Rows[1].ID.IsZero())
+	assert.NotEqual(t, pacific.ID, *res.Rows[1].ID)
+
+	rec = a.upload("/benchmarks/import", admin, "benchmarks.txt", file)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodGet, "/benchmarks/export", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "text/csv", rec.Header().Get(echo.HeaderContentType))
+	exported := rec.Body.String()
+	assert.Contains(t, exported, "name,geographicLocation,totalProjectCostP90")
+
+	rec = a.upload("/benchmarks/import", admin, "benchmarks.csv", exported, "mode", "upsert")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res = decode[report](t, rec)
+	assert.Equal(t, 2, res.Updated, "exports import back")
+
+	rec = a.request(http.MethodGet, "/benchmarks/export?format=xlsx", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = a.upload("/benchmarks/import", admin, "benchmarks.xlsx", rec.Body.String(), "dryRun", "1", "mode", "upsert")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, 2, decode[report](t, rec).Updated)
+}
+
+func TestProjectReport(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	path := "/projects/" + project.ID.Hex() + "/report.pdf"
+
+	rec := a.request(http.MethodGet, path, a.token("client-1", "client"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/pdf", rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "CI-Alpha-report.pdf")
+	assert.True(t, bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-")))
+
+	rec = a.request(http.MethodGet, path, a.token("client-2", "client"), nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+}
+
+func TestExportWorkbooks(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	a.createProject("Bravo", "lead-2", nil, "client-2")
+
+	sheets := func(rec *httptest.ResponseRecorder) []string {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		workbook, err := excelize.OpenReader(rec.Body)
+		require.NoError(t, err)
+		defer workbook.Close()
+		return workbook.GetSheetList()
+	}
+
+	path := "/projects/" + project.ID.Hex() + "/export.xlsx"
+	assert.Contains(t, sheets(a.request(http.MethodGet, path, a.token("lead-1", "member"), nil)), "Commercial")
+	assert.NotContains(t, sheets(a.request(http.MethodGet, path, a.token("client-1", "client"), nil)), "Commercial")
+
+	rec := a.request(http.MethodGet, path, a.token("client-2", "client"), nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodGet, "/projects/export.xlsx", a.token("client-1", "client"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "portfolio.xlsx")
+
+	rows, err := spreadsheet.Read(rec.Body, spreadsheet.XLSX)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "Alpha", rows[1][0])
+}
+
+func TestImportMetrics(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", []string{"member-1"}, "client-1")
+	path := "/projects/" + project.ID.Hex() + "/metrics/import"
+	lead := a.token("lead-1", "member")
+
+	imported := &data.Project{}
+	imported.Metrics.KeyRisks = []data.KeyRisk{{Description: "Wet weather", Score: "High", Trend: "Rising"}}
+	var buf bytes.Buffer
+	require.NoError(t, spreadsheet.Write(&buf, spreadsheet.XLSX, spreadsheet.ProjectSheets(imported, nil, nil, time.Now())...))
+	workbook := buf.String()
+
+	rec := a.upload(path, a.token("member-1", "member"), "estimate.xlsx", workbook)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = a.upload(path, lead, "estimate.csv", workbook)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	type preview struct {
+		Confirmed bool
+		Revision  int
+		Changes   []data.Change
+	}
+
+	rec = a.upload(path, lead, "estimate.xlsx", workbook)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res := decode[preview](t, rec)
+	assert.False(t, res.Confirmed)
+	assert.NotEmpty(t, res.Changes)
+	tag := rec.Header().Get("ETag")
+
+	stored, err := a.projects.GetProject(project.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, stored.Metrics.KeyRisks, "previews save nothing")
+
+	rec = a.upload(path+"?confirm=true", lead, "estimate.xlsx", workbook)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code, rec.Body.String())
+
+	confirm := func(tag string) *httptest.ResponseRecorder {
+		req := a.uploadRequest(path+"?confirm=true", lead, "estimate.xlsx", workbook)
+		req.Header.Set("If-Match", tag)
+		rec := httptest.NewRecorder()
+		a.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = confirm(tag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	res = decode[preview](t, rec)
+	assert.True(t, res.Confirmed)
+	assert.Equal(t, fmt.Sprintf(`"%d"`, res.Revision), rec.Header().Get("ETag"))
+
+	stored, err = a.projects.GetProject(project.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, imported.Metrics.KeyRisks, stored.Metrics.KeyRisks)
+
+	rec = confirm(tag)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code, "the preview is stale")
+}
+
+func TestListUsers(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.token("admin", "admin")
+	for _, user := range []*data.User{
+		{Type: "member", FullName: "Ann Lead", Email: "ann@example.com", Bio: "Estimator"},
+		{Type: "client", FullName: "Bob Client", Email: "bob@example.com", Organisation: "Acme"},
+	} {
+		rec := a.request(http.MethodPost, "/users", admin, user)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	rec := a.request(http.MethodGet, "/users", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	page := decode[data.Page[*data.User]](t, rec)
+	assert.Len(t, page.Items, 2)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Empty(t, page.NextCursor)
+
+	rec = a.request(http.MethodGet, "/users?page=1", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, decode[data.Page[*data.User]](t, rec).Items)
+	rec = a.request(http.MethodGet, "/users?page=-1", admin, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	// clients can't look through the directory
+	for _, path := range []string{"/users", "/users?q=ann", "/users?organisation=Acme"} {
+		rec = a.request(http.MethodGet, path, a.token("client-1", "client"), nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code, path)
+	}
+
+	rec = a.request(http.MethodGet, "/users?q=ann", a.token("member-1", "member"), nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	page = decode[data.Page[*data.User]](t, rec)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Ann Lead", page.Items[0].FullName)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	a := newTestAPI(t)
+	token := a.token("user-1", "member")
+
+	rec := a.request(http.MethodGet, "/users/me/notifications", token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, data.NotificationPreferences{UserID: "user-1", OptOut: []data.NotificationEvent{}}, decode[data.NotificationPreferences](t, rec))
+
+	rec = a.request(http.MethodPut, "/users/me/notifications", token, map[string]interface{}{"optOut": []string{"passwordReset", "unknown"}})
+	problem := decode[apperror.Problem](t, rec)
+	assert.Equal(t, apperror.KindValidation, problem.Code)
+	assert.Len(t, problem.Fields, 2)
+
+	rec = a.request(http.MethodPut, "/users/me/notifications", token, map[string]interface{}{"userId": "user-2", "optOut": []string{"metricsPublished"}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodGet, "/users/me/notifications", token, nil)
+	prefs := decode[data.NotificationPreferences](t, rec)
+	assert.Equal(t, "user-1", prefs.UserID)
+	assert.Equal(t, []data.NotificationEvent{data.NotifyMetricsPublished}, prefs.OptOut)
+}
+
+func TestProjectEvents(t *testing.T) {
+	a := newTestAPI(t)
+	project := a.createProject("Alpha", "lead-1", nil, "client-1")
+	path := "/projects/" + project.ID.Hex()
+	token := a.token("lead-1", "member")
+
+	rec := a.request(http.MethodPut, path+"/metrics", token, &data.Metrics{}, "If-Match", `"0"`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodPatch, path+"/completed", token, map[string]interface{}{})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	require.Len(t, a.published, 3)
+	assert.Equal(t, events.ProjectCreated, a.published[0].Type)
+	assert.Equal(t, events.MetricsUpdated, a.published[1].Type)
+	assert.Equal(t, 1, a.published[1].Project.Revision)
+	assert.Equal(t, 1, a.published[1].Project.MetricsVersion)
+	assert.Equal(t, events.StatusChanged, a.published[2].Type)
+	assert.Equal(t, data.StatusCompleted, a.published[2].Status.To)
+	assert.Equal(t, "active", a.published[2].Before.Status)
+	for _, e := range a.published[1:] {
+		assert.Equal(t, "lead-1", e.Actor.ID)
+		assert.False(t, e.At.IsZero())
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	a := newTestAPI(t)
+	admin := a.token("admin", "admin")
+
+	rec := a.request(http.MethodPost, "/webhooks", a.token("lead-1", "member"), map[string]interface{}{"url": "https://example.com/hook", "events": []string{"project.created"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodPost, "/webhooks", admin, map[string]interface{}{"url": "example.com", "events": []string{"project.deleted"}})
+	problem := decode[apperror.Problem](t, rec)
+	assert.Equal(t, apperror.KindValidation, problem.Code)
+	assert.Contains(t, problem.Fields, "url")
+	assert.Contains(t, problem.Fields, "events-0")
+
+	rec = a.request(http.MethodPost, "/webhooks", admin, map[string]interface{}{"url": "https://example.com/hook", "events": []string{"project.created", "benchmark.changed"}})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	webhook := decode[data.Webhook](t, rec)
+	assert.True(t, webhook.Active)
+	assert.Len(t, webhook.Secret, 64)
+	path := "/webhooks/" + webhook.ID.Hex()
+
+	// the secret is only returned once
+	rec = a.request(http.MethodGet, "/webhooks", admin, nil)
+	listed := decode[[]data.Webhook](t, rec)
+	require.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Secret)
+
+	// changes made to projects and benchmarks are queued
+	a.createProject("Alpha", "lead-1", nil, "client-1")
+	rec = a.request(http.MethodPost, "/benchmarks", admin, map[string]interface{}{"name": "Road", "geographicLocation": "NSW"})
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	rec = a.request(http.MethodGet, path+"/deliveries", admin, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	deliveries := decode[[]data.WebhookDelivery](t, rec)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, data.WebhookBenchmarkChanged, deliveries[0].Event)
+	assert.Equal(t, data.WebhookProjectCreated, deliveries[1].Event)
+	assert.Equal(t, data.DeliveryPending, deliveries[1].Status)
+
+	rec = a.request(http.MethodPost, path+"/ping", admin, nil)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	assert.Equal(t, data.WebhookPing, decode[data.WebhookDelivery](t, rec).Event)
+
+	rec = a.request(http.MethodPost, path+"/deliveries/"+deliveries[1].ID.Hex()+"/replay", admin, nil)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	replay := decode[data.WebhookDelivery](t, rec)
+	assert.Equal(t, deliveries[1].ID, *replay.ReplayOf)
+	assert.Equal(t, deliveries[1].Payload, replay.Payload)
+
+	// deactivated webhooks aren't told about changes
+	rec = a.request(http.MethodPut, path, admin, map[string]interface{}{"url": "https://example.com/hook", "events": []string{"project.created"}, "active": false})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.False(t, decode[data.Webhook](t, rec).Active)
+	a.createProject("Beta", "lead-1", nil, "client-1")
+
+	rec = a.request(http.MethodGet, path+"/deliveries?limit=10", admin, nil)
+	assert.Len(t, decode[[]data.WebhookDelivery](t, rec), 4)
+
+	rec = a.request(http.MethodDelete, path, admin, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = a.request(http.MethodGet, path, admin, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+}
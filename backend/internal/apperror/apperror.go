@@ -0,0 +1,150 @@
+// Package apperror defines the errors storages and handlers return so they can
+// be turned into a consistent HTTP response in a single place.
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type Kind string
+
+const (
+	KindBadRequest         Kind = "bad_request"
+	KindValidation         Kind = "validation"
+	KindUnauthorized       Kind = "unauthorized"
+	KindForbidden          Kind = "forbidden"
+	KindNotFound           Kind = "not_found"
+	KindConflict           Kind = "conflict"
+	KindPreconditionFailed Kind = "precondition_failed"
+	KindPreconditionReq    Kind = "precondition_required"
+	KindUpstream           Kind = "upstream"
+	KindInternal           Kind = "internal"
+)
+
+var statuses = map[Kind]int{
+	KindBadRequest:         http.StatusBadRequest,
+	KindValidation:         http.StatusBadRequest,
+	KindUnauthorized:       http.StatusUnauthorized,
+	KindForbidden:          http.StatusForbidden,
+	KindNotFound:           http.StatusNotFound,
+	KindConflict:           http.StatusConflict,
+	KindPreconditionFailed: http.StatusPreconditionFailed,
+	KindPreconditionReq:    http.StatusPreconditionRequired,
+	KindUpstream:           http.StatusBadGateway,
+	KindInternal:           http.StatusInternalServerError,
+}
+
+// Error is an error that is safe to show to the client. Err is the underlying
+// cause, it is only logged.
+type Error struct {
+	Kind    Kind
+	Message string
+	Fields  map[string]string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any *Error of the same kind and message, so sentinel errors can
+// be compared with errors.Is even after being wrapped.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Message == e.Message
+}
+
+// Status is the HTTP status code for the error.
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Kind]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func BadRequest(message string) *Error {
+	return &Error{Kind: KindBadRequest, Message: message}
+}
+
+// InvalidID is returned for ids that aren't valid ObjectIDs.
+func InvalidID(err error) *Error {
+	return &Error{Kind: KindBadRequest, Message: "invalid id", Err: err}
+}
+
+// Validation is returned when a payload fails validation, fields maps each
+// invalid field to what's wrong with it.
+func Validation(fields map[string]string) *Error {
+	return &Error{Kind: KindValidation, Message: "validation failed", Fields: fields}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+// NotFound is returned when a resource, e.g. "project", doesn't exist.
+func NotFound(resource string) *Error {
+	return &Error{Kind: KindNotFound, Message: resource + " not found"}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+func PreconditionFailed(message string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Message: message}
+}
+
+// PreconditionRequired is returned when a conditional request header, e.g.
+// If-Match, is missing.
+func PreconditionRequired(message string) *Error {
+	return &Error{Kind: KindPreconditionReq, Message: message}
+}
+
+// Upstream is returned when a service we depend on, e.g. "auth0", fails.
+func Upstream(service string, err error) *Error {
+	return &Error{Kind: KindUpstream, Message: service + " request failed", Err: err}
+}
+
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Message: "internal server error", Err: err}
+}
+
+// As returns err as an *Error, anything that isn't one is an internal error.
+func As(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal(err)
+}
+
+// IsKind reports whether err is an *Error of the given kind.
+func IsKind(err error, kind Kind) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == kind
+}
+
+// Problem is the JSON body of every error response.
+type Problem struct {
+	Code      Kind              `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+func (e *Error) Problem(requestID string) *Problem {
+	return &Problem{Code: e.Kind, Message: e.Message, Fields: e.Fields, RequestID: requestID}
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	st "github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// sensitiveFields are recorded as changed without their values.
+var sensitiveFields = map[string]bool{
+	"password": true,
+}
+
+const redacted = "[redacted]"
+
+// Recorder writes audit entries for the changes made by handlers. A nil
+// Recorder records nothing.
+type Recorder struct {
+	storage st.AuditStorage
+}
+
+func NewRecorder(storage st.AuditStorage) *Recorder {
+	return &Recorder{storage: storage}
+}
+
+// Record logs that the current subject performed action on a resource.
+// before and after are the resource as it was and as it is now, either may be
+// nil. Failing to record doesn't fail the request, it is only logged.
+func (r *Recorder) Record(c echo.Context, action data.AuditAction, resourceType, resourceID string, before, after interface{}) {
+	r.RecordForProject(c, "", action, resourceType, resourceID, before, after)
+}
+
+// RecordForProject is Record for a resource of a project, so the entry shows
+// in the project's activity.
+func (r *Recorder) RecordForProject(c echo.Context, projectID string, action data.AuditAction, resourceType, resourceID string, before, after interface{}) {
+	if r == nil {
+		return
+	}
+
+	entry := &data.AuditEntry{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ProjectID:    projectID,
+		Changes:      changes(before, after),
+		RequestID:    c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+
+	if subject, err := auth.SubjectFromContext(c); err == nil {
+		entry.Actor = data.Member{ID: subject.ID, Email: subject.Email}
+	}
+
+	_, err := r.storage.CreateEntry(entry)
+	if err != nil {
+		fmt.Println("error recording audit entry", action, resourceType, resourceID, err)
+	}
+}
+
+// changes diffs before and after, leaving out the empty fields of a resource
+// that was created or deleted and the values of sensitive fields.
+func changes(before, after interface{}) []data.Change {
+	all := data.Diff(before, after)
+
+	res := make([]data.Change, 0, len(all))
+	for _, change := range all {
+		if isZero(change.Old) && isZero(change.New) {
+			continue
+		}
+
+		if sensitiveFields[change.Field] {
+			change.Old, change.New = redacted, redacted
+		}
+		res = append(res, change)
+	}
+
+	return res
+}
+
+func isZero(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
@@ -2,7 +2,7 @@ package auth
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,7 +10,7 @@ import (
 	"time"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/config"
-	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
@@ -21,6 +21,10 @@ type Authenticator struct {
 	Audience string
 	ClientID string
 	Domain   string
+
+	// issuer is set when the API issues its own tokens instead of trusting
+	// Auth0.
+	issuer *Issuer
 }
 
 type CustomClaims struct {
@@ -34,6 +38,15 @@ func (c CustomClaims) Validate(ctx context.Context) error {
 }
 
 func New(env config.Env) (*Authenticator, error) {
+	if env.IdentityProvider == "local" {
+		issuer, err := NewIssuer(env.JWT)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewWithIssuer(issuer), nil
+	}
+
 	return &Authenticator{
 		Domain:   env.Auth0.App.Domain,
 		ClientID: env.Auth0.App.ClientID,
@@ -41,8 +54,23 @@ func New(env config.Env) (*Authenticator, error) {
 	}, nil
 }
 
-// func (a *Authenticator) Middleware() func(next http.Handler) http.Handler {
-func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+// NewWithIssuer returns an authenticator accepting the tokens of issuer only.
+func NewWithIssuer(issuer *Issuer) *Authenticator {
+	return &Authenticator{Audience: issuer.Audience, issuer: issuer}
+}
+
+// Issuer returns the token issuer, or nil when tokens are issued by Auth0.
+func (a *Authenticator) Issuer() *Issuer {
+	return a.issuer
+}
+
+// keyFunc returns where the keys tokens are validated with come from and the
+// expected issuer.
+func (a *Authenticator) keyFunc() (func(context.Context) (interface{}, error), string) {
+	if a.issuer != nil {
+		return a.issuer.KeyFunc, a.issuer.Issuer
+	}
+
 	issuerURL, err := url.Parse("https://" + a.Domain + "/")
 	fmt.Println("EnsureValidToken", issuerURL)
 	if err != nil {
@@ -50,11 +78,17 @@ func (a *Authenticator) Middleware() echo.MiddlewareFunc {
 	}
 
 	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+	return provider.KeyFunc, issuerURL.String()
+}
+
+// func (a *Authenticator) Middleware() func(next http.Handler) http.Handler {
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+	keyFunc, issuer := a.keyFunc()
 
 	jwtValidator, err := validator.New(
-		provider.KeyFunc,
+		keyFunc,
 		validator.RS256,
-		issuerURL.String(),
+		issuer,
 		[]string{a.Audience},
 		validator.WithCustomClaims(
 			func() validator.CustomClaims {
@@ -70,9 +104,10 @@ func (a *Authenticator) Middleware() echo.MiddlewareFunc {
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
 		log.Printf("Encountered error while validating JWT: %v", err)
 
+		problem := apperror.Unauthorized("Failed to validate JWT.").Problem(w.Header().Get(echo.HeaderXRequestID))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"message":"Failed to validate JWT."}`))
+		json.NewEncoder(w).Encode(problem)
 	}
 
 	middleware := jwtmiddleware.New(
@@ -91,22 +126,18 @@ func (a *Authenticator) Middleware() echo.MiddlewareFunc {
 func (a *Authenticator) HasRoles(permissions []string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			userToken := c.Request().Context().Value(jwtmiddleware.ContextKey{})
-
-			claims, ok := userToken.(*validator.ValidatedClaims)
-			if !ok {
-				c.Error(errors.New("could not read JWT claims"))
+			subject, err := SubjectFromContext(c)
+			if err != nil {
+				return apperror.Unauthorized(err.Error())
 			}
 
-			roles := claims.CustomClaims.(*CustomClaims).Roles
-
 			for _, permission := range permissions {
-				if utils.Contains(roles, permission) {
+				if subject.HasRole(permission) {
 					return next(c)
 				}
 			}
 
-			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "You do not have permission to access this resource"})
+			return apperror.Forbidden("You do not have permission to access this resource")
 		}
 	}
 }
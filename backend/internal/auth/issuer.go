@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	jose "gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/config"
+)
+
+// Issuer signs the API's own access tokens when it isn't using Auth0. Tokens
+// carry the same custom claims as the Auth0 ones so HasRoles and the project
+// policy work the same with either.
+type Issuer struct {
+	Issuer    string
+	Audience  string
+	AccessTTL time.Duration
+
+	signer jose.Signer
+	// keys holds the public part of the signing key followed by the previous
+	// keys, which are still accepted until they are removed from the config.
+	keys jose.JSONWebKeySet
+}
+
+// NewIssuer loads the signing key and the previous keys from the PEM files
+// named in the config. Without a signing key file an ephemeral key is
+// generated, so tokens don't survive a restart.
+func NewIssuer(cfg config.JWTConfig) (*Issuer, error) {
+	var key *rsa.PrivateKey
+	var err error
+	if cfg.SigningKeyFile == "" {
+		fmt.Println("JWT_SIGNING_KEY_FILE is not set, using an ephemeral signing key")
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = loadRSAKey(cfg.SigningKeyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := publicJWK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: current.KeyID, Algorithm: current.Algorithm}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &Issuer{
+		Issuer:    cfg.Issuer,
+		Audience:  cfg.Audience,
+		AccessTTL: cfg.AccessTokenTTL,
+		signer:    signer,
+		keys:      jose.JSONWebKeySet{Keys: []jose.JSONWebKey{current}},
+	}
+
+	for _, file := range cfg.PreviousKeyFiles {
+		previous, err := loadRSAKey(file)
+		if err != nil {
+			return nil, err
+		}
+
+		jwk, err := publicJWK(previous)
+		if err != nil {
+			return nil, err
+		}
+		issuer.keys.Keys = append(issuer.keys.Keys, jwk)
+	}
+
+	return issuer, nil
+}
+
+// Issue returns a signed access token for the user and when it expires.
+func (i *Issuer) Issue(subject, email string, roles []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(i.AccessTTL)
+
+	token, err := jwt.Signed(i.signer).
+		Claims(jwt.Claims{
+			Issuer:    i.Issuer,
+			Subject:   subject,
+			Audience:  jwt.Audience{i.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Expiry:    jwt.NewNumericDate(expiresAt),
+		}).
+		Claims(CustomClaims{Roles: roles, Email: email}).
+		CompactSerialize()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// JWKS returns the public keys tokens may be signed with.
+func (i *Issuer) JWKS() *jose.JSONWebKeySet {
+	return &i.keys
+}
+
+// KeyFunc is used by the JWT validator, the key of a token is picked from the
+// set by its kid header.
+func (i *Issuer) KeyFunc(ctx context.Context) (interface{}, error) {
+	return &i.keys, nil
+}
+
+func loadRSAKey(file string) (*rsa.PrivateKey, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", file)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", file, errors.New("not an RSA private key"))
+	}
+
+	return key, nil
+}
+
+// publicJWK returns the public half of key, identified by its thumbprint.
+func publicJWK(key *rsa.PrivateKey) (jose.JSONWebKey, error) {
+	jwk := jose.JSONWebKey{Key: &key.PublicKey, Algorithm: string(jose.RS256), Use: "sig"}
+
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return jwk, err
+	}
+
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	return jwk, nil
+}
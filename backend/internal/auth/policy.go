@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// Subject is the authenticated user a request is made on behalf of.
+type Subject struct {
+	ID    string
+	Email string
+	Roles []string
+}
+
+func (s *Subject) HasRole(role string) bool {
+	return utils.Contains(s.Roles, role)
+}
+
+var ErrNoClaims = errors.New("could not read JWT claims")
+
+// SubjectFromContext reads the subject from the claims validated by the
+// Authenticator middleware.
+func SubjectFromContext(c echo.Context) (*Subject, error) {
+	claims, ok := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		return nil, ErrNoClaims
+	}
+
+	custom, ok := claims.CustomClaims.(*CustomClaims)
+	if !ok {
+		return nil, ErrNoClaims
+	}
+
+	return &Subject{
+		ID:    claims.RegisteredClaims.Subject,
+		Email: custom.Email,
+		Roles: custom.Roles,
+	}, nil
+}
+
+type Action string
+
+const (
+	ActionView          Action = "view"
+	ActionUpdate        Action = "update"
+	ActionUpdateMetrics Action = "updateMetrics"
+	ActionComplete      Action = "complete"
+	ActionDelete        Action = "delete"
+)
+
+// Relation is how a subject is related to a project.
+type Relation string
+
+const (
+	RelationNone                 Relation = ""
+	RelationAdmin                Relation = "admin"
+	RelationLead                 Relation = "lead"
+	RelationTeamMember           Relation = "teamMember"
+	RelationClientRepresentative Relation = "clientRepresentative"
+)
+
+// projectPermissions lists the actions each relation allows on a project.
+var projectPermissions = map[Relation][]Action{
+	RelationAdmin:                {ActionView, ActionUpdate, ActionUpdateMetrics, ActionComplete, ActionDelete},
+	RelationLead:                 {ActionView, ActionUpdateMetrics, ActionComplete},
+	RelationTeamMember:           {ActionView},
+	RelationClientRepresentative: {ActionView},
+}
+
+// ProjectPolicy decides what a subject may do with a project.
+type ProjectPolicy struct{}
+
+// Relation returns the strongest relation between the subject and project.
+func (ProjectPolicy) Relation(s *Subject, p *data.Project) Relation {
+	if s.HasRole("admin") {
+		return RelationAdmin
+	}
+
+	if s.HasRole("member") {
+		if p.Team.ProjectLead.ID == s.ID {
+			return RelationLead
+		}
+
+		for _, member := range p.Team.TeamMembers {
+			if member.ID == s.ID {
+				return RelationTeamMember
+			}
+		}
+	}
+
+	if s.HasRole("client") && p.ClientRepresentative.ID == s.ID {
+		return RelationClientRepresentative
+	}
+
+	return RelationNone
+}
+
+// Can reports whether the subject may perform the action on the project. Only
+// admins can still access projects whose access period is over.
+func (pp ProjectPolicy) Can(s *Subject, action Action, p *data.Project) bool {
+	relation := pp.Relation(s, p)
+	if relation != RelationAdmin && p.AccessExpired(time.Now()) {
+		return false
+	}
+
+	return utils.Contains(projectPermissions[relation], action)
+}
+
+// CanChangeStatus reports whether the subject may move the project to the
+// given status, following data.StatusTransitions.
+func (pp ProjectPolicy) CanChangeStatus(s *Subject, p *data.Project, to string) bool {
+	relation := pp.Relation(s, p)
+	if relation != RelationAdmin && p.AccessExpired(time.Now()) {
+		return false
+	}
+
+	transition, ok := data.FindTransition(p.Status, to)
+	return ok && utils.Contains(transition.Roles, string(relation))
+}
+
+// ListFilter returns the filter matching the projects the subject may view.
+// ok is false when the subject can't view any project.
+func (ProjectPolicy) ListFilter(s *Subject) (filter bson.M, ok bool) {
+	if s.HasRole("admin") {
+		return bson.M{}, true
+	}
+
+	if s.HasRole("member") {
+		return bson.M{
+			"$or": bson.A{
+				bson.M{"team.projectlead.id": s.ID},
+				bson.M{"team.teammembers.id": s.ID},
+			},
+		}, true
+	}
+
+	if s.HasRole("client") {
+		return bson.M{"clientrepresentative.id": s.ID}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+func testProject() *data.Project {
+	project := &data.Project{
+		Team: data.ProjectTeam{
+			ProjectLead: data.Member{ID: "lead"},
+			TeamMembers: []data.Member{{ID: "member-1"}, {ID: "member-2"}},
+		},
+	}
+	project.ClientRepresentative.ID = "client"
+	return project
+}
+
+func TestProjectPolicyCan(t *testing.T) {
+	subjects := map[string]*Subject{
+		"admin":             {ID: "admin", Roles: []string{"admin"}},
+		"lead":              {ID: "lead", Roles: []string{"member"}},
+		"team member":       {ID: "member-2", Roles: []string{"member"}},
+		"other member":      {ID: "other", Roles: []string{"member"}},
+		"client rep":        {ID: "client", Roles: []string{"client"}},
+		"other client":      {ID: "other", Roles: []string{"client"}},
+		"lead without role": {ID: "lead"},
+		"client as member":  {ID: "client", Roles: []string{"member"}},
+	}
+
+	tests := []struct {
+		subject string
+		action  Action
+		want    bool
+	}{
+		{"admin", ActionView, true},
+		{"admin", ActionUpdate, true},
+		{"admin", ActionUpdateMetrics, true},
+		{"admin", ActionComplete, true},
+		{"admin", ActionDelete, true},
+
+		{"lead", ActionView, true},
+		{"lead", ActionUpdate, false},
+		{"lead", ActionUpdateMetrics, true},
+		{"lead", ActionComplete, true},
+		{"lead", ActionDelete, false},
+
+		{"team member", ActionView, true},
+		{"team member", ActionUpdate, false},
+		{"team member", ActionUpdateMetrics, false},
+		{"team member", ActionComplete, false},
+		{"team member", ActionDelete, false},
+
+		{"other member", ActionView, false},
+		{"other member", ActionUpdate, false},
+		{"other member", ActionUpdateMetrics, false},
+		{"other member", ActionComplete, false},
+		{"other member", ActionDelete, false},
+
+		{"client rep", ActionView, true},
+		{"client rep", ActionUpdate, false},
+		{"client rep", ActionUpdateMetrics, false},
+		{"client rep", ActionComplete, false},
+		{"client rep", ActionDelete, false},
+
+		{"other client", ActionView, false},
+		{"other client", ActionUpdate, false},
+		{"other client", ActionUpdateMetrics, false},
+		{"other client", ActionComplete, false},
+		{"other client", ActionDelete, false},
+
+		{"lead without role", ActionView, false},
+		{"lead without role", ActionUpdateMetrics, false},
+		{"lead without role", ActionComplete, false},
+
+		{"client as member", ActionView, false},
+	}
+
+	policy := ProjectPolicy{}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.subject, tt.action), func(t *testing.T) {
+			got := policy.Can(subjects[tt.subject], tt.action, testProject())
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProjectPolicyRelation(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject *Subject
+		want    Relation
+	}{
+		{"admin", &Subject{ID: "lead", Roles: []string{"admin", "member"}}, RelationAdmin},
+		{"lead", &Subject{ID: "lead", Roles: []string{"member"}}, RelationLead},
+		{"team member", &Subject{ID: "member-1", Roles: []string{"member"}}, RelationTeamMember},
+		{"client rep", &Subject{ID: "client", Roles: []string{"client"}}, RelationClientRepresentative},
+		{"unrelated", &Subject{ID: "other", Roles: []string{"member"}}, RelationNone},
+	}
+
+	policy := ProjectPolicy{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Relation(tt.subject, testProject()))
+		})
+	}
+}
+
+func TestProjectPolicyListFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject *Subject
+		want    bson.M
+		ok      bool
+	}{
+		{"admin", &Subject{ID: "a", Roles: []string{"admin"}}, bson.M{}, true},
+		{"member", &Subject{ID: "m", Roles: []string{"member"}}, bson.M{
+			"$or": bson.A{
+				bson.M{"team.projectlead.id": "m"},
+				bson.M{"team.teammembers.id": "m"},
+			},
+		}, true},
+		{"client", &Subject{ID: "c", Roles: []string{"client"}}, bson.M{"clientrepresentative.id": "c"}, true},
+		{"no role", &Subject{ID: "x"}, nil, false},
+	}
+
+	policy := ProjectPolicy{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := policy.ListFilter(tt.subject)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProjectPolicyCanChangeStatus(t *testing.T) {
+	admin := &Subject{ID: "admin", Roles: []string{"admin"}}
+	lead := &Subject{ID: "lead", Roles: []string{"member"}}
+	member := &Subject{ID: "member-1", Roles: []string{"member"}}
+
+	tests := []struct {
+		subject *Subject
+		from    string
+		to      string
+		want    bool
+	}{
+		{admin, data.StatusDraft, data.StatusActive, true},
+		{lead, data.StatusDraft, data.StatusActive, false},
+		{lead, data.StatusActive, data.StatusOnHold, true},
+		{lead, "", data.StatusOnHold, true},
+		{lead, data.StatusOnHold, data.StatusCompleted, true},
+		{lead, data.StatusCompleted, data.StatusActive, false},
+		{admin, data.StatusCompleted, data.StatusActive, true},
+		{admin, data.StatusCompleted, data.StatusArchived, true},
+		{admin, data.StatusDraft, data.StatusCompleted, false},
+		{admin, data.StatusArchived, data.StatusCompleted, false},
+		{member, data.StatusActive, data.StatusOnHold, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %q to %s", tt.subject.ID, tt.from, tt.to), func(t *testing.T) {
+			project := testProject()
+			project.Status = tt.from
+			assert.Equal(t, tt.want, ProjectPolicy{}.CanChangeStatus(tt.subject, project, tt.to))
+		})
+	}
+}
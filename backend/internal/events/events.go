@@ -0,0 +1,99 @@
+// Package events tells the parts of the API that react to changes, like
+// notifications and webhooks, about the changes made to projects and
+// benchmarks.
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+type Type string
+
+const (
+	ProjectCreated Type = "project.created"
+	// ProjectUpdated is published with the project as it was in Before.
+	ProjectUpdated Type = "project.updated"
+	MetricsUpdated Type = "metrics.updated"
+	// StatusChanged is published with the change in Status.
+	StatusChanged Type = "project.status.changed"
+	// BenchmarkChanged is published with the benchmark and the Action made
+	// to it. Deleted benchmarks are published as they were.
+	BenchmarkChanged Type = "benchmark.changed"
+)
+
+// Actions of BenchmarkChanged events.
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+)
+
+// Event is a change made to a project or benchmark. Actor is only set when
+// the change says who made it.
+type Event struct {
+	Type      Type               `json:"type"`
+	Project   *data.Project      `json:"project,omitempty"`
+	Before    *data.Project      `json:"before,omitempty"`
+	Status    *data.StatusChange `json:"status,omitempty"`
+	Benchmark *data.Benchmark    `json:"benchmark,omitempty"`
+	Action    string             `json:"action,omitempty"`
+	Actor     data.Member        `json:"actor"`
+	At        time.Time          `json:"at"`
+}
+
+// Handler reacts to an event. It is called on the publisher's goroutine, so it
+// should be quick and must not change the event.
+type Handler func(e Event)
+
+// Bus hands every published event to its subscribers. A nil Bus publishes
+// nothing.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish calls the subscribers in the order they subscribed. A subscriber
+// that panics is logged and doesn't stop the others.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		call(h, e)
+	}
+}
+
+func call(h Handler, e Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Println("error handling event", e.Type, err)
+		}
+	}()
+
+	h(e)
+}
@@ -0,0 +1,126 @@
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// ExpiryNotifier is told about every user to warn that their access to a
+// project ends at expiresAt, it is expected to send them the warning.
+type ExpiryNotifier func(user *data.User, project *data.Project, expiresAt time.Time) error
+
+// Worker periodically archives the completed projects whose access period is
+// over, and warns the lead and client representative of a project before its
+// access period ends.
+type Worker struct {
+	projects   storage.ProjectStorage
+	users      storage.UserStorage
+	warnBefore time.Duration
+	interval   time.Duration
+	notify     ExpiryNotifier
+	done       chan struct{}
+}
+
+func NewWorker(projects storage.ProjectStorage, users storage.UserStorage, warnBefore, interval time.Duration, notify ExpiryNotifier) *Worker {
+	if notify == nil {
+		notify = logExpiryWarning
+	}
+
+	return &Worker{
+		projects:   projects,
+		users:      users,
+		warnBefore: warnBefore,
+		interval:   interval,
+		notify:     notify,
+		done:       make(chan struct{}),
+	}
+}
+
+// logExpiryWarning is the notifier used when none is configured.
+func logExpiryWarning(user *data.User, project *data.Project, expiresAt time.Time) error {
+	fmt.Println("access to", project.Name, "for", user.Email, "expires at", expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// Start runs the worker straight away and then every interval until Close is
+// called.
+func (w *Worker) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			w.Run(time.Now())
+
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *Worker) Close() {
+	close(w.done)
+}
+
+// Run archives the expired projects and sends the warnings due at now.
+func (w *Worker) Run(now time.Time) {
+	archived, err := w.projects.ArchiveExpired(now)
+	if err != nil {
+		fmt.Println("error archiving expired projects", err)
+	}
+	if len(archived) > 0 {
+		fmt.Println("archived", len(archived), "expired projects")
+	}
+
+	expiring, err := w.projects.GetExpiringProjects(now.Add(w.warnBefore))
+	if err != nil {
+		fmt.Println("error reading expiring projects", err)
+		return
+	}
+
+	for _, project := range expiring {
+		w.warn(project, now)
+	}
+}
+
+// warn notifies the lead and client representative of the project. It is
+// marked as warned once at least one of them was notified, so a user that
+// can't be found doesn't hold the others up.
+func (w *Worker) warn(project *data.Project, now time.Time) {
+	expiresAt := project.AccessExpiresAt()
+	warned := false
+
+	for _, id := range []string{project.Team.ProjectLead.ID, project.ClientRepresentative.ID} {
+		if id == "" {
+			continue
+		}
+
+		user, err := w.users.GetById(id)
+		if err != nil {
+			fmt.Println("error reading user", id, "to warn about", project.ID.Hex(), err)
+			continue
+		}
+
+		err = w.notify(user, project, expiresAt)
+		if err != nil {
+			fmt.Println("error warning", user.Email, "about", project.ID.Hex(), err)
+			continue
+		}
+		warned = true
+	}
+
+	if !warned {
+		return
+	}
+
+	err := w.projects.MarkExpiryWarned(project.ID.Hex(), now)
+	if err != nil {
+		fmt.Println("error marking", project.ID.Hex(), "as warned", err)
+	}
+}
@@ -0,0 +1,77 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+func TestWorkerRun(t *testing.T) {
+	users := storage.NewMemoryUserStorage(storage.NewMemoryPreferenceStorage())
+	lead, err := users.Create(&data.User{Type: "member", FullName: "Lead", Email: "lead@example.com"})
+	require.NoError(t, err)
+	client, err := users.Create(&data.User{Type: "client", FullName: "Client", Email: "client@example.com", Organisation: "Org"})
+	require.NoError(t, err)
+
+	projects := storage.NewMemoryProjectStorage(users, nil)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// completed the given number of days ago with 30 days of access
+	create := func(name string, completedDaysAgo int) *data.Project {
+		project := &data.Project{
+			Name:           name,
+			Status:         data.StatusCompleted,
+			CompletionDate: primitive.NewDateTimeFromTime(now.AddDate(0, 0, -completedDaysAgo)),
+			Team:           data.ProjectTeam{ProjectLead: data.Member{ID: lead.ID}},
+		}
+		project.ClientRepresentative.ID = client.ID
+		project.Scope.RemainsAccessibleForNDays = 30
+
+		created, err := projects.CreateProject(project)
+		require.NoError(t, err)
+		return created
+	}
+
+	expired := create("expired", 40)
+	expiring := create("expiring", 25)
+	recent := create("recent", 1)
+
+	warnings := map[string][]string{}
+	var expiresAt time.Time
+	worker := NewWorker(projects, users, 7*24*time.Hour, time.Hour, func(user *data.User, project *data.Project, at time.Time) error {
+		warnings[project.Name] = append(warnings[project.Name], user.Email)
+		expiresAt = at
+		return nil
+	})
+
+	worker.Run(now)
+	worker.Run(now.Add(time.Hour))
+
+	// each warning is only sent once
+	assert.Equal(t, map[string][]string{"expiring": {"lead@example.com", "client@example.com"}}, warnings)
+	assert.Equal(t, now.AddDate(0, 0, 5), expiresAt.UTC())
+
+	archived, err := projects.GetProject(expired.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, data.StatusArchived, archived.Status)
+	assert.NotNil(t, archived.ArchivedAt)
+
+	for _, project := range []*data.Project{expiring, recent} {
+		stored, err := projects.GetProject(project.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, data.StatusCompleted, stored.Status)
+	}
+
+	// extending access warns again before the new end
+	_, err = projects.ExtendAccess(expiring.ID.Hex(), 30, data.Member{ID: "admin"})
+	require.NoError(t, err)
+	worker.Run(now.AddDate(0, 0, 30))
+	assert.Len(t, warnings["expiring"], 4)
+	assert.Equal(t, now.AddDate(0, 0, 35), expiresAt.UTC())
+}
@@ -0,0 +1,182 @@
+// Package notifications emails users about the changes made to their
+// projects. Emails are queued in an outbox by the Notifier and sent by the
+// Sender, so a transport that is down doesn't fail the requests.
+package notifications
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// Notifier turns project events into emails, leaving out the user who made
+// the change and the users who opted out.
+type Notifier struct {
+	storage storage.NotificationStorage
+	users   storage.UserStorage
+	appURL  string
+	// adminEmails are told about the completed projects.
+	adminEmails []string
+}
+
+func NewNotifier(storage storage.NotificationStorage, users storage.UserStorage, appURL string, adminEmails []string) *Notifier {
+	return &Notifier{storage: storage, users: users, appURL: appURL, adminEmails: adminEmails}
+}
+
+// Handle queues the emails about an event, it is meant to be subscribed to the
+// event bus.
+func (n *Notifier) Handle(e events.Event) {
+	project := e.Project
+	if project == nil {
+		return
+	}
+
+	switch e.Type {
+	case events.ProjectCreated:
+		n.notifyUser(data.NotifyLeadAssigned, project.Team.ProjectLead.ID, e)
+	case events.ProjectUpdated:
+		if e.Before != nil && e.Before.Team.ProjectLead.ID != project.Team.ProjectLead.ID {
+			n.notifyUser(data.NotifyLeadAssigned, project.Team.ProjectLead.ID, e)
+		}
+	case events.MetricsUpdated:
+		// clients aren't told about drafts
+		if data.NormalizeStatus(project.Status) != data.StatusDraft {
+			n.notifyUser(data.NotifyMetricsPublished, project.ClientRepresentative.ID, e)
+		}
+	case events.StatusChanged:
+		if e.Status != nil && e.Status.To == data.StatusCompleted {
+			n.notifyAdmins(data.NotifyProjectCompleted, e)
+		}
+	}
+}
+
+// notifyUser emails the user with the given id, if any.
+func (n *Notifier) notifyUser(event data.NotificationEvent, id string, e events.Event) {
+	if id == "" || id == e.Actor.ID {
+		return
+	}
+
+	user, err := n.users.GetById(id)
+	if err != nil {
+		fmt.Println("error reading user", id, "to notify about", e.Type, err)
+		return
+	}
+
+	err = n.enqueue(event, user, templateData{Project: e.Project, Link: n.projectLink(e.Project), Actor: actorName(e.Actor)})
+	if err != nil {
+		fmt.Println("error notifying", user.Email, "about", e.Type, err)
+	}
+}
+
+// notifyAdmins emails the configured admins. Admins that aren't users can't
+// opt out.
+func (n *Notifier) notifyAdmins(event data.NotificationEvent, e events.Event) {
+	for _, email := range n.adminEmails {
+		if strings.EqualFold(email, e.Actor.Email) {
+			continue
+		}
+
+		user := n.findUser(email)
+		if user == nil {
+			user = &data.User{Email: email}
+		}
+		if user.ID != "" && user.ID == e.Actor.ID {
+			continue
+		}
+
+		err := n.enqueue(event, user, templateData{Project: e.Project, Link: n.projectLink(e.Project), Actor: actorName(e.Actor)})
+		if err != nil {
+			fmt.Println("error notifying", email, "about", e.Type, err)
+		}
+	}
+}
+
+// findUser returns the user with the given email, nil when there is none.
+func (n *Notifier) findUser(email string) *data.User {
+	page, err := n.users.Search(email, "", "", 0)
+	if err != nil {
+		fmt.Println("error searching user", email, err)
+		return nil
+	}
+
+	for _, user := range page.Items {
+		if strings.EqualFold(user.Email, email) {
+			return user
+		}
+	}
+	return nil
+}
+
+// AccessExpiring queues the warning that access to a completed project ends,
+// it is the lifecycle.ExpiryNotifier of the API.
+func (n *Notifier) AccessExpiring(user *data.User, project *data.Project, expiresAt time.Time) error {
+	return n.enqueue(data.NotifyAccessExpiring, user, templateData{
+		Project:   project,
+		Link:      n.projectLink(project),
+		ExpiresAt: expiresAt.Format("2 January 2006"),
+	})
+}
+
+// PasswordResetNotifier returns the storage.PasswordResetNotifier queuing the
+// reset links of local users. It doesn't need the user storage, which is
+// created with it.
+func PasswordResetNotifier(notifications storage.NotificationStorage, appURL string) storage.PasswordResetNotifier {
+	n := &Notifier{storage: notifications, appURL: appURL}
+	return func(user *data.User, token string) error {
+		return n.enqueue(data.NotifyPasswordReset, user, templateData{
+			Link: n.appURL + "/reset-password?token=" + url.QueryEscape(token),
+		})
+	}
+}
+
+// enqueue queues the email about event to user, unless they opted out of it.
+func (n *Notifier) enqueue(event data.NotificationEvent, user *data.User, d templateData) error {
+	if user.Email == "" {
+		return fmt.Errorf("user %s has no email", user.ID)
+	}
+
+	if user.ID != "" && !event.Mandatory() {
+		prefs, err := n.storage.GetNotificationPreferences(user.ID)
+		if err != nil {
+			return err
+		}
+		if prefs.OptedOut(event) {
+			return nil
+		}
+	}
+
+	d.Name = user.FullName
+	if d.Name == "" {
+		d.Name = user.Email
+	}
+
+	subject, body, err := render(event, d)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.storage.EnqueueEmail(&data.Email{
+		Event:   event,
+		UserID:  user.ID,
+		To:      user.Email,
+		Subject: subject,
+		Body:    body,
+	})
+	return err
+}
+
+func (n *Notifier) projectLink(project *data.Project) string {
+	return n.appURL + "/projects/" + project.ID.Hex()
+}
+
+func actorName(actor data.Member) string {
+	if actor.FullName != "" {
+		return actor.FullName
+	}
+	return actor.Email
+}
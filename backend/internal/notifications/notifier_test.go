@@ -0,0 +1,154 @@
+package notifications
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+func TestNotifierHandle(t *testing.T) {
+	users := storage.NewMemoryUserStorage(storage.NewMemoryPreferenceStorage())
+	lead, err := users.Create(&data.User{Type: "member", FullName: "Lead", Email: "lead@example.com"})
+	require.NoError(t, err)
+	other, err := users.Create(&data.User{Type: "member", FullName: "Other", Email: "other@example.com"})
+	require.NoError(t, err)
+	client, err := users.Create(&data.User{Type: "client", FullName: "Client", Email: "client@example.com", Organisation: "Org"})
+	require.NoError(t, err)
+	admin, err := users.Create(&data.User{Type: "member", FullName: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+
+	outbox := storage.NewMemoryNotificationStorage()
+	notifier := NewNotifier(outbox, users, "https://app.example.com", []string{"admin@example.com", "ops@example.com"})
+
+	project := &data.Project{Name: "Alpha", Client: "Acme", Status: data.StatusActive, MetricsVersion: 3}
+	project.Team.ProjectLead.ID = lead.ID
+	project.ClientRepresentative.ID = client.ID
+	actor := data.Member{ID: "someone", FullName: "Someone"}
+
+	notifier.Handle(events.Event{Type: events.ProjectCreated, Project: project, Actor: actor})
+
+	reassigned := *project
+	reassigned.Team.ProjectLead.ID = other.ID
+	notifier.Handle(events.Event{Type: events.ProjectUpdated, Project: &reassigned, Before: project, Actor: actor})
+	// the lead didn't change
+	notifier.Handle(events.Event{Type: events.ProjectUpdated, Project: &reassigned, Before: &reassigned, Actor: actor})
+	// the actor isn't told about their own changes
+	notifier.Handle(events.Event{Type: events.ProjectCreated, Project: project, Actor: data.Member{ID: lead.ID}})
+
+	notifier.Handle(events.Event{Type: events.MetricsUpdated, Project: project, Actor: actor})
+	draft := *project
+	draft.Status = data.StatusDraft
+	notifier.Handle(events.Event{Type: events.MetricsUpdated, Project: &draft, Actor: actor})
+
+	notifier.Handle(events.Event{Type: events.StatusChanged, Project: project, Actor: actor, Status: &data.StatusChange{To: data.StatusCompleted}})
+	notifier.Handle(events.Event{Type: events.StatusChanged, Project: project, Actor: actor, Status: &data.StatusChange{To: data.StatusOnHold}})
+
+	sent := map[data.NotificationEvent][]string{}
+	for _, email := range outbox.Emails() {
+		sent[email.Event] = append(sent[email.Event], email.To)
+		assert.Equal(t, data.EmailPending, email.Status)
+	}
+	assert.Equal(t, map[data.NotificationEvent][]string{
+		data.NotifyLeadAssigned:     {"lead@example.com", "other@example.com"},
+		data.NotifyMetricsPublished: {"client@example.com"},
+		data.NotifyProjectCompleted: {"admin@example.com", "ops@example.com"},
+	}, sent)
+
+	email := outbox.Emails()[0]
+	assert.Equal(t, lead.ID, email.UserID)
+	assert.Equal(t, "You are the lead of Alpha", email.Subject)
+	assert.Contains(t, email.Body, "Hi Lead,")
+	assert.Contains(t, email.Body, "assigned by Someone")
+	assert.Contains(t, email.Body, "https://app.example.com/projects/"+project.ID.Hex())
+
+	// opted out users aren't emailed
+	_, err = outbox.UpdateNotificationPreferences(&data.NotificationPreferences{UserID: admin.ID, OptOut: []data.NotificationEvent{data.NotifyProjectCompleted}})
+	require.NoError(t, err)
+	count := len(outbox.Emails())
+	notifier.Handle(events.Event{Type: events.StatusChanged, Project: project, Actor: actor, Status: &data.StatusChange{To: data.StatusCompleted}})
+	require.Len(t, outbox.Emails(), count+1)
+	assert.Equal(t, "ops@example.com", outbox.Emails()[count].To)
+}
+
+func TestPasswordResetIsMandatory(t *testing.T) {
+	outbox := storage.NewMemoryNotificationStorage()
+	_, err := outbox.UpdateNotificationPreferences(&data.NotificationPreferences{UserID: "user-1", OptOut: []data.NotificationEvent{data.NotifyPasswordReset}})
+	require.NoError(t, err)
+
+	notify := PasswordResetNotifier(outbox, "https://app.example.com")
+	require.NoError(t, notify(&data.User{ID: "user-1", Email: "user@example.com"}, "a token"))
+
+	emails := outbox.Emails()
+	require.Len(t, emails, 1)
+	assert.Contains(t, emails[0].Body, "https://app.example.com/reset-password?token=a+token")
+
+	// the link isn't kept once sent
+	transport := &fakeTransport{}
+	assert.Equal(t, 1, NewSender(outbox, transport, time.Minute).Run(time.Now()))
+	assert.Equal(t, []string{"user@example.com"}, transport.sent)
+	assert.Empty(t, outbox.Emails()[0].Body)
+}
+
+type fakeTransport struct {
+	fail bool
+	sent []string
+}
+
+func (t *fakeTransport) Send(email *data.Email) error {
+	if t.fail {
+		return errors.New("unavailable")
+	}
+	t.sent = append(t.sent, email.To)
+	return nil
+}
+
+func TestSenderRetries(t *testing.T) {
+	outbox := storage.NewMemoryNotificationStorage()
+	_, err := outbox.EnqueueEmail(&data.Email{To: "user@example.com", Subject: "Hello"})
+	require.NoError(t, err)
+
+	transport := &fakeTransport{fail: true}
+	sender := NewSender(outbox, transport, time.Minute)
+	now := time.Now()
+
+	assert.Equal(t, 0, sender.Run(now))
+	email := outbox.Emails()[0]
+	assert.Equal(t, 1, email.Attempts)
+	assert.Equal(t, "unavailable", email.LastError)
+	assert.Equal(t, data.EmailPending, email.Status)
+
+	// not due before the backoff
+	assert.Equal(t, 0, sender.Run(now.Add(30*time.Second)))
+	assert.Equal(t, 1, outbox.Emails()[0].Attempts)
+
+	transport.fail = false
+	assert.Equal(t, 1, sender.Run(now.Add(time.Minute)))
+	email = outbox.Emails()[0]
+	assert.Equal(t, data.EmailSent, email.Status)
+	assert.NotNil(t, email.SentAt)
+	assert.Equal(t, []string{"user@example.com"}, transport.sent)
+}
+
+func TestSenderGivesUp(t *testing.T) {
+	outbox := storage.NewMemoryNotificationStorage()
+	_, err := outbox.EnqueueEmail(&data.Email{To: "user@example.com", Subject: "Hello"})
+	require.NoError(t, err)
+
+	sender := NewSender(outbox, &fakeTransport{fail: true}, time.Minute)
+	now := time.Now()
+	for i := 0; i < maxAttempts; i++ {
+		sender.Run(now)
+		now = now.Add(retryBackoff << i)
+	}
+
+	email := outbox.Emails()[0]
+	assert.Equal(t, maxAttempts, email.Attempts)
+	assert.Equal(t, data.EmailFailed, email.Status)
+}
@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+const (
+	// sendLease is how long an email being sent is hidden from other senders.
+	sendLease = 5 * time.Minute
+	// maxAttempts is the number of sends after which an email is given up on.
+	maxAttempts = 6
+	// retryBackoff is the wait before the first retry, it doubles with every
+	// failed attempt.
+	retryBackoff = time.Minute
+)
+
+// Sender periodically sends the due emails of the outbox, retrying the failed
+// ones with an exponential backoff.
+type Sender struct {
+	storage   storage.NotificationStorage
+	transport Transport
+	interval  time.Duration
+	done      chan struct{}
+}
+
+func NewSender(storage storage.NotificationStorage, transport Transport, interval time.Duration) *Sender {
+	return &Sender{
+		storage:   storage,
+		transport: transport,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the sender straight away and then every interval until Close is
+// called.
+func (s *Sender) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.Run(time.Now())
+
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Sender) Close() {
+	close(s.done)
+}
+
+// Run sends the emails due at now and returns how many were sent.
+func (s *Sender) Run(now time.Time) int {
+	sent := 0
+	for {
+		email, err := s.storage.ClaimDueEmail(now, sendLease)
+		if err != nil {
+			fmt.Println("error reading the email outbox", err)
+			return sent
+		}
+		if email == nil {
+			return sent
+		}
+
+		err = s.transport.Send(email)
+		if err == nil {
+			sent++
+			err = s.storage.MarkEmailSent(email.ID, now)
+			if err != nil {
+				fmt.Println("error marking email", email.ID.Hex(), "as sent", err)
+			}
+			continue
+		}
+
+		var retryAt *time.Time
+		if attempts := email.Attempts + 1; attempts < maxAttempts {
+			at := now.Add(retryBackoff << (attempts - 1))
+			retryAt = &at
+		} else {
+			fmt.Println("giving up on email", email.ID.Hex(), "to", email.To, err)
+		}
+
+		err = s.storage.MarkEmailFailed(email.ID, err.Error(), retryAt)
+		if err != nil {
+			fmt.Println("error marking email", email.ID.Hex(), "as failed", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+// templateData is the data the templates are executed with.
+type templateData struct {
+	// Name is the full name of the recipient.
+	Name    string
+	Project *data.Project
+	// Link points to the page of the app the email is about.
+	Link string
+	// Actor is the name of the user who made the change.
+	Actor     string
+	ExpiresAt string
+}
+
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newTemplate(event data.NotificationEvent, subject, body string) emailTemplate {
+	return emailTemplate{
+		subject: template.Must(template.New(string(event) + "-subject").Parse(subject)),
+		body:    template.Must(template.New(string(event) + "-body").Parse(body)),
+	}
+}
+
+var templates = map[data.NotificationEvent]emailTemplate{
+	data.NotifyLeadAssigned: newTemplate(data.NotifyLeadAssigned,
+		`You are the lead of {{.Project.Name}}`,
+		`Hi {{.Name}},
+
+You are now the project lead of {{.Project.Name}} for {{.Project.Client}}{{if .Actor}}, assigned by {{.Actor}}{{end}}.
+
+{{.Link}}
+`),
+	data.NotifyMetricsPublished: newTemplate(data.NotifyMetricsPublished,
+		`New metrics for {{.Project.Name}}`,
+		`Hi {{.Name}},
+
+The metrics of {{.Project.Name}} were updated (version {{.Project.MetricsVersion}}).
+
+{{.Link}}
+`),
+	data.NotifyProjectCompleted: newTemplate(data.NotifyProjectCompleted,
+		`{{.Project.Name}} is completed`,
+		`Hi {{.Name}},
+
+{{.Project.Name}} for {{.Project.Client}} was marked as completed{{if .Actor}} by {{.Actor}}{{end}}.
+
+{{.Link}}
+`),
+	data.NotifyAccessExpiring: newTemplate(data.NotifyAccessExpiring,
+		`Your access to {{.Project.Name}} ends on {{.ExpiresAt}}`,
+		`Hi {{.Name}},
+
+{{.Project.Name}} is completed and your access to it ends on {{.ExpiresAt}}. Download anything you need to keep before then, or ask an administrator to extend the access.
+
+{{.Link}}
+`),
+	data.NotifyPasswordReset: newTemplate(data.NotifyPasswordReset,
+		`Reset your password`,
+		`Hi {{.Name}},
+
+A password reset was requested for your account. Follow this link to choose a new password:
+
+{{.Link}}
+
+If you didn't ask for it, you can ignore this email.
+`),
+}
+
+// render returns the subject and body of the email about event.
+func render(event data.NotificationEvent, d templateData) (string, string, error) {
+	t, ok := templates[event]
+	if !ok {
+		return "", "", fmt.Errorf("no template for %s emails", event)
+	}
+
+	var subject, body bytes.Buffer
+	err := t.subject.Execute(&subject, d)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = t.body.Execute(&body, d)
+	if err != nil {
+		return "", "", err
+	}
+
+	return subject.String(), body.String(), nil
+}
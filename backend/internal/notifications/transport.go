@@ -0,0 +1,140 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ses"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/config"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+// Transport delivers emails.
+type Transport interface {
+	Send(email *data.Email) error
+}
+
+// NewTransport returns the transport selected by the config, the log one when
+// none is.
+func NewTransport(cfg config.NotificationsConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "", "log":
+		return LogTransport{}, nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("the file email transport needs a directory")
+		}
+		return &FileTransport{Dir: cfg.Dir, From: cfg.From}, nil
+	case "smtp":
+		return &SMTPTransport{Host: cfg.SMTP.Host, Port: cfg.SMTP.Port, Username: cfg.SMTP.Username, Password: cfg.SMTP.Password, From: cfg.From}, nil
+	case "ses":
+		return NewSESTransport(cfg.SESRegion, cfg.From)
+	}
+
+	return nil, fmt.Errorf("unknown email transport %q", cfg.Transport)
+}
+
+// LogTransport prints emails instead of sending them, for running locally.
+// The body of password reset emails isn't printed, the reset link in it would
+// let anyone reading the logs take the account over.
+type LogTransport struct{}
+
+func (LogTransport) Send(email *data.Email) error {
+	fmt.Println("email to", email.To, "subject", email.Subject)
+	if email.Event == data.NotifyPasswordReset {
+		fmt.Println("(password reset link withheld)")
+		return nil
+	}
+
+	fmt.Println(email.Body)
+	return nil
+}
+
+// FileTransport writes every email to an .eml file of Dir, for running
+// locally.
+type FileTransport struct {
+	Dir  string
+	From string
+}
+
+func (t *FileTransport) Send(email *data.Email) error {
+	err := os.MkdirAll(t.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), email.ID.Hex())
+	return os.WriteFile(filepath.Join(t.Dir, name), message(t.From, email), 0o644)
+}
+
+// SMTPTransport sends emails through an SMTP server, authenticating when
+// Username is set.
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (t *SMTPTransport) Send(email *data.Email) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	return smtp.SendMail(addr, auth, t.From, []string{email.To}, message(t.From, email))
+}
+
+// SESTransport sends emails with Amazon SES, with the credentials of the
+// environment.
+type SESTransport struct {
+	client *ses.SES
+	from   string
+}
+
+func NewSESTransport(region, from string) (*SESTransport, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SESTransport{client: ses.New(sess), from: from}, nil
+}
+
+func (t *SESTransport) Send(email *data.Email) error {
+	_, err := t.client.SendEmail(&ses.SendEmailInput{
+		Source:      aws.String(t.from),
+		Destination: &ses.Destination{ToAddresses: []*string{aws.String(email.To)}},
+		Message: &ses.Message{
+			Subject: &ses.Content{Charset: aws.String("UTF-8"), Data: aws.String(email.Subject)},
+			Body:    &ses.Body{Text: &ses.Content{Charset: aws.String("UTF-8"), Data: aws.String(email.Body)}},
+		},
+	})
+	return err
+}
+
+// message formats a plain text email.
+func message(from string, email *data.Email) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(email.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,166 @@
+package redaction
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/auth"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// DefaultHidden lists the metrics sections each relation can't see unless the
+// project opts them in.
+var DefaultHidden = map[auth.Relation][]data.MetricsSection{
+	auth.RelationClientRepresentative: {
+		data.SectionCommercialInformation,
+		data.SectionKeyRiskScores,
+	},
+}
+
+// HiddenSections returns the sections of the project's metrics that must be
+// hidden from a subject with the given relation to it.
+func HiddenSections(relation auth.Relation, project *data.Project) []data.MetricsSection {
+	hidden := []data.MetricsSection{}
+	for _, section := range DefaultHidden[relation] {
+		if relation == auth.RelationClientRepresentative && utils.Contains(project.ClientVisibleSections, section) {
+			continue
+		}
+		hidden = append(hidden, section)
+	}
+
+	return hidden
+}
+
+// Metrics masks the given sections of m in place. Sections are reset to their
+// zero value rather than removed so the response keeps its shape.
+func Metrics(m *data.Metrics, sections []data.MetricsSection) {
+	if m == nil {
+		return
+	}
+
+	for _, section := range sections {
+		switch section {
+		case data.SectionProgressToDate:
+			m.ProgressToDate = data.ProgressToDate{}
+		case data.SectionAnticipatedCompletionDate:
+			m.AnticipatedCompletionDate = data.AnticipatedCompletionDate{}
+		case data.SectionCommercialInformation:
+			m.CommercialInformation = data.CommercialInformation{}
+		case data.SectionOptionOutturnCosts:
+			m.OptionOutturnCosts = []data.OptionOutturnCost{}
+		case data.SectionTotalProjectCostPerMilestone:
+			m.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{}
+		case data.SectionKeyCostDrivers:
+			m.KeyCostDriversBaseValue = 0
+			m.KeyCostDrivers = []data.KeyCostDriver{}
+		case data.SectionKeyRisks:
+			m.KeyRisks = []data.KeyRisk{}
+		case data.SectionKeyRiskScores:
+			for i := range m.KeyRisks {
+				m.KeyRisks[i].Score = ""
+			}
+		case data.SectionValueManagementOpportunities:
+			m.ValueManagementOpportunities = []string{}
+		case data.SectionDesignPackages:
+			m.DesignPackages = nil
+		case data.SectionPackages:
+			m.Packages = [][]data.Package{}
+		case data.SectionBenchmarking:
+			m.Benchmarking = data.Benchmarking{}
+		}
+	}
+}
+
+// KPIs drops the KPIs derived from the given sections.
+func KPIs(k *analytics.KPIs, sections []data.MetricsSection) {
+	if k == nil {
+		return
+	}
+
+	for _, section := range sections {
+		switch section {
+		case data.SectionCommercialInformation:
+			k.Fee = nil
+		case data.SectionTotalProjectCostPerMilestone:
+			k.Cost = nil
+		case data.SectionProgressToDate:
+			k.Progress = nil
+		case data.SectionAnticipatedCompletionDate:
+			k.Schedule = nil
+		}
+	}
+}
+
+// BenchmarkComparison anonymises, for client representatives, the benchmarks
+// whose name the project doesn't display.
+func BenchmarkComparison(c *analytics.BenchmarkComparison, relation auth.Relation) {
+	if relation != auth.RelationClientRepresentative {
+		return
+	}
+
+	for i, benchmark := range c.Benchmarks {
+		if !benchmark.DisplayName {
+			benchmark.ID = primitive.NilObjectID
+			benchmark.Name = fmt.Sprintf("Benchmark %d", i+1)
+		}
+	}
+}
+
+// Milestone masks the parts of a milestone that belong to the given sections.
+func Milestone(m *data.Milestone, sections []data.MetricsSection) {
+	if utils.Contains(sections, data.SectionTotalProjectCostPerMilestone) {
+		m.Cost = data.MilestoneCost{}
+	}
+	if utils.Contains(sections, data.SectionPackages) {
+		m.Packages = []data.Package{}
+	}
+}
+
+// Project masks the metrics of project for the given relation and returns the
+// sections that were hidden.
+func Project(project *data.Project, relation auth.Relation) []data.MetricsSection {
+	hidden := HiddenSections(relation, project)
+	Metrics(&project.Metrics, hidden)
+	return hidden
+}
+
+// Changes drops the changes to fields of the given sections. Fields may be
+// relative to the metrics or to the project, e.g. "keyRisks[0].score" or
+// "metrics.keyRisks[0].score".
+func Changes(changes []data.Change, sections []data.MetricsSection) []data.Change {
+	if len(sections) == 0 {
+		return changes
+	}
+
+	res := make([]data.Change, 0, len(changes))
+	for _, change := range changes {
+		if !hidden(sections, change.Field) {
+			res = append(res, change)
+		}
+	}
+
+	return res
+}
+
+// hidden reports whether a field path belongs to one of the sections.
+func hidden(sections []data.MetricsSection, field string) bool {
+	field = strings.TrimPrefix(field, "metrics.")
+	name, rest, _ := strings.Cut(field, ".")
+	name, _, _ = strings.Cut(name, "[")
+
+	section := data.MetricsSection(name)
+	switch {
+	case name == "keyCostDriversBaseValue":
+		section = data.SectionKeyCostDrivers
+	case section == data.SectionKeyRisks && rest == "score":
+		if utils.Contains(sections, data.SectionKeyRiskScores) {
+			return true
+		}
+	}
+
+	return utils.Contains(sections, section)
+}
@@ -0,0 +1,383 @@
+// Package report renders the client-facing PDF report of a project.
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// Report is what goes into the PDF of a project. The project must already be
+// redacted for the reader, the sections in Hidden are left out of the report.
+type Report struct {
+	Project *data.Project
+	Hidden  []data.MetricsSection
+	KPIs    *analytics.KPIs
+	// Milestones of the project by planned date, they decide which cost is
+	// current.
+	Milestones []*data.Milestone
+	// Benchmarks is nil when the project isn't benchmarked.
+	Benchmarks  *analytics.BenchmarkComparison
+	GeneratedAt time.Time
+}
+
+const (
+	pageWidth   = 210.0
+	margin      = 15.0
+	lineHeight  = 6.0
+	dateLayout  = "2 Jan 2006"
+	stampLayout = "2 Jan 2006 15:04 MST"
+)
+
+var workstreamLabels = map[string]string{
+	analytics.WorkstreamQuantification:              "Quantification",
+	analytics.WorkstreamCostEstimation:              "Cost estimation",
+	analytics.WorkstreamProbabilisticRiskAssessment: "Probabilistic risk assessment",
+	analytics.WorkstreamBasisOfEstimateReport:       "Basis of estimate report",
+}
+
+var metricLabels = map[string]string{
+	analytics.MetricTotalProjectCostP90:                      "Total project cost (P90)",
+	analytics.MetricTotalConstructionCostPerLaneKm:           "Construction cost per lane km",
+	analytics.MetricCubicMetreRateForEarthworksPerM3:         "Earthworks rate per m3",
+	analytics.MetricSquareMetreRateForPavementPerBridgePerM2: "Pavement/bridge rate per m2",
+}
+
+// writer wraps the PDF with the layout helpers of the report.
+type writer struct {
+	pdf *fpdf.Fpdf
+	// tr translates UTF-8 text to the encoding of the core fonts.
+	tr func(string) string
+}
+
+// Write renders the report as a PDF.
+func Write(w io.Writer, r *Report) error {
+	pdf := render(r)
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+
+	return pdf.Output(w)
+}
+
+func render(r *Report) *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+5)
+	pdf.SetTitle(r.Project.Name, true)
+	pdf.SetCreator("Project Dashboard", true)
+	pdf.SetCreationDate(r.GeneratedAt)
+	pdf.AliasNbPages("")
+
+	p := &writer{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	stamp := fmt.Sprintf("Generated %s - metrics version %d", r.GeneratedAt.UTC().Format(stampLayout), r.Project.MetricsVersion)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 5, p.tr(stamp), "", 0, "L", false, 0, "")
+		pdf.SetX(margin)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	p.header(r, stamp)
+	if !r.hidden(data.SectionProgressToDate) {
+		p.progress(r)
+	}
+	if !r.hidden(data.SectionAnticipatedCompletionDate) {
+		p.completion(r)
+	}
+	if !r.hidden(data.SectionTotalProjectCostPerMilestone) {
+		p.outturnCost(r)
+	}
+	if !r.hidden(data.SectionKeyCostDrivers) {
+		p.costDrivers(r)
+	}
+	if !r.hidden(data.SectionKeyRisks) {
+		p.risks(r)
+	}
+	if !r.hidden(data.SectionValueManagementOpportunities) {
+		p.opportunities(r)
+	}
+	if !r.hidden(data.SectionBenchmarking) && r.Benchmarks != nil {
+		p.benchmarks(r)
+	}
+
+	return pdf
+}
+
+func (r *Report) hidden(section data.MetricsSection) bool {
+	return utils.Contains(r.Hidden, section)
+}
+
+func (p *writer) header(r *Report, stamp string) {
+	project := r.Project
+	p.pdf.SetFont("Helvetica", "B", 18)
+	p.pdf.MultiCell(0, 9, p.tr(project.Name), "", "L", false)
+	p.pdf.SetFont("Helvetica", "", 9)
+	p.pdf.SetTextColor(120, 120, 120)
+	p.pdf.CellFormat(0, 5, p.tr(stamp), "", 1, "L", false, 0, "")
+	p.pdf.SetTextColor(0, 0, 0)
+	p.pdf.Ln(3)
+
+	rows := [][]string{
+		{"Client", project.Client},
+		{"Region", project.Region},
+		{"CI project number", project.CIProjectNumber},
+		{"Client project number", project.ClientProjectNumber},
+		{"Client representative", project.ClientRepresentative.FullName},
+		{"Project lead", project.Team.ProjectLead.FullName},
+		{"Status", data.NormalizeStatus(project.Status)},
+		{"Start date", date(project.StartDate.Time())},
+		{"Estimated completion", date(project.Scope.EstimatedCompletionDate.Time())},
+	}
+	p.table(nil, []float64{55, 125}, "LL", rows)
+}
+
+func (p *writer) progress(r *Report) {
+	p.heading("Progress to date")
+	if r.KPIs == nil || r.KPIs.Progress == nil {
+		p.empty("No workstream is in scope.")
+		return
+	}
+
+	rows := [][]string{}
+	for _, w := range []string{analytics.WorkstreamQuantification, analytics.WorkstreamCostEstimation, analytics.WorkstreamProbabilisticRiskAssessment, analytics.WorkstreamBasisOfEstimateReport} {
+		if progress, ok := r.KPIs.Progress.Workstreams[w]; ok {
+			rows = append(rows, []string{workstreamLabels[w], strconv.Itoa(progress) + "%"})
+		}
+	}
+	rows = append(rows, []string{"Overall", number(r.KPIs.Progress.PercentComplete) + "%"})
+	p.table([]string{"Workstream", "Progress"}, []float64{130, 50}, "LR", rows)
+}
+
+func (p *writer) completion(r *Report) {
+	p.heading("Anticipated completion dates")
+	if r.KPIs == nil || r.KPIs.Schedule == nil {
+		p.empty("No anticipated completion date has been set.")
+		return
+	}
+
+	rows := [][]string{}
+	for _, w := range r.KPIs.Schedule.Workstreams {
+		rows = append(rows, []string{workstreamLabels[w.Workstream], date(w.AnticipatedCompletionDate.Time()), variance(w.VarianceDays)})
+	}
+	p.table([]string{"Workstream", "Anticipated completion", "Against estimate"}, []float64{80, 50, 50}, "LLR", rows)
+}
+
+func (p *writer) outturnCost(r *Report) {
+	p.heading("Outturn cost per milestone")
+	costs := r.Project.Metrics.TotalProjectCostPerMilestone
+	if len(costs) == 0 {
+		p.empty("No milestone cost has been recorded.")
+		return
+	}
+
+	current := data.CurrentCostRow(r.Milestones, costs)
+	rows := [][]string{}
+	for i := range costs {
+		cost := &costs[i]
+		name := cost.LevelOfDesign
+		if i == current {
+			name += " (current)"
+		}
+		rows = append(rows, []string{name, date(cost.Date.Time()), money(cost.BaseValue), money(cost.P50OutturnCost), money(cost.P90OutturnCost)})
+	}
+	p.table([]string{"Level of design", "Date", "Base value", "P50 outturn", "P90 outturn"}, []float64{48, 27, 35, 35, 35}, "LLRRR", rows)
+}
+
+func (p *writer) costDrivers(r *Report) {
+	p.heading("Key cost drivers")
+	metrics := &r.Project.Metrics
+	if len(metrics.KeyCostDrivers) == 0 {
+		p.empty("No key cost driver has been recorded.")
+		return
+	}
+
+	rows := [][]string{}
+	for _, driver := range metrics.KeyCostDrivers {
+		share := ""
+		if metrics.KeyCostDriversBaseValue > 0 {
+			share = number(driver.Cost/metrics.KeyCostDriversBaseValue*100) + "%"
+		}
+		rows = append(rows, []string{driver.Driver, money(driver.Cost), share})
+	}
+	rows = append(rows, []string{"Base value", money(metrics.KeyCostDriversBaseValue), ""})
+	p.table([]string{"Driver", "Cost", "Share of base"}, []float64{110, 40, 30}, "LRR", rows)
+}
+
+func (p *writer) risks(r *Report) {
+	p.heading("Key risks")
+	risks := r.Project.Metrics.KeyRisks
+	if len(risks) == 0 {
+		p.empty("No key risk has been recorded.")
+		return
+	}
+
+	if r.hidden(data.SectionKeyRiskScores) {
+		rows := [][]string{}
+		for _, risk := range risks {
+			rows = append(rows, []string{risk.Description, risk.Trend})
+		}
+		p.table([]string{"Risk", "Trend"}, []float64{150, 30}, "LL", rows)
+		return
+	}
+
+	rows := [][]string{}
+	for _, risk := range risks {
+		rows = append(rows, []string{risk.Description, risk.Score, risk.Trend})
+	}
+	p.table([]string{"Risk", "Score", "Trend"}, []float64{120, 30, 30}, "LLL", rows)
+}
+
+func (p *writer) opportunities(r *Report) {
+	p.heading("Value management opportunities")
+	opportunities := r.Project.Metrics.ValueManagementOpportunities
+	if len(opportunities) == 0 {
+		p.empty("No value management opportunity has been recorded.")
+		return
+	}
+
+	p.pdf.SetFont("Helvetica", "", 10)
+	for _, opportunity := range opportunities {
+		p.pdf.SetX(margin + 2)
+		p.pdf.CellFormat(5, lineHeight, p.tr("-"), "", 0, "L", false, 0, "")
+		p.pdf.MultiCell(0, lineHeight, p.tr(opportunity), "", "L", false)
+	}
+}
+
+func (p *writer) benchmarks(r *Report) {
+	p.heading("Benchmark position")
+	if len(r.Benchmarks.Metrics) == 0 {
+		p.empty("The project isn't compared with any benchmark.")
+		return
+	}
+
+	rows := [][]string{}
+	for _, m := range r.Benchmarks.Metrics {
+		rows = append(rows, []string{metricLabels[m.Metric], metricValue(m.Metric, m.Value), metricValue(m.Metric, m.Median), number(m.DeltaFromMedianPercent) + "%", number(m.Percentile) + "%", strconv.Itoa(m.Benchmarks)})
+	}
+	p.table([]string{"Metric", "Project", "Median", "From median", "Percentile", "Benchmarks"}, []float64{52, 28, 28, 24, 24, 24}, "LRRRRR", rows)
+
+	names := []string{}
+	for _, b := range r.Benchmarks.Benchmarks {
+		names = append(names, b.Name)
+	}
+	p.pdf.SetFont("Helvetica", "", 9)
+	p.pdf.MultiCell(0, 5, p.tr("Compared with: "+strings.Join(names, ", ")), "", "L", false)
+}
+
+func (p *writer) heading(title string) {
+	p.pdf.Ln(5)
+	// Keep headings with at least a few rows of their section.
+	if p.pdf.GetY() > 297-margin-40 {
+		p.pdf.AddPage()
+	}
+	p.pdf.SetFont("Helvetica", "B", 13)
+	p.pdf.CellFormat(0, 8, p.tr(title), "B", 1, "L", false, 0, "")
+	p.pdf.Ln(2)
+}
+
+func (p *writer) empty(message string) {
+	p.pdf.SetFont("Helvetica", "I", 10)
+	p.pdf.CellFormat(0, lineHeight, p.tr(message), "", 1, "L", false, 0, "")
+}
+
+// table writes rows with a bold header unless headers is nil. aligns holds the
+// alignment of each column, e.g. "LR".
+func (p *writer) table(headers []string, widths []float64, aligns string, rows [][]string) {
+	if headers != nil {
+		p.pdf.SetFont("Helvetica", "B", 10)
+		p.pdf.SetFillColor(235, 235, 235)
+		for i, header := range headers {
+			p.pdf.CellFormat(widths[i], lineHeight+1, p.tr(header), "", 0, aligns[i:i+1], true, 0, "")
+		}
+		p.pdf.Ln(-1)
+	}
+
+	p.pdf.SetFont("Helvetica", "", 10)
+	for _, row := range rows {
+		// Cells are clipped to one line, long text wraps in the first
+		// column only.
+		lines := p.pdf.SplitText(p.tr(row[0]), widths[0]-2)
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		height := float64(len(lines)) * lineHeight
+		if p.pdf.GetY()+height > 297-margin-5 {
+			p.pdf.AddPage()
+		}
+
+		x, y := p.pdf.GetXY()
+		p.pdf.MultiCell(widths[0], lineHeight, strings.Join(lines, "\n"), "", aligns[0:1], false)
+		x += widths[0]
+		for i := 1; i < len(row); i++ {
+			p.pdf.SetXY(x, y)
+			p.pdf.CellFormat(widths[i], lineHeight, p.tr(row[i]), "", 0, aligns[i:i+1], false, 0, "")
+			x += widths[i]
+		}
+		p.pdf.SetXY(margin, y+height)
+		p.pdf.Line(margin, y+height, pageWidth-margin, y+height)
+	}
+}
+
+func date(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return "-"
+	}
+
+	return t.UTC().Format(dateLayout)
+}
+
+// variance describes a number of days late, or early when negative.
+func variance(days int) string {
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d days late", days)
+	case days < 0:
+		return fmt.Sprintf("%d days early", -days)
+	}
+
+	return "on time"
+}
+
+// money formats an amount in whole dollars with thousands separators.
+func money(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	digits := strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+
+	return sign + "$" + digits
+}
+
+// metricValue formats a benchmark metric, costs in whole dollars and rates
+// with cents.
+func metricValue(metric string, v float64) string {
+	if metric == analytics.MetricTotalProjectCostP90 {
+		return money(v)
+	}
+
+	return "$" + strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// number formats v with at most two decimals.
+func number(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+)
+
+func testProject() *data.Project {
+	project := &data.Project{Name: "Pacific Highway Upgrade", Client: "Transport", MetricsVersion: 3}
+	project.Scope = data.ScopeOfEngagement{Quantification: true, CostEstimation: true, EstimatedCompletionDate: primitive.NewDateTimeFromTime(time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC))}
+	project.Metrics.ProgressToDate = data.ProgressToDate{Quantification: 80, CostEstimation: 40}
+	project.Metrics.AnticipatedCompletionDate.Quantification = primitive.NewDateTimeFromTime(time.Date(2026, 7, 10, 0, 0, 0, 0, time.UTC))
+	project.Metrics.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{{LevelOfDesign: "Concept", BaseValue: 1000000, P50OutturnCost: 1200000, P90OutturnCost: 1500000}}
+	project.Metrics.KeyCostDriversBaseValue = 1000000
+	project.Metrics.KeyCostDrivers = []data.KeyCostDriver{{Driver: "Earthworks", Cost: 250000}}
+	project.Metrics.KeyRisks = []data.KeyRisk{{Description: "Wet weather", Score: "High", Trend: "Rising"}}
+	project.Metrics.ValueManagementOpportunities = []string{"Reuse spoil on site"}
+	return project
+}
+
+// text renders the report uncompressed so its text can be searched.
+func text(t *testing.T, r *Report) string {
+	pdf := render(r)
+	pdf.SetCompression(false)
+
+	var buf bytes.Buffer
+	require.NoError(t, pdf.Output(&buf))
+	return buf.String()
+}
+
+func TestWrite(t *testing.T) {
+	project := testProject()
+	r := &Report{
+		Project:     project,
+		KPIs:        analytics.Compute(&project.Metrics, &project.Scope, nil),
+		Benchmarks:  &analytics.BenchmarkComparison{Metrics: []*analytics.MetricComparison{{Metric: analytics.MetricTotalProjectCostP90, Value: 150, Median: 100, Benchmarks: 2}}},
+		GeneratedAt: time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, r))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+
+	pdf := text(t, r)
+	for _, want := range []string{
+		"Pacific Highway Upgrade",
+		"Generated 1 Oct 2026 09:30 UTC - metrics version 3",
+		"Progress to date", "60%",
+		"10 days late",
+		"Concept \\(current\\)", "$1,500,000",
+		"Earthworks", "25%",
+		"Wet weather", "High",
+		"Reuse spoil on site",
+		"Benchmark position", "Total project cost \\(P90\\)",
+	} {
+		assert.Contains(t, pdf, want)
+	}
+}
+
+func TestWriteHidesSections(t *testing.T) {
+	project := testProject()
+	project.Metrics.KeyRisks[0].Score = ""
+	r := &Report{
+		Project:     project,
+		Hidden:      []data.MetricsSection{data.SectionKeyRiskScores, data.SectionKeyCostDrivers, data.SectionBenchmarking},
+		Benchmarks:  &analytics.BenchmarkComparison{},
+		GeneratedAt: time.Now(),
+	}
+
+	pdf := text(t, r)
+	assert.Contains(t, pdf, "Wet weather")
+	assert.NotContains(t, pdf, "(Score)")
+	assert.NotContains(t, pdf, "Key cost drivers")
+	assert.NotContains(t, pdf, "Benchmark position")
+}
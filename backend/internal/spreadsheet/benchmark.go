@@ -0,0 +1,170 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// benchmarkColumn is a field of data.Benchmark that can be imported and
+// exported, named after its json field.
+type benchmarkColumn struct {
+	field string
+	get   func(b *data.Benchmark) interface{}
+	set   func(b *data.Benchmark, value string) error
+}
+
+var benchmarkColumns = []benchmarkColumn{
+	{"name", func(b *data.Benchmark) interface{} { return b.Name }, func(b *data.Benchmark, v string) error {
+		b.Name = v
+		return nil
+	}},
+	{"geographicLocation", func(b *data.Benchmark) interface{} { return b.GeographicLocation }, func(b *data.Benchmark, v string) error {
+		b.GeographicLocation = v
+		return nil
+	}},
+	{"totalProjectCostP90", func(b *data.Benchmark) interface{} { return b.TotalProjectCostP90 }, func(b *data.Benchmark, v string) error {
+		return parseNumber(v, &b.TotalProjectCostP90)
+	}},
+	{"totalConstructionCostPerLaneKm", func(b *data.Benchmark) interface{} { return b.TotalConstructionCostPerLaneKm }, func(b *data.Benchmark, v string) error {
+		return parseNumber(v, &b.TotalConstructionCostPerLaneKm)
+	}},
+	{"cubicMetreRateForEarthworksPerM3", func(b *data.Benchmark) interface{} { return b.CubicMetreRateForEarthworksPerM3 }, func(b *data.Benchmark, v string) error {
+		return parseNumber(v, &b.CubicMetreRateForEarthworksPerM3)
+	}},
+	{"squareMetreRateForPavementPerBridgePerM2", func(b *data.Benchmark) interface{} { return b.SquareMetreRateForPavementPerBridgePerM2 }, func(b *data.Benchmark, v string) error {
+		return parseNumber(v, &b.SquareMetreRateForPavementPerBridgePerM2)
+	}},
+}
+
+// BenchmarkRow is a row of an imported benchmark table. Row is 1-based and
+// counts the header, so it matches the row number shown by spreadsheet apps.
+type BenchmarkRow struct {
+	Row       int
+	Benchmark *data.Benchmark
+	// Errors holds the cells that couldn't be parsed, by field.
+	Errors data.ValidationErrorMap
+}
+
+// ParseBenchmarks maps the rows of a table onto benchmarks. The first row is
+// the header, its cells are matched with the benchmark json fields ignoring
+// case, unless mapping maps them to a field. Columns that match no field are
+// ignored.
+func ParseBenchmarks(rows [][]string, mapping map[string]string) ([]*BenchmarkRow, error) {
+	if len(rows) == 0 {
+		return nil, apperror.BadRequest("the file is empty")
+	}
+
+	columns := map[int]benchmarkColumn{}
+	for i, header := range rows[0] {
+		header = strings.TrimSpace(header)
+		field := header
+		if mapped, ok := lookup(mapping, header); ok {
+			field = mapped
+		}
+
+		column, ok := findBenchmarkColumn(field)
+		if !ok {
+			if _, mapped := lookup(mapping, header); mapped {
+				return nil, apperror.BadRequest(fmt.Sprintf("column %q is mapped to unknown field %q", header, field))
+			}
+			continue
+		}
+
+		columns[i] = column
+	}
+
+	hasName := false
+	for _, column := range columns {
+		hasName = hasName || column.field == "name"
+	}
+	if !hasName {
+		return nil, apperror.BadRequest("no column maps to the benchmark name")
+	}
+
+	res := []*BenchmarkRow{}
+	for i, row := range rows[1:] {
+		if blank(row) {
+			continue
+		}
+
+		parsed := &BenchmarkRow{Row: i + 2, Benchmark: &data.Benchmark{}, Errors: data.ValidationErrorMap{}}
+		for j, cell := range row {
+			column, ok := columns[j]
+			if !ok {
+				continue
+			}
+
+			err := column.set(parsed.Benchmark, strings.TrimSpace(cell))
+			if err != nil {
+				parsed.Errors[column.field] = err.Error()
+			}
+		}
+
+		res = append(res, parsed)
+	}
+
+	return res, nil
+}
+
+// BenchmarkSheet returns benchmarks as a sheet in the format read by
+// ParseBenchmarks.
+func BenchmarkSheet(benchmarks []*data.Benchmark) Sheet {
+	header := make([]interface{}, len(benchmarkColumns))
+	for i, column := range benchmarkColumns {
+		header[i] = column.field
+	}
+
+	rows := [][]interface{}{header}
+	for _, benchmark := range benchmarks {
+		row := make([]interface{}, len(benchmarkColumns))
+		for i, column := range benchmarkColumns {
+			row[i] = column.get(benchmark)
+		}
+		rows = append(rows, row)
+	}
+
+	return Sheet{Name: "Benchmarks", Rows: rows}
+}
+
+func findBenchmarkColumn(field string) (benchmarkColumn, bool) {
+	for _, column := range benchmarkColumns {
+		if strings.EqualFold(column.field, field) {
+			return column, true
+		}
+	}
+
+	return benchmarkColumn{}, false
+}
+
+// lookup finds the mapping of a header ignoring case.
+func lookup(mapping map[string]string, header string) (string, bool) {
+	for k, v := range mapping {
+		if strings.EqualFold(strings.TrimSpace(k), header) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// parseNumber parses a number, allowing thousands separators and a leading
+// currency sign. Empty cells are 0.
+func parseNumber(value string, dst *float64) error {
+	value = strings.TrimPrefix(strings.ReplaceAll(value, ",", ""), "$")
+	if value == "" {
+		*dst = 0
+		return nil
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+
+	*dst = n
+	return nil
+}
@@ -0,0 +1,250 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// The sheets of the estimating workbook that ParseMetrics reads, they have the
+// same names and columns as the ones written by ProjectSheets.
+const (
+	sheetCostPerMilestone = "Cost per milestone"
+	sheetCostDrivers      = "Cost drivers"
+	sheetRisks            = "Risks"
+)
+
+// baseValueDriver is the cost driver row holding the base value the drivers
+// are a share of.
+const baseValueDriver = "Base value"
+
+// ParseMetrics reads the cost per milestone, cost drivers and risks sheets of
+// an estimating workbook into m, replacing the sections whose sheet is in the
+// workbook and keeping the others. Cells that can't be parsed are returned by
+// json path, the error is for workbooks that can't be read at all.
+func ParseMetrics(sheets map[string][][]string, m *data.Metrics) (data.ValidationErrorMap, error) {
+	errors := data.ValidationErrorMap{}
+	found := false
+
+	if t, ok := findTable(sheets, sheetCostPerMilestone); ok {
+		found = true
+		m.TotalProjectCostPerMilestone = parseCostPerMilestone(t, errors)
+	}
+
+	if t, ok := findTable(sheets, sheetCostDrivers); ok {
+		found = true
+		m.KeyCostDrivers, m.KeyCostDriversBaseValue = parseCostDrivers(t, errors)
+	}
+
+	if t, ok := findTable(sheets, sheetRisks); ok {
+		found = true
+		m.KeyRisks = parseRisks(t, errors)
+	}
+
+	if !found {
+		return nil, apperror.BadRequest(fmt.Sprintf("the workbook has none of the %q, %q or %q sheets", sheetCostPerMilestone, sheetCostDrivers, sheetRisks))
+	}
+
+	return errors, nil
+}
+
+func parseCostPerMilestone(t *table, errors data.ValidationErrorMap) []data.TotalProjectCostPerMilestone {
+	res := []data.TotalProjectCostPerMilestone{}
+	if !t.require(errors, "totalProjectCostPerMilestone", "Level of design") {
+		return res
+	}
+
+	numbers := []struct {
+		column string
+		field  string
+		dst    func(c *data.TotalProjectCostPerMilestone) *float64
+	}{
+		{"Base value", "baseValue", func(c *data.TotalProjectCostPerMilestone) *float64 { return &c.BaseValue }},
+		{"P50 risk contingency", "p50RiskContingency", func(c *data.TotalProjectCostPerMilestone) *float64 { return &c.P50RiskContingency }},
+		{"P50 outturn cost", "p50OutturnCost", func(c *data.TotalProjectCostPerMilestone) *float64 { return &c.P50OutturnCost }},
+		{"P90 risk contingency", "p90RiskContingency", func(c *data.TotalProjectCostPerMilestone) *float64 { return &c.P90RiskContingency }},
+		{"P90 outturn cost", "p90OutturnCost", func(c *data.TotalProjectCostPerMilestone) *float64 { return &c.P90OutturnCost }},
+	}
+
+	for _, row := range t.rows() {
+		path := fmt.Sprintf("totalProjectCostPerMilestone[%d]", len(res))
+		cost := data.TotalProjectCostPerMilestone{LevelOfDesign: row.cell("Level of design")}
+
+		var err error
+		cost.Date, err = parseDate(row.cell("Date"))
+		if err != nil {
+			errors[path+".date"] = row.error(err)
+		}
+
+		for _, n := range numbers {
+			err := parseNumber(row.cell(n.column), n.dst(&cost))
+			if err != nil {
+				errors[path+"."+n.field] = row.error(err)
+			}
+		}
+
+		if current := row.cell("Current"); current != "" {
+			cost.CurrentMilstone, err = strconv.ParseBool(current)
+			if err != nil {
+				errors[path+".currentMilstone"] = row.error(fmt.Errorf("%q is not true or false", current))
+			}
+		}
+
+		res = append(res, cost)
+	}
+
+	return res
+}
+
+func parseCostDrivers(t *table, errors data.ValidationErrorMap) ([]data.KeyCostDriver, float64) {
+	res := []data.KeyCostDriver{}
+	base := 0.0
+	if !t.require(errors, "keyCostDrivers", "Driver") {
+		return res, base
+	}
+
+	for _, row := range t.rows() {
+		driver := data.KeyCostDriver{Driver: row.cell("Driver")}
+		path := fmt.Sprintf("keyCostDrivers[%d].cost", len(res))
+		dst := &driver.Cost
+		if strings.EqualFold(driver.Driver, baseValueDriver) {
+			path, dst = "keyCostDriversBaseValue", &base
+		}
+
+		err := parseNumber(row.cell("Cost"), dst)
+		if err != nil {
+			errors[path] = row.error(err)
+		}
+
+		if dst == &driver.Cost {
+			res = append(res, driver)
+		}
+	}
+
+	return res, base
+}
+
+func parseRisks(t *table, errors data.ValidationErrorMap) []data.KeyRisk {
+	res := []data.KeyRisk{}
+	if !t.require(errors, "keyRisks", "Description") {
+		return res
+	}
+
+	for _, row := range t.rows() {
+		res = append(res, data.KeyRisk{
+			Description: row.cell("Description"),
+			Score:       row.cell("Score"),
+			Trend:       row.cell("Trend"),
+		})
+	}
+
+	return res
+}
+
+// table is a sheet whose first row names its columns.
+type table struct {
+	sheet   string
+	columns map[string]int
+	body    [][]string
+	// offset is the sheet row number of the first body row.
+	offset int
+}
+
+// findTable finds a sheet by name ignoring case.
+func findTable(sheets map[string][][]string, name string) (*table, bool) {
+	for sheet, rows := range sheets {
+		if !strings.EqualFold(strings.TrimSpace(sheet), name) {
+			continue
+		}
+
+		t := &table{sheet: sheet, columns: map[string]int{}, offset: 2}
+		if len(rows) > 0 {
+			for i, header := range rows[0] {
+				t.columns[strings.ToLower(strings.TrimSpace(header))] = i
+			}
+			t.body = rows[1:]
+		}
+		return t, true
+	}
+
+	return nil, false
+}
+
+// require reports whether the table has the column, adding an error for the
+// field otherwise.
+func (t *table) require(errors data.ValidationErrorMap, field, column string) bool {
+	if _, ok := t.columns[strings.ToLower(column)]; !ok {
+		errors[field] = fmt.Sprintf("the %q sheet has no %q column", t.sheet, column)
+		return false
+	}
+
+	return true
+}
+
+// rows returns the rows of the body that aren't blank.
+func (t *table) rows() []tableRow {
+	rows := []tableRow{}
+	for i, cells := range t.body {
+		if !blank(cells) {
+			rows = append(rows, tableRow{table: t, number: t.offset + i, cells: cells})
+		}
+	}
+
+	return rows
+}
+
+type tableRow struct {
+	table  *table
+	number int
+	cells  []string
+}
+
+// cell returns the trimmed value of a column, empty when the table doesn't
+// have it.
+func (r tableRow) cell(column string) string {
+	i, ok := r.table.columns[strings.ToLower(column)]
+	if !ok || i >= len(r.cells) {
+		return ""
+	}
+
+	return strings.TrimSpace(r.cells[i])
+}
+
+// error locates err in the sheet.
+func (r tableRow) error(err error) string {
+	return fmt.Sprintf("%s row %d: %s", r.table.sheet, r.number, err.Error())
+}
+
+// dateLayouts are the text dates accepted besides spreadsheet serial dates.
+var dateLayouts = []string{time.DateOnly, "2/1/2006", time.RFC3339}
+
+// parseDate parses a date cell. Empty cells are the zero date.
+func parseDate(value string) (primitive.DateTime, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		t, err := excelize.ExcelDateToTime(serial, false)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a date", value)
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	}
+
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return primitive.NewDateTimeFromTime(t), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%q is not a date", value)
+}
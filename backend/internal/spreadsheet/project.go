@@ -0,0 +1,227 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// ProjectSheets returns the workbook of a project, a sheet with its details
+// followed by one per metrics section. The project must already be redacted,
+// the sheets of hidden sections are left out. Its milestones, by planned date,
+// decide which cost is current.
+func ProjectSheets(project *data.Project, milestones []*data.Milestone, hidden []data.MetricsSection, generatedAt time.Time) []Sheet {
+	m := &project.Metrics
+	sheets := []Sheet{projectSheet(project, generatedAt)}
+	if !utils.Contains(hidden, data.SectionProgressToDate) {
+		sheets = append(sheets, progressSheet(project, !utils.Contains(hidden, data.SectionAnticipatedCompletionDate)))
+	}
+	if !utils.Contains(hidden, data.SectionCommercialInformation) {
+		sheets = append(sheets, commercialSheet(&m.CommercialInformation))
+	}
+	if !utils.Contains(hidden, data.SectionOptionOutturnCosts) {
+		sheets = append(sheets, optionOutturnCostsSheet(m.OptionOutturnCosts))
+	}
+	if !utils.Contains(hidden, data.SectionTotalProjectCostPerMilestone) {
+		sheets = append(sheets, costPerMilestoneSheet(m.TotalProjectCostPerMilestone, milestones))
+	}
+	if !utils.Contains(hidden, data.SectionKeyCostDrivers) {
+		sheets = append(sheets, costDriversSheet(m))
+	}
+	if !utils.Contains(hidden, data.SectionKeyRisks) {
+		sheets = append(sheets, risksSheet(m.KeyRisks, !utils.Contains(hidden, data.SectionKeyRiskScores)))
+	}
+	if !utils.Contains(hidden, data.SectionDesignPackages) {
+		sheets = append(sheets, designPackagesSheet(m.DesignPackages))
+	}
+	if !utils.Contains(hidden, data.SectionPackages) {
+		// Package and milestone names come from the design packages.
+		design := m.DesignPackages
+		if utils.Contains(hidden, data.SectionDesignPackages) {
+			design = nil
+		}
+		sheets = append(sheets, packagesSheet(m.Packages, design))
+	}
+
+	return sheets
+}
+
+func projectSheet(project *data.Project, generatedAt time.Time) Sheet {
+	return Sheet{Name: "Project", Rows: [][]interface{}{
+		{"Name", project.Name},
+		{"Client", project.Client},
+		{"Region", project.Region},
+		{"CI project number", project.CIProjectNumber},
+		{"Client project number", project.ClientProjectNumber},
+		{"Client representative", project.ClientRepresentative.FullName},
+		{"Project lead", project.Team.ProjectLead.FullName},
+		{"Status", data.NormalizeStatus(project.Status)},
+		{"Start date", date(project.StartDate)},
+		{"Estimated completion date", date(project.Scope.EstimatedCompletionDate)},
+		{"Metrics version", project.MetricsVersion},
+		{"Generated at", generatedAt.UTC()},
+	}}
+}
+
+func progressSheet(project *data.Project, withDates bool) Sheet {
+	m, scope := &project.Metrics, &project.Scope
+	workstreams := []struct {
+		name        string
+		inScope     bool
+		progress    int
+		anticipated primitive.DateTime
+	}{
+		{"Quantification", scope.Quantification, m.ProgressToDate.Quantification, m.AnticipatedCompletionDate.Quantification},
+		{"Cost estimation", scope.CostEstimation, m.ProgressToDate.CostEstimation, m.AnticipatedCompletionDate.CostEstimation},
+		{"Probabilistic risk assessment", scope.ProbabilisticRiskAssessment, m.ProgressToDate.ProbabilisticRiskAssessment, m.AnticipatedCompletionDate.ProbabilisticRiskAssessment},
+		{"Basis of estimate report", scope.BasisOfEstimateReport, m.ProgressToDate.BasisOfEstimateReport, m.AnticipatedCompletionDate.BasisOfEstimateReport},
+	}
+
+	header := []interface{}{"Workstream", "In scope", "Progress (%)"}
+	if withDates {
+		header = append(header, "Anticipated completion")
+	}
+
+	rows := [][]interface{}{header}
+	for _, w := range workstreams {
+		row := []interface{}{w.name, w.inScope, w.progress}
+		if withDates {
+			row = append(row, date(w.anticipated))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, []interface{}{"Milestones", nil, m.ProgressToDate.NumberOfMilestones})
+
+	return Sheet{Name: "Progress", Rows: rows}
+}
+
+func commercialSheet(info *data.CommercialInformation) Sheet {
+	total := info.CIContractedValue + info.ApprovedVariationToDate
+	return Sheet{Name: "Commercial", Rows: [][]interface{}{
+		{"Contracted value", info.CIContractedValue},
+		{"Approved variations to date", info.ApprovedVariationToDate},
+		{"Total fee", total},
+		{"Accrual to date", info.CIAccrualToDate},
+		{"Remaining fee", total - info.CIAccrualToDate},
+	}}
+}
+
+func optionOutturnCostsSheet(options []data.OptionOutturnCost) Sheet {
+	rows := [][]interface{}{{"Option", "Base", "P50", "P90"}}
+	for i, option := range options {
+		rows = append(rows, []interface{}{i + 1, option.Base, option.P50, option.P90})
+	}
+
+	return Sheet{Name: "Option outturn costs", Rows: rows}
+}
+
+func costPerMilestoneSheet(costs []data.TotalProjectCostPerMilestone, milestones []*data.Milestone) Sheet {
+	current := data.CurrentCostRow(milestones, costs)
+	rows := [][]interface{}{{"Level of design", "Date", "Base value", "P50 risk contingency", "P50 outturn cost", "P90 risk contingency", "P90 outturn cost", "Current"}}
+	for i := range costs {
+		cost := &costs[i]
+		rows = append(rows, []interface{}{cost.LevelOfDesign, date(cost.Date), cost.BaseValue, cost.P50RiskContingency, cost.P50OutturnCost, cost.P90RiskContingency, cost.P90OutturnCost, i == current})
+	}
+
+	return Sheet{Name: "Cost per milestone", Rows: rows}
+}
+
+func costDriversSheet(m *data.Metrics) Sheet {
+	rows := [][]interface{}{{"Driver", "Cost"}}
+	for _, driver := range m.KeyCostDrivers {
+		rows = append(rows, []interface{}{driver.Driver, driver.Cost})
+	}
+	rows = append(rows, []interface{}{"Base value", m.KeyCostDriversBaseValue})
+
+	return Sheet{Name: "Cost drivers", Rows: rows}
+}
+
+func risksSheet(risks []data.KeyRisk, withScores bool) Sheet {
+	header := []interface{}{"Description", "Trend"}
+	if withScores {
+		header = []interface{}{"Description", "Score", "Trend"}
+	}
+
+	rows := [][]interface{}{header}
+	for _, risk := range risks {
+		if withScores {
+			rows = append(rows, []interface{}{risk.Description, risk.Score, risk.Trend})
+		} else {
+			rows = append(rows, []interface{}{risk.Description, risk.Trend})
+		}
+	}
+
+	return Sheet{Name: "Risks", Rows: rows}
+}
+
+// designPackagesSheet lays the design packages out as in the app, a row per
+// package with a column per milestone, the level of design first.
+func designPackagesSheet(design *data.DesignPackages) Sheet {
+	rows := [][]interface{}{}
+	if design == nil {
+		return Sheet{Name: "Design packages", Rows: rows}
+	}
+
+	for _, pkg := range append([]data.DesignPackage{design.LevelOfDesign}, design.Packages...) {
+		row := []interface{}{pkg.Description}
+		for _, milestone := range pkg.Milestones {
+			row = append(row, milestone)
+		}
+		rows = append(rows, row)
+	}
+
+	return Sheet{Name: "Design packages", Rows: rows}
+}
+
+// packagesSheet flattens the packages grid, indexed by design package then
+// milestone, to a row per cell.
+func packagesSheet(packages [][]data.Package, design *data.DesignPackages) Sheet {
+	rows := [][]interface{}{{"Design package", "Milestone", "Description", "Progress (%)", "Second stage QA", "Final QA review", "Submitted"}}
+	for i, milestones := range packages {
+		for j, pkg := range milestones {
+			rows = append(rows, []interface{}{designPackageName(design, i), milestoneName(design, j), pkg.Description, pkg.Progress, pkg.SecondStageQA, pkg.FinalQAReview, pkg.Submitted})
+		}
+	}
+
+	return Sheet{Name: "Packages", Rows: rows}
+}
+
+func designPackageName(design *data.DesignPackages, i int) string {
+	if design != nil && i < len(design.Packages) && strings.TrimSpace(design.Packages[i].Description) != "" {
+		return design.Packages[i].Description
+	}
+
+	return fmt.Sprintf("Package %d", i+1)
+}
+
+func milestoneName(design *data.DesignPackages, j int) string {
+	if design != nil && j < len(design.LevelOfDesign.Milestones) && strings.TrimSpace(design.LevelOfDesign.Milestones[j]) != "" {
+		return design.LevelOfDesign.Milestones[j]
+	}
+
+	return fmt.Sprintf("Milestone %d", j+1)
+}
+
+// PortfolioSheet returns a row per project of a list.
+func PortfolioSheet(projects []*data.ProjectSummary) Sheet {
+	rows := [][]interface{}{{"Name", "Client", "Region", "CI project number", "Client project number", "Project lead", "Status", "Current level of design", "Start date", "Estimated completion date", "Completion date"}}
+	for _, p := range projects {
+		rows = append(rows, []interface{}{p.Name, p.Client, p.Region, p.CIProjectNumber, p.ClientProjectNumber, p.ProjectLead.FullName, data.NormalizeStatus(p.Status), p.CurrentLevelOfDesign, date(p.StartDate), date(p.EstimatedCompletionDate), date(p.CompletionDate)})
+	}
+
+	return Sheet{Name: "Portfolio", Rows: rows}
+}
+
+// date returns a date cell, empty when it isn't set.
+func date(d primitive.DateTime) interface{} {
+	if d == 0 {
+		return nil
+	}
+
+	return d.Time().UTC()
+}
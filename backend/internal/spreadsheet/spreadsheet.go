@@ -0,0 +1,200 @@
+// Package spreadsheet reads and writes tables as CSV or XLSX, and maps their
+// rows onto the API's data.
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+var ErrUnknownFormat = apperror.BadRequest("unknown spreadsheet format, expected csv or xlsx")
+
+// ParseFormat reads a format name, e.g. from a query param. Empty is CSV.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", CSV:
+		return CSV, nil
+	case XLSX:
+		return XLSX, nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+// FormatOf returns the format of a file from its extension.
+func FormatOf(filename string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if ext == "" {
+		return "", ErrUnknownFormat
+	}
+
+	return ParseFormat(ext)
+}
+
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+
+	return "text/csv"
+}
+
+// Read returns the rows of a table, the first sheet of a workbook. Trailing
+// empty rows are dropped.
+func Read(r io.Reader, format Format) ([][]string, error) {
+	var rows [][]string
+	switch format {
+	case CSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		var err error
+		rows, err = reader.ReadAll()
+		if err != nil {
+			return nil, apperror.BadRequest("invalid csv: " + err.Error())
+		}
+	case XLSX:
+		workbook, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, apperror.BadRequest("invalid xlsx: " + err.Error())
+		}
+		defer workbook.Close()
+
+		rows, err = workbook.GetRows(workbook.GetSheetName(0))
+		if err != nil {
+			return nil, apperror.BadRequest("invalid xlsx: " + err.Error())
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	for len(rows) > 0 && blank(rows[len(rows)-1]) {
+		rows = rows[:len(rows)-1]
+	}
+
+	return rows, nil
+}
+
+// ReadWorkbook returns the rows of every sheet of a workbook by sheet name.
+// Cells hold their raw values, e.g. dates are serial numbers.
+func ReadWorkbook(r io.Reader) (map[string][][]string, error) {
+	workbook, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, apperror.BadRequest("invalid xlsx: " + err.Error())
+	}
+	defer workbook.Close()
+
+	sheets := map[string][][]string{}
+	for _, name := range workbook.GetSheetList() {
+		rows, err := workbook.GetRows(name, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, apperror.BadRequest("invalid xlsx: " + err.Error())
+		}
+
+		for len(rows) > 0 && blank(rows[len(rows)-1]) {
+			rows = rows[:len(rows)-1]
+		}
+		sheets[name] = rows
+	}
+
+	return sheets, nil
+}
+
+// Sheet is a named table of a workbook. CSV files only hold the first sheet.
+type Sheet struct {
+	Name string
+	Rows [][]interface{}
+}
+
+// Write writes the sheets as a workbook, or the first one as CSV.
+func Write(w io.Writer, format Format, sheets ...Sheet) error {
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(w)
+		if len(sheets) > 0 {
+			for _, row := range sheets[0].Rows {
+				record := make([]string, len(row))
+				for i, cell := range row {
+					record[i] = cellString(cell)
+				}
+
+				err := writer.Write(record)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	case XLSX:
+		workbook := excelize.NewFile()
+		defer workbook.Close()
+
+		for i, sheet := range sheets {
+			if i == 0 {
+				err := workbook.SetSheetName(workbook.GetSheetName(0), sheet.Name)
+				if err != nil {
+					return err
+				}
+			} else if _, err := workbook.NewSheet(sheet.Name); err != nil {
+				return err
+			}
+
+			for j, row := range sheet.Rows {
+				cell, err := excelize.CoordinatesToCellName(1, j+1)
+				if err != nil {
+					return err
+				}
+
+				err = workbook.SetSheetRow(sheet.Name, cell, &row)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return workbook.Write(w)
+	}
+
+	return ErrUnknownFormat
+}
+
+func blank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cellString(cell interface{}) string {
+	switch v := cell.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+
+	return fmt.Sprint(cell)
+}
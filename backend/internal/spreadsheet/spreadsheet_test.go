@@ -0,0 +1,155 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+func TestBenchmarksRoundTrip(t *testing.T) {
+	benchmarks := []*data.Benchmark{
+		{Name: "Pacific Highway", GeographicLocation: "NSW", TotalProjectCostP90: 1250000.5, TotalConstructionCostPerLaneKm: 20},
+		{Name: "Hume Highway", GeographicLocation: "VIC", CubicMetreRateForEarthworksPerM3: 35, SquareMetreRateForPavementPerBridgePerM2: 410},
+	}
+
+	for _, format := range []Format{CSV, XLSX} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Write(&buf, format, BenchmarkSheet(benchmarks)))
+
+			table, err := Read(&buf, format)
+			require.NoError(t, err)
+
+			rows, err := ParseBenchmarks(table, nil)
+			require.NoError(t, err)
+			require.Len(t, rows, 2)
+			for i, row := range rows {
+				assert.Equal(t, i+2, row.Row)
+				assert.Empty(t, row.Errors)
+				assert.Equal(t, benchmarks[i], row.Benchmark)
+			}
+		})
+	}
+}
+
+func TestParseBenchmarks(t *testing.T) {
+	table, err := Read(bytes.NewBufferString("Project,State,P90 Cost,Notes\nPacific Highway,NSW,\"$1,250\",x\nHume Highway,VIC,lots,\n\n"), CSV)
+	require.NoError(t, err)
+	require.Len(t, table, 3)
+
+	_, err = ParseBenchmarks(table, nil)
+	assert.Error(t, err, "no column maps to the name")
+
+	_, err = ParseBenchmarks(table, map[string]string{"Project": "title"})
+	assert.Error(t, err, "mapped to an unknown field")
+
+	rows, err := ParseBenchmarks(table, map[string]string{"project": "name", "STATE": "geographicLocation", "P90 Cost": "totalProjectCostP90"})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, &data.Benchmark{Name: "Pacific Highway", GeographicLocation: "NSW", TotalProjectCostP90: 1250}, rows[0].Benchmark)
+	assert.Equal(t, 3, rows[1].Row)
+	assert.Equal(t, data.ValidationErrorMap{"totalProjectCostP90": `"lots" is not a number`}, rows[1].Errors)
+}
+
+func TestFormatOf(t *testing.T) {
+	format, err := FormatOf("Benchmarks.XLSX")
+	require.NoError(t, err)
+	assert.Equal(t, XLSX, format)
+
+	_, err = FormatOf("benchmarks.xls")
+	assert.Error(t, err)
+}
+
+func TestProjectSheets(t *testing.T) {
+	project := &data.Project{Name: "Alpha"}
+	project.Metrics.KeyRisks = []data.KeyRisk{{Description: "Wet weather", Trend: "Rising"}}
+	project.Metrics.DesignPackages = &data.DesignPackages{
+		LevelOfDesign: data.DesignPackage{Description: "Level of design", Milestones: []string{"30%", "70%"}},
+		Packages:      []data.DesignPackage{{Description: "Roads"}},
+	}
+	project.Metrics.Packages = [][]data.Package{
+		{{Description: "Roads 30%", Progress: 100}, {Description: "Roads 70%"}},
+		{{Description: "Bridges 30%", Submitted: true}},
+	}
+
+	names := func(sheets []Sheet) []string {
+		res := []string{}
+		for _, sheet := range sheets {
+			res = append(res, sheet.Name)
+		}
+		return res
+	}
+
+	sheets := ProjectSheets(project, nil, nil, time.Now())
+	assert.Equal(t, []string{"Project", "Progress", "Commercial", "Option outturn costs", "Cost per milestone", "Cost drivers", "Risks", "Design packages", "Packages"}, names(sheets))
+
+	packages := sheets[len(sheets)-1].Rows
+	require.Len(t, packages, 4)
+	assert.Equal(t, []interface{}{"Roads", "70%", "Roads 70%", 0, false, false, false}, packages[2])
+	assert.Equal(t, []interface{}{"Package 2", "30%", "Bridges 30%", 0, false, false, true}, packages[3])
+
+	sheets = ProjectSheets(project, nil, []data.MetricsSection{data.SectionCommercialInformation, data.SectionKeyRiskScores, data.SectionDesignPackages}, time.Now())
+	assert.NotContains(t, names(sheets), "Commercial")
+	assert.NotContains(t, names(sheets), "Design packages")
+	for _, sheet := range sheets {
+		switch sheet.Name {
+		case "Risks":
+			assert.Equal(t, []interface{}{"Description", "Trend"}, sheet.Rows[0])
+		case "Packages":
+			assert.Equal(t, "Package 1", sheet.Rows[1][0], "names come from the hidden design packages")
+			assert.Equal(t, "Milestone 1", sheet.Rows[1][1])
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, XLSX, ProjectSheets(project, nil, nil, time.Now())...))
+}
+
+func TestParseMetrics(t *testing.T) {
+	date := primitive.NewDateTimeFromTime(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC))
+	project := &data.Project{}
+	project.Metrics.TotalProjectCostPerMilestone = []data.TotalProjectCostPerMilestone{
+		{LevelOfDesign: "Concept", Date: date, BaseValue: 1000, P50OutturnCost: 1200, P50RiskContingency: 200, P90OutturnCost: 1500, P90RiskContingency: 500.5},
+		{LevelOfDesign: "Detailed", CurrentMilstone: true},
+	}
+	project.Metrics.KeyCostDriversBaseValue = 1000
+	project.Metrics.KeyCostDrivers = []data.KeyCostDriver{{Driver: "Earthworks", Cost: 250}}
+	project.Metrics.KeyRisks = []data.KeyRisk{{Description: "Wet weather", Score: "High", Trend: "Rising"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, XLSX, ProjectSheets(project, nil, nil, time.Now())...))
+	sheets, err := ReadWorkbook(&buf)
+	require.NoError(t, err)
+
+	m := &data.Metrics{ValueManagementOpportunities: []string{"kept"}}
+	errors, err := ParseMetrics(sheets, m)
+	require.NoError(t, err)
+	assert.Empty(t, errors)
+	assert.Equal(t, project.Metrics.TotalProjectCostPerMilestone, m.TotalProjectCostPerMilestone)
+	assert.Equal(t, project.Metrics.KeyCostDrivers, m.KeyCostDrivers)
+	assert.Equal(t, 1000.0, m.KeyCostDriversBaseValue)
+	assert.Equal(t, project.Metrics.KeyRisks, m.KeyRisks)
+	assert.Equal(t, []string{"kept"}, m.ValueManagementOpportunities)
+
+	errors, err = ParseMetrics(map[string][][]string{
+		"cost per milestone": {{"Level of design", "Date", "Base value"}, {"Concept", "31/03/2026", "lots"}, {}, {"Detailed", "soon"}},
+		"Risks":              {{"Risk"}},
+	}, m)
+	require.NoError(t, err)
+	assert.Equal(t, data.ValidationErrorMap{
+		"totalProjectCostPerMilestone[0].baseValue": `cost per milestone row 2: "lots" is not a number`,
+		"totalProjectCostPerMilestone[1].date":      `cost per milestone row 4: "soon" is not a date`,
+		"keyRisks":                                  `the "Risks" sheet has no "Description" column`,
+	}, errors)
+	assert.Equal(t, date, m.TotalProjectCostPerMilestone[0].Date)
+
+	_, err = ParseMetrics(map[string][][]string{"Sheet1": {}}, m)
+	assert.Error(t, err)
+}
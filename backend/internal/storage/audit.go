@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditStorage is append only, entries can't be changed once recorded.
+type AuditStorage interface {
+	CreateEntry(entry *data.AuditEntry) (*data.AuditEntry, error)
+	GetEntries(filter AuditFilter) (*data.Page[*data.AuditEntry], error)
+}
+
+// AuditFilter narrows down the audit log. Zero fields don't filter. Entries are
+// returned newest first, Cursor is the id of the last entry of the previous
+// page.
+type AuditFilter struct {
+	ActorID       string
+	ResourceTypes []string
+	ResourceID    string
+	From          time.Time
+	To            time.Time
+	Limit         int
+	Cursor        string
+	// ProjectID matches the entries of the project's resources along with the
+	// entries with it as their resource.
+	ProjectID string
+}
+
+type mongoAuditStorage struct {
+	db *mongo.Database
+}
+
+func NewAuditStorage(db *mongo.Database) *mongoAuditStorage {
+	return &mongoAuditStorage{db: db}
+}
+
+func (p *mongoAuditStorage) CreateEntry(entry *data.AuditEntry) (*data.AuditEntry, error) {
+	entry.ID = primitive.NilObjectID
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	}
+
+	res, err := p.db.Collection("audit_log").InsertOne(context.TODO(), entry)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.ID = res.InsertedID.(primitive.ObjectID)
+	return entry, nil
+}
+
+func (p *mongoAuditStorage) GetEntries(f AuditFilter) (*data.Page[*data.AuditEntry], error) {
+	filter := bson.M{}
+	if f.ActorID != "" {
+		filter["actor.id"] = f.ActorID
+	}
+	if len(f.ResourceTypes) > 0 {
+		filter["resourcetype"] = bson.M{"$in": f.ResourceTypes}
+	}
+	if f.ResourceID != "" {
+		filter["resourceid"] = f.ResourceID
+	}
+	if f.ProjectID != "" {
+		filter["$or"] = bson.A{bson.M{"resourceid": f.ProjectID}, bson.M{"projectid": f.ProjectID}}
+	}
+
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = primitive.NewDateTimeFromTime(f.From)
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = primitive.NewDateTimeFromTime(f.To)
+	}
+	if len(createdAt) > 0 {
+		filter["createdat"] = createdAt
+	}
+
+	total, err := p.db.Collection("audit_log").CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Cursor != "" {
+		after, err := primitive.ObjectIDFromHex(f.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter["_id"] = bson.M{"$lt": after}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if f.Limit > 0 {
+		opts.SetLimit(int64(f.Limit) + 1)
+	}
+
+	cursor, err := p.db.Collection("audit_log").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	entries := []*data.AuditEntry{}
+	for cursor.Next(context.TODO()) {
+		entry := &data.AuditEntry{}
+		err := cursor.Decode(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	page := &data.Page[*data.AuditEntry]{Items: entries, Total: total}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		page.Items = entries[:f.Limit]
+		page.NextCursor = page.Items[f.Limit-1].ID.Hex()
+	}
+
+	return page, nil
+}
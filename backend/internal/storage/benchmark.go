@@ -2,21 +2,33 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type BenchmarkStorage interface {
 	GetById(hex string) (*data.Benchmark, error)
 	GetAll() ([]*data.Benchmark, error)
+	GetByIDs(ids []primitive.ObjectID) ([]*data.Benchmark, error)
 	Create(benchmark *data.Benchmark) (*data.Benchmark, error)
 	Update(hex string, benchmark *data.Benchmark) (*data.Benchmark, error)
-	Delete(hex string) error
+	Delete(hex string, deletedBy string) error
+	GetTrashed() ([]*data.Benchmark, error)
+	Restore(hex string) error
+	Purge(hex string) error
+	PurgeTrashed(before time.Time) (int64, error)
 }
 
+// ErrBenchmarkInUse is returned when deleting a benchmark that live projects
+// still compare themselves against.
+var ErrBenchmarkInUse = apperror.Conflict("benchmark is used by one or more projects")
+
 type mongoBenchmarkStorage struct {
 	db *mongo.Database
 }
@@ -26,22 +38,36 @@ func NewBenchmarkStorage(db *mongo.Database) *mongoBenchmarkStorage {
 }
 
 func (p *mongoBenchmarkStorage) GetById(hex string) (*data.Benchmark, error) {
-	id, err := primitive.ObjectIDFromHex(hex)
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
 	benchmark := &data.Benchmark{}
-	err = p.db.Collection("benchmarks").FindOne(context.TODO(), bson.M{"_id": id}).Decode(benchmark)
+	err = p.db.Collection("benchmarks").FindOne(context.TODO(), bson.M{"_id": id, "deletedat": nil}).Decode(benchmark)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, "benchmark")
 	}
 
 	return benchmark, nil
 }
 
 func (p *mongoBenchmarkStorage) GetAll() ([]*data.Benchmark, error) {
-	cursor, err := p.db.Collection("benchmarks").Find(context.TODO(), bson.M{})
+	return p.find(bson.M{"deletedat": nil})
+}
+
+// GetByIDs returns the benchmarks with the given ids that aren't in the trash,
+// in no particular order.
+func (p *mongoBenchmarkStorage) GetByIDs(ids []primitive.ObjectID) ([]*data.Benchmark, error) {
+	if len(ids) == 0 {
+		return []*data.Benchmark{}, nil
+	}
+
+	return p.find(bson.M{"_id": bson.M{"$in": ids}, "deletedat": nil})
+}
+
+func (p *mongoBenchmarkStorage) find(filter bson.M, opts ...*options.FindOptions) ([]*data.Benchmark, error) {
+	cursor, err := p.db.Collection("benchmarks").Find(context.TODO(), filter, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,29 +97,131 @@ func (p *mongoBenchmarkStorage) Create(benchmark *data.Benchmark) (*data.Benchma
 }
 
 func (p *mongoBenchmarkStorage) Update(hex string, benchmark *data.Benchmark) (*data.Benchmark, error) {
-	id, err := primitive.ObjectIDFromHex(hex)
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = p.db.Collection("benchmarks").UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": benchmark})
+	update, err := setFields(benchmark, "deletedat", "deletedby")
 	if err != nil {
 		return nil, err
 	}
 
+	res, err := p.db.Collection("benchmarks").UpdateOne(context.TODO(), bson.M{"_id": id, "deletedat": nil}, bson.M{"$set": update})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.MatchedCount == 0 {
+		return nil, apperror.NotFound("benchmark")
+	}
+
 	return benchmark, nil
 }
 
-func (p *mongoBenchmarkStorage) Delete(hex string) error {
-	id, err := primitive.ObjectIDFromHex(hex)
+// Delete moves the benchmark to the trash. Benchmarks still referenced by a
+// live project can't be deleted.
+func (p *mongoBenchmarkStorage) Delete(hex string, deletedBy string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	count, err := p.db.Collection("projects").CountDocuments(context.TODO(), bson.M{
+		"metrics.benchmarking.benchmarks.benchmarkid": id,
+		"deletedat": nil,
+	})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrBenchmarkInUse
+	}
+
+	res, err := p.db.Collection("benchmarks").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil},
+		bson.M{"$set": bson.M{"deletedat": primitive.NewDateTimeFromTime(time.Now()), "deletedby": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("benchmark")
+	}
+
+	return nil
+}
+
+func (p *mongoBenchmarkStorage) GetTrashed() ([]*data.Benchmark, error) {
+	return p.find(bson.M{"deletedat": bson.M{"$ne": nil}}, options.Find().SetSort(bson.M{"deletedat": -1}))
+}
+
+func (p *mongoBenchmarkStorage) Restore(hex string) error {
+	id, err := objectID(hex)
 	if err != nil {
 		return err
 	}
 
-	_, err = p.db.Collection("benchmarks").DeleteOne(context.TODO(), bson.M{"_id": id})
+	res, err := p.db.Collection("benchmarks").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deletedat": "", "deletedby": ""}},
+	)
 	if err != nil {
 		return err
 	}
 
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("benchmark")
+	}
+
 	return nil
 }
+
+// Purge permanently deletes a trashed benchmark. Trashed projects that still
+// reference it have the reference removed.
+func (p *mongoBenchmarkStorage) Purge(hex string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("benchmarks").DeleteOne(context.TODO(), bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return apperror.NotFound("benchmark")
+	}
+
+	_, err = p.db.Collection("projects").UpdateMany(
+		context.TODO(),
+		bson.M{"metrics.benchmarking.benchmarks.benchmarkid": id},
+		bson.M{"$pull": bson.M{"metrics.benchmarking.benchmarks": bson.M{"benchmarkid": id}}},
+	)
+	return err
+}
+
+// PurgeTrashed permanently deletes the benchmarks trashed before the given
+// time and returns how many were deleted.
+func (p *mongoBenchmarkStorage) PurgeTrashed(before time.Time) (int64, error) {
+	benchmarks, err := p.find(bson.M{"deletedat": bson.M{"$ne": nil, "$lt": primitive.NewDateTimeFromTime(before)}})
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, benchmark := range benchmarks {
+		err = p.Purge(benchmark.ID.Hex())
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryBenchmarkStorage keeps benchmarks in memory. Like the Mongo storage it
+// checks the projects before a benchmark is deleted or purged, so it is given
+// the in-memory project storage.
+type memoryBenchmarkStorage struct {
+	mu         sync.RWMutex
+	benchmarks map[primitive.ObjectID]*data.Benchmark
+	projects   *memoryProjectStorage
+}
+
+func NewMemoryBenchmarkStorage(projects *memoryProjectStorage) *memoryBenchmarkStorage {
+	return &memoryBenchmarkStorage{benchmarks: map[primitive.ObjectID]*data.Benchmark{}, projects: projects}
+}
+
+// get returns the stored benchmark if it is in the trash or not, as asked.
+// The caller must hold the lock.
+func (p *memoryBenchmarkStorage) get(hex string, trashed bool) (*data.Benchmark, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmark, ok := p.benchmarks[id]
+	if !ok || (benchmark.DeletedAt != nil) != trashed {
+		return nil, apperror.NotFound("benchmark")
+	}
+
+	return benchmark, nil
+}
+
+// find returns copies of the stored benchmarks for which keep is true, oldest
+// first. The caller must hold the lock.
+func (p *memoryBenchmarkStorage) find(keep func(benchmark *data.Benchmark) bool) []*data.Benchmark {
+	benchmarks := []*data.Benchmark{}
+	for _, benchmark := range p.benchmarks {
+		if keep(benchmark) {
+			copied := *benchmark
+			benchmarks = append(benchmarks, &copied)
+		}
+	}
+
+	sort.Slice(benchmarks, func(i, j int) bool {
+		return benchmarks[i].ID.Hex() < benchmarks[j].ID.Hex()
+	})
+
+	return benchmarks
+}
+
+func (p *memoryBenchmarkStorage) GetById(hex string) (*data.Benchmark, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	benchmark, err := p.get(hex, false)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := *benchmark
+	return &copied, nil
+}
+
+func (p *memoryBenchmarkStorage) GetAll() ([]*data.Benchmark, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.find(func(benchmark *data.Benchmark) bool { return benchmark.DeletedAt == nil }), nil
+}
+
+func (p *memoryBenchmarkStorage) GetByIDs(ids []primitive.ObjectID) ([]*data.Benchmark, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	wanted := map[primitive.ObjectID]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	return p.find(func(benchmark *data.Benchmark) bool { return benchmark.DeletedAt == nil && wanted[benchmark.ID] }), nil
+}
+
+func (p *memoryBenchmarkStorage) Create(benchmark *data.Benchmark) (*data.Benchmark, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if benchmark.ID.IsZero() {
+		benchmark.ID = primitive.NewObjectID()
+	}
+
+	stored := *benchmark
+	p.benchmarks[benchmark.ID] = &stored
+	return benchmark, nil
+}
+
+func (p *memoryBenchmarkStorage) Update(hex string, benchmark *data.Benchmark) (*data.Benchmark, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, err := p.get(hex, false)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *benchmark
+	updated.ID = stored.ID
+	updated.DeletedAt = nil
+	updated.DeletedBy = ""
+	p.benchmarks[stored.ID] = &updated
+
+	return benchmark, nil
+}
+
+func (p *memoryBenchmarkStorage) Delete(hex string, deletedBy string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	benchmark, err := p.get(hex, false)
+	if err != nil {
+		return err
+	}
+
+	if p.projects.usesBenchmark(benchmark.ID) {
+		return ErrBenchmarkInUse
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	benchmark.DeletedAt = &now
+	benchmark.DeletedBy = deletedBy
+	return nil
+}
+
+func (p *memoryBenchmarkStorage) GetTrashed() ([]*data.Benchmark, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	benchmarks := p.find(func(benchmark *data.Benchmark) bool { return benchmark.DeletedAt != nil })
+	sort.SliceStable(benchmarks, func(i, j int) bool {
+		return *benchmarks[i].DeletedAt > *benchmarks[j].DeletedAt
+	})
+
+	return benchmarks, nil
+}
+
+func (p *memoryBenchmarkStorage) Restore(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	benchmark, err := p.get(hex, true)
+	if err != nil {
+		return err
+	}
+
+	benchmark.DeletedAt = nil
+	benchmark.DeletedBy = ""
+	return nil
+}
+
+func (p *memoryBenchmarkStorage) Purge(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	benchmark, err := p.get(hex, true)
+	if err != nil {
+		return err
+	}
+
+	delete(p.benchmarks, benchmark.ID)
+	p.projects.removeBenchmark(benchmark.ID)
+	return nil
+}
+
+func (p *memoryBenchmarkStorage) PurgeTrashed(before time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var purged int64
+	for id, benchmark := range p.benchmarks {
+		if benchmark.DeletedAt != nil && benchmark.DeletedAt.Time().Before(before) {
+			delete(p.benchmarks, id)
+			p.projects.removeBenchmark(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The in-memory storages take the same bson filters as the Mongo ones, e.g.
+// the ones built by auth.ProjectPolicy. matchFilter supports the subset of the
+// query language this package and its callers use: $and, $or, equality on
+// dotted paths (matching any element of arrays along the way), $eq, $ne, $in,
+// $nin, $gt, $gte, $lt, $lte and $exists.
+
+// toDocument returns v as it would be stored in Mongo.
+func toDocument(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// clone copies src into dst through bson, so the in-memory storages hand out
+// copies just like decoding from Mongo does.
+func clone(src, dst interface{}) error {
+	raw, err := bson.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(raw, dst)
+}
+
+func matchFilter(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var ok bool
+		var err error
+
+		switch key {
+		case "$and":
+			ok, err = matchAll(doc, cond)
+		case "$or":
+			ok, err = matchAny(doc, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported filter operator %s", key)
+			}
+			ok, err = matchField(lookup(doc, key), cond)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchAll(doc bson.M, conds interface{}) (bool, error) {
+	filters, err := filterList(conds)
+	if err != nil {
+		return false, err
+	}
+
+	for _, filter := range filters {
+		ok, err := matchFilter(doc, filter)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchAny(doc bson.M, conds interface{}) (bool, error) {
+	filters, err := filterList(conds)
+	if err != nil {
+		return false, err
+	}
+
+	for _, filter := range filters {
+		ok, err := matchFilter(doc, filter)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func filterList(conds interface{}) ([]bson.M, error) {
+	list, ok := conds.(bson.A)
+	if !ok {
+		if filters, ok := conds.([]bson.M); ok {
+			return filters, nil
+		}
+		return nil, fmt.Errorf("expected an array of filters, got %T", conds)
+	}
+
+	filters := make([]bson.M, 0, len(list))
+	for _, item := range list {
+		filter, ok := item.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("expected a filter, got %T", item)
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// lookup returns every value found at the dotted path. Arrays on the way are
+// walked into, and an array at the end is returned along with its elements.
+func lookup(value interface{}, path string) []interface{} {
+	if path == "" {
+		if arr, ok := value.(bson.A); ok {
+			return append([]interface{}{arr}, arr...)
+		}
+		return []interface{}{value}
+	}
+
+	key, rest, _ := strings.Cut(path, ".")
+
+	switch v := value.(type) {
+	case bson.M:
+		field, ok := v[key]
+		if !ok {
+			return nil
+		}
+		return lookup(field, rest)
+	case bson.D:
+		for _, e := range v {
+			if e.Key == key {
+				return lookup(e.Value, rest)
+			}
+		}
+	case bson.A:
+		values := []interface{}{}
+		for _, item := range v {
+			values = append(values, lookup(item, path)...)
+		}
+		return values
+	}
+
+	return nil
+}
+
+func matchField(values []interface{}, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperatorDoc(ops) {
+		return matchEq(values, cond), nil
+	}
+
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = matchEq(values, arg)
+		case "$ne":
+			ok = !matchEq(values, arg)
+		case "$in", "$nin":
+			list, isList := arg.(bson.A)
+			if !isList {
+				return false, fmt.Errorf("%s expects an array, got %T", op, arg)
+			}
+			for _, item := range list {
+				if matchEq(values, item) {
+					ok = true
+					break
+				}
+			}
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			for _, value := range values {
+				cmp, comparable := compareValues(value, arg)
+				if comparable && compareOp(op, cmp) {
+					ok = true
+					break
+				}
+			}
+		case "$exists":
+			exists := len(values) > 0
+			ok = exists == (arg == true)
+		default:
+			return false, fmt.Errorf("unsupported filter operator %s", op)
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isOperatorDoc(doc bson.M) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) > 0
+}
+
+// matchEq reports whether any of the values equals want. Like Mongo, nil
+// matches missing fields as well as null ones.
+func matchEq(values []interface{}, want interface{}) bool {
+	if want == nil && len(values) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		if valuesEqual(value, want) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func compareOp(op string, cmp int) bool {
+	switch op {
+	case "$gt":
+		return cmp > 0
+	case "$gte":
+		return cmp >= 0
+	case "$lt":
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+// compareValues orders two values of the same bson type. ok is false when
+// they can't be compared.
+func compareValues(a, b interface{}) (cmp int, ok bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bool:
+		y, ok := b.(bool)
+		if !ok || x == y {
+			return 0, ok
+		}
+		if !x {
+			return -1, true
+		}
+		return 1, true
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), ok
+	case primitive.DateTime, time.Time:
+		x1, _ := dateTime(a)
+		y, ok := dateTime(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x1 < y:
+			return -1, true
+		case x1 > y:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func dateTime(v interface{}) (primitive.DateTime, bool) {
+	switch t := v.(type) {
+	case primitive.DateTime:
+		return t, true
+	case time.Time:
+		return primitive.NewDateTimeFromTime(t), true
+	}
+	return 0, false
+}
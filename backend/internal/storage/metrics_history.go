@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MetricsHistoryStorage interface {
+	GetSnapshots(projectHex string) ([]*data.MetricsSnapshot, error)
+	GetSnapshot(projectHex string, version int) (*data.MetricsSnapshot, error)
+	CreateSnapshot(snapshot *data.MetricsSnapshot) (*data.MetricsSnapshot, error)
+}
+
+type mongoMetricsHistoryStorage struct {
+	db *mongo.Database
+}
+
+func NewMetricsHistoryStorage(db *mongo.Database) *mongoMetricsHistoryStorage {
+	return &mongoMetricsHistoryStorage{db: db}
+}
+
+// GetSnapshots returns every snapshot of a project, newest first. The metrics
+// themselves are left out, use GetSnapshot to load a single version.
+func (p *mongoMetricsHistoryStorage) GetSnapshots(projectHex string) ([]*data.MetricsSnapshot, error) {
+	id, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"version": -1}).
+		SetProjection(bson.M{"metrics": 0})
+
+	cursor, err := p.db.Collection("project_metrics_history").Find(context.TODO(), bson.M{"projectid": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	snapshots := []*data.MetricsSnapshot{}
+	for cursor.Next(context.TODO()) {
+		snapshot := &data.MetricsSnapshot{}
+		err := cursor.Decode(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+func (p *mongoMetricsHistoryStorage) GetSnapshot(projectHex string, version int) (*data.MetricsSnapshot, error) {
+	id, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &data.MetricsSnapshot{}
+	err = p.db.Collection("project_metrics_history").FindOne(context.TODO(), bson.M{"projectid": id, "version": version}).Decode(snapshot)
+	if err != nil {
+		return nil, notFound(err, "metrics snapshot")
+	}
+
+	return snapshot, nil
+}
+
+// CreateSnapshot stores a new snapshot. Snapshots are never updated once
+// written.
+func (p *mongoMetricsHistoryStorage) CreateSnapshot(snapshot *data.MetricsSnapshot) (*data.MetricsSnapshot, error) {
+	res, err := p.db.Collection("project_metrics_history").InsertOne(context.TODO(), snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.ID = res.InsertedID.(primitive.ObjectID)
+	return snapshot, nil
+}
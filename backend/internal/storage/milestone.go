@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MilestoneStorage stores the milestones of projects. Milestones are always
+// looked up through their project.
+type MilestoneStorage interface {
+	GetMilestones(projectHex string) ([]*data.Milestone, error)
+	GetMilestone(projectHex, hex string) (*data.Milestone, error)
+	CreateMilestone(projectHex string, milestone *data.Milestone) (*data.Milestone, error)
+	UpdateMilestone(projectHex, hex string, milestone *data.Milestone) (*data.Milestone, error)
+	DeleteMilestone(projectHex, hex string) error
+}
+
+type mongoMilestoneStorage struct {
+	db *mongo.Database
+}
+
+func NewMilestoneStorage(db *mongo.Database) *mongoMilestoneStorage {
+	return &mongoMilestoneStorage{db: db}
+}
+
+// GetMilestones returns the milestones of a project by planned date.
+func (p *mongoMilestoneStorage) GetMilestones(projectHex string) ([]*data.Milestone, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "planneddate", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := p.db.Collection("project_milestones").Find(context.TODO(), bson.M{"projectid": projectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	milestones := []*data.Milestone{}
+	for cursor.Next(context.TODO()) {
+		milestone := &data.Milestone{}
+		err := cursor.Decode(milestone)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, milestone)
+	}
+
+	return milestones, nil
+}
+
+// milestonesByProject returns the milestones of the projects by planned date,
+// keyed by project.
+func milestonesByProject(db *mongo.Database, projectIDs []primitive.ObjectID) (map[primitive.ObjectID][]*data.Milestone, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "planneddate", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := db.Collection("project_milestones").Find(context.TODO(), bson.M{"projectid": bson.M{"$in": projectIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	milestones := map[primitive.ObjectID][]*data.Milestone{}
+	for cursor.Next(context.TODO()) {
+		milestone := &data.Milestone{}
+		err := cursor.Decode(milestone)
+		if err != nil {
+			return nil, err
+		}
+		milestones[milestone.ProjectID] = append(milestones[milestone.ProjectID], milestone)
+	}
+
+	return milestones, nil
+}
+
+func (p *mongoMilestoneStorage) GetMilestone(projectHex, hex string) (*data.Milestone, error) {
+	filter, err := milestoneFilter(projectHex, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone := &data.Milestone{}
+	err = p.db.Collection("project_milestones").FindOne(context.TODO(), filter).Decode(milestone)
+	if err != nil {
+		return nil, notFound(err, "milestone")
+	}
+
+	return milestone, nil
+}
+
+func (p *mongoMilestoneStorage) CreateMilestone(projectHex string, milestone *data.Milestone) (*data.Milestone, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	milestone.ID = primitive.NilObjectID
+	milestone.ProjectID = projectID
+	milestone.CreatedAt = now
+	milestone.UpdatedAt = now
+
+	res, err := p.db.Collection("project_milestones").InsertOne(context.TODO(), milestone)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone.ID = res.InsertedID.(primitive.ObjectID)
+	return milestone, nil
+}
+
+// UpdateMilestone replaces a milestone, keeping its project and creation date.
+func (p *mongoMilestoneStorage) UpdateMilestone(projectHex, hex string, milestone *data.Milestone) (*data.Milestone, error) {
+	filter, err := milestoneFilter(projectHex, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+	update, err := setFields(milestone, "_id", "projectid", "createdat")
+	if err != nil {
+		return nil, err
+	}
+
+	res := p.db.Collection("project_milestones").FindOneAndUpdate(
+		context.TODO(),
+		filter,
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+
+	updated := &data.Milestone{}
+	err = res.Decode(updated)
+	if err != nil {
+		return nil, notFound(err, "milestone")
+	}
+
+	return updated, nil
+}
+
+func (p *mongoMilestoneStorage) DeleteMilestone(projectHex, hex string) error {
+	filter, err := milestoneFilter(projectHex, hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("project_milestones").DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return apperror.NotFound("milestone")
+	}
+
+	return nil
+}
+
+// milestoneFilter matches the milestone only within its project.
+func milestoneFilter(projectHex, hex string) (bson.M, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"_id": id, "projectid": projectID}, nil
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryMilestoneStorage keeps milestones in memory.
+type memoryMilestoneStorage struct {
+	mu         sync.RWMutex
+	milestones map[primitive.ObjectID]*data.Milestone
+}
+
+func NewMemoryMilestoneStorage() *memoryMilestoneStorage {
+	return &memoryMilestoneStorage{milestones: map[primitive.ObjectID]*data.Milestone{}}
+}
+
+// get returns the stored milestone if it belongs to the project. The caller
+// must hold the lock.
+func (p *memoryMilestoneStorage) get(projectHex, hex string) (*data.Milestone, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone, ok := p.milestones[id]
+	if !ok || milestone.ProjectID != projectID {
+		return nil, apperror.NotFound("milestone")
+	}
+
+	return milestone, nil
+}
+
+func (p *memoryMilestoneStorage) GetMilestones(projectHex string) ([]*data.Milestone, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	milestones := []*data.Milestone{}
+	for _, milestone := range p.milestones {
+		if milestone.ProjectID != projectID {
+			continue
+		}
+
+		copied, err := copyMilestone(milestone)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, copied)
+	}
+
+	// the same order as the Mongo storage
+	sort.Slice(milestones, func(i, j int) bool {
+		if milestones[i].PlannedDate != milestones[j].PlannedDate {
+			return milestones[i].PlannedDate < milestones[j].PlannedDate
+		}
+		return milestones[i].ID.Hex() < milestones[j].ID.Hex()
+	})
+
+	return milestones, nil
+}
+
+func (p *memoryMilestoneStorage) GetMilestone(projectHex, hex string) (*data.Milestone, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	milestone, err := p.get(projectHex, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyMilestone(milestone)
+}
+
+func (p *memoryMilestoneStorage) CreateMilestone(projectHex string, milestone *data.Milestone) (*data.Milestone, error) {
+	projectID, err := objectID(projectHex)
+	if err != nil {
+		return nil, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	milestone.ID = primitive.NewObjectID()
+	milestone.ProjectID = projectID
+	milestone.CreatedAt = now
+	milestone.UpdatedAt = now
+
+	stored, err := copyMilestone(milestone)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.milestones[stored.ID] = stored
+	return milestone, nil
+}
+
+func (p *memoryMilestoneStorage) UpdateMilestone(projectHex, hex string, milestone *data.Milestone) (*data.Milestone, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, err := p.get(projectHex, hex)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := copyMilestone(milestone)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same fields the Mongo storage leaves alone
+	updated.ID = stored.ID
+	updated.ProjectID = stored.ProjectID
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+	p.milestones[stored.ID] = updated
+
+	return copyMilestone(updated)
+}
+
+func (p *memoryMilestoneStorage) DeleteMilestone(projectHex, hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	milestone, err := p.get(projectHex, hex)
+	if err != nil {
+		return err
+	}
+
+	delete(p.milestones, milestone.ID)
+	return nil
+}
+
+func copyMilestone(milestone *data.Milestone) (*data.Milestone, error) {
+	ret := &data.Milestone{}
+	err := clone(milestone, ret)
+	return ret, err
+}
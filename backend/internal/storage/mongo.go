@@ -5,6 +5,9 @@ import (
 	"errors"
 	"time"
 
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -40,3 +43,43 @@ func BootstrapMongo(uri, dbName string, timeout time.Duration) (*MongoStorage, e
 
 	return newMongoStorage(client, client.Database(dbName)), nil
 }
+
+// setFields converts v into a document suitable for $set, leaving out the
+// given fields so they can't be overwritten by a client payload.
+func setFields(v interface{}, exclude ...string) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bson.M{}
+	err = bson.Unmarshal(raw, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range exclude {
+		delete(fields, field)
+	}
+
+	return fields, nil
+}
+
+// objectID parses the hex id of a document, an invalid id is a bad request.
+func objectID(hex string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return id, apperror.InvalidID(err)
+	}
+
+	return id, nil
+}
+
+// notFound turns mongo.ErrNoDocuments into a NotFound error for the resource.
+func notFound(err error, resource string) error {
+	if err == mongo.ErrNoDocuments {
+		return apperror.NotFound(resource)
+	}
+
+	return err
+}
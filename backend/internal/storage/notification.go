@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NotificationStorage holds the notification preferences of users and the
+// outbox of emails waiting to be sent.
+type NotificationStorage interface {
+	// GetNotificationPreferences returns empty preferences for users that
+	// never set theirs.
+	GetNotificationPreferences(userID string) (*data.NotificationPreferences, error)
+	UpdateNotificationPreferences(prefs *data.NotificationPreferences) (*data.NotificationPreferences, error)
+	EnqueueEmail(email *data.Email) (*data.Email, error)
+	// ClaimDueEmail returns the pending email due the longest and pushes
+	// it back by lease, so other senders skip it while it is being sent.
+	// It returns nil when no email is due.
+	ClaimDueEmail(now time.Time, lease time.Duration) (*data.Email, error)
+	// MarkEmailSent and MarkEmailFailed clear the body of password reset
+	// emails once they are sent or given up on, it holds a reset link.
+	MarkEmailSent(id primitive.ObjectID, at time.Time) error
+	// MarkEmailFailed counts a failed attempt, the email is retried at
+	// retryAt or given up on when it is nil.
+	MarkEmailFailed(id primitive.ObjectID, reason string, retryAt *time.Time) error
+}
+
+type mongoNotificationStorage struct {
+	db *mongo.Database
+}
+
+func NewNotificationStorage(db *mongo.Database) *mongoNotificationStorage {
+	return &mongoNotificationStorage{db: db}
+}
+
+func (p *mongoNotificationStorage) GetNotificationPreferences(userID string) (*data.NotificationPreferences, error) {
+	prefs := &data.NotificationPreferences{}
+	err := p.db.Collection("notification_preferences").FindOne(context.TODO(), bson.M{"_id": userID}).Decode(prefs)
+	if err == mongo.ErrNoDocuments {
+		return &data.NotificationPreferences{UserID: userID, OptOut: []data.NotificationEvent{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (p *mongoNotificationStorage) UpdateNotificationPreferences(prefs *data.NotificationPreferences) (*data.NotificationPreferences, error) {
+	_, err := p.db.Collection("notification_preferences").ReplaceOne(context.TODO(), bson.M{"_id": prefs.UserID}, prefs, options.Replace().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (p *mongoNotificationStorage) EnqueueEmail(email *data.Email) (*data.Email, error) {
+	email.ID = primitive.NilObjectID
+	email.Status = data.EmailPending
+	email.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if email.NextAttemptAt == 0 {
+		email.NextAttemptAt = email.CreatedAt
+	}
+
+	res, err := p.db.Collection("email_outbox").InsertOne(context.TODO(), email)
+	if err != nil {
+		return nil, err
+	}
+
+	email.ID = res.InsertedID.(primitive.ObjectID)
+	return email, nil
+}
+
+func (p *mongoNotificationStorage) ClaimDueEmail(now time.Time, lease time.Duration) (*data.Email, error) {
+	email := &data.Email{}
+	err := p.db.Collection("email_outbox").FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"status": data.EmailPending, "nextattemptat": bson.M{"$lte": primitive.NewDateTimeFromTime(now)}},
+		bson.M{"$set": bson.M{"nextattemptat": primitive.NewDateTimeFromTime(now.Add(lease))}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextattemptat": 1}),
+	).Decode(email)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+func (p *mongoNotificationStorage) MarkEmailSent(id primitive.ObjectID, at time.Time) error {
+	_, err := p.db.Collection("email_outbox").UpdateByID(context.TODO(), id, bson.M{"$set": bson.M{
+		"status": data.EmailSent,
+		"sentat": primitive.NewDateTimeFromTime(at),
+	}})
+	if err != nil {
+		return err
+	}
+
+	return p.clearResetLink(id)
+}
+
+func (p *mongoNotificationStorage) MarkEmailFailed(id primitive.ObjectID, reason string, retryAt *time.Time) error {
+	set := bson.M{"lasterror": reason}
+	if retryAt == nil {
+		set["status"] = data.EmailFailed
+	} else {
+		set["nextattemptat"] = primitive.NewDateTimeFromTime(*retryAt)
+	}
+
+	_, err := p.db.Collection("email_outbox").UpdateByID(context.TODO(), id, bson.M{"$set": set, "$inc": bson.M{"attempts": 1}})
+	if err != nil || retryAt != nil {
+		return err
+	}
+
+	return p.clearResetLink(id)
+}
+
+// clearResetLink empties the body of the email if it is a password reset.
+func (p *mongoNotificationStorage) clearResetLink(id primitive.ObjectID) error {
+	_, err := p.db.Collection("email_outbox").UpdateOne(context.TODO(), bson.M{"_id": id, "event": data.NotifyPasswordReset}, bson.M{"$set": bson.M{"body": ""}})
+	return err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryNotificationStorage keeps preferences and the outbox in memory.
+type memoryNotificationStorage struct {
+	mu     sync.RWMutex
+	prefs  map[string]*data.NotificationPreferences
+	emails map[primitive.ObjectID]*data.Email
+}
+
+func NewMemoryNotificationStorage() *memoryNotificationStorage {
+	return &memoryNotificationStorage{
+		prefs:  map[string]*data.NotificationPreferences{},
+		emails: map[primitive.ObjectID]*data.Email{},
+	}
+}
+
+func (p *memoryNotificationStorage) GetNotificationPreferences(userID string) (*data.NotificationPreferences, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	prefs, ok := p.prefs[userID]
+	if !ok {
+		return &data.NotificationPreferences{UserID: userID, OptOut: []data.NotificationEvent{}}, nil
+	}
+
+	res := *prefs
+	res.OptOut = append([]data.NotificationEvent{}, prefs.OptOut...)
+	return &res, nil
+}
+
+func (p *memoryNotificationStorage) UpdateNotificationPreferences(prefs *data.NotificationPreferences) (*data.NotificationPreferences, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored := *prefs
+	stored.OptOut = append([]data.NotificationEvent{}, prefs.OptOut...)
+	p.prefs[prefs.UserID] = &stored
+	return prefs, nil
+}
+
+func (p *memoryNotificationStorage) EnqueueEmail(email *data.Email) (*data.Email, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	email.ID = primitive.NewObjectID()
+	email.Status = data.EmailPending
+	email.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if email.NextAttemptAt == 0 {
+		email.NextAttemptAt = email.CreatedAt
+	}
+
+	stored := *email
+	p.emails[email.ID] = &stored
+	return email, nil
+}
+
+func (p *memoryNotificationStorage) ClaimDueEmail(now time.Time, lease time.Duration) (*data.Email, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	due := primitive.NewDateTimeFromTime(now)
+	var claimed *data.Email
+	for _, email := range p.emails {
+		if email.Status != data.EmailPending || email.NextAttemptAt > due {
+			continue
+		}
+		if claimed == nil || email.NextAttemptAt < claimed.NextAttemptAt {
+			claimed = email
+		}
+	}
+
+	if claimed == nil {
+		return nil, nil
+	}
+
+	res := *claimed
+	claimed.NextAttemptAt = primitive.NewDateTimeFromTime(now.Add(lease))
+	return &res, nil
+}
+
+func (p *memoryNotificationStorage) MarkEmailSent(id primitive.ObjectID, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if email, ok := p.emails[id]; ok {
+		sentAt := primitive.NewDateTimeFromTime(at)
+		email.Status = data.EmailSent
+		email.SentAt = &sentAt
+		clearResetLink(email)
+	}
+	return nil
+}
+
+func (p *memoryNotificationStorage) MarkEmailFailed(id primitive.ObjectID, reason string, retryAt *time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	email, ok := p.emails[id]
+	if !ok {
+		return nil
+	}
+
+	email.Attempts++
+	email.LastError = reason
+	if retryAt == nil {
+		email.Status = data.EmailFailed
+		clearResetLink(email)
+	} else {
+		email.NextAttemptAt = primitive.NewDateTimeFromTime(*retryAt)
+	}
+	return nil
+}
+
+// clearResetLink empties the body of the email if it is a password reset.
+func clearResetLink(email *data.Email) {
+	if email.Event == data.NotifyPasswordReset {
+		email.Body = ""
+	}
+}
+
+// Emails returns every email of the outbox in the order they were queued, for
+// tests.
+func (p *memoryNotificationStorage) Emails() []*data.Email {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	res := []*data.Email{}
+	for _, email := range p.emails {
+		stored := *email
+		res = append(res, &stored)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID.Hex() < res[j].ID.Hex() })
+	return res
+}
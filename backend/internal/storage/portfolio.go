@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PortfolioSummary aggregates the projects ListProjects would return for the
+// same filter and list options.
+func (p *MongoProjectStorage) PortfolioSummary(filter bson.M, opts ProjectListOptions) (*data.PortfolioSummary, error) {
+	conditions := append(projectListConditions(filter, opts), bson.M{"deletedat": nil}, notExpiredFilter())
+
+	totals := bson.M{
+		"_id":             nil,
+		"projects":        bson.M{"$sum": 1},
+		"contractedvalue": bson.M{"$sum": "$metrics.commercialinformation.cicontractedvalue"},
+		"accrualtodate":   bson.M{"$sum": "$metrics.commercialinformation.ciaccrualtodate"},
+		"p50outturncost":  bson.M{"$sum": "$currentcost.p50outturncost"},
+		"p90outturncost":  bson.M{"$sum": "$currentcost.p90outturncost"},
+	}
+
+	overdue := bson.A{
+		bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{"$scope.estimatedcompletiondate", primitive.DateTime(0)}},
+			bson.M{"$gt": bson.A{"$anticipatedcompletiondate", "$scope.estimatedcompletiondate"}},
+		}}}},
+		bson.M{"$sort": bson.D{{Key: "anticipatedcompletiondate", Value: 1}, {Key: "_id", Value: 1}}},
+		bson.M{"$project": bson.M{
+			"name":                      1,
+			"client":                    1,
+			"region":                    1,
+			"estimatedcompletiondate":   "$scope.estimatedcompletiondate",
+			"anticipatedcompletiondate": 1,
+		}},
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": conditions}}},
+		{{Key: "$lookup", Value: milestoneLookup("currentmilestone", bson.M{"actualdate": nil}, 1)}},
+		{{Key: "$lookup", Value: milestoneLookup("lastmilestone", bson.M{}, -1)}},
+		{{Key: "$addFields", Value: bson.M{
+			"currentcost":               currentCostExpr(),
+			"anticipatedcompletiondate": anticipatedCompletionExpr(),
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"bystatus": countBy(bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$status", ""}}, ""}},
+				data.StatusActive,
+				"$status",
+			}}),
+			"byregion": countBy("$region"),
+			"byclient": countBy("$client"),
+			"totals":   bson.A{bson.M{"$group": totals}},
+			"overdue":  overdue,
+		}}},
+	}
+
+	cursor, err := p.db.Collection("projects").Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	facets := []struct {
+		ByStatus []data.PortfolioCount
+		ByRegion []data.PortfolioCount
+		ByClient []data.PortfolioCount
+		Totals   []struct {
+			Projects        int
+			ContractedValue float64
+			AccrualToDate   float64
+			P50OutturnCost  float64
+			P90OutturnCost  float64
+		}
+		Overdue []*data.OverdueProject
+	}{}
+	err = cursor.All(context.TODO(), &facets)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := newPortfolioSummary()
+	if len(facets) == 0 {
+		return summary, nil
+	}
+
+	facet := facets[0]
+	summary.ByStatus = append(summary.ByStatus, facet.ByStatus...)
+	summary.ByRegion = append(summary.ByRegion, facet.ByRegion...)
+	summary.ByClient = append(summary.ByClient, facet.ByClient...)
+	summary.Overdue = append(summary.Overdue, facet.Overdue...)
+	if len(facet.Totals) > 0 {
+		totals := facet.Totals[0]
+		summary.Projects = totals.Projects
+		summary.Commercial.ContractedValue = totals.ContractedValue
+		summary.Commercial.AccrualToDate = totals.AccrualToDate
+		summary.P50OutturnCost = totals.P50OutturnCost
+		summary.P90OutturnCost = totals.P90OutturnCost
+	}
+
+	return summary, nil
+}
+
+func newPortfolioSummary() *data.PortfolioSummary {
+	return &data.PortfolioSummary{
+		ByStatus:   []data.PortfolioCount{},
+		ByRegion:   []data.PortfolioCount{},
+		ByClient:   []data.PortfolioCount{},
+		Commercial: &data.PortfolioCommercial{},
+		Overdue:    []*data.OverdueProject{},
+	}
+}
+
+// countBy is a pipeline counting the documents by the value of expr, the most
+// common first.
+func countBy(expr interface{}) bson.A {
+	return bson.A{
+		bson.M{"$group": bson.M{"_id": expr, "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$project": bson.M{"_id": 0, "key": "$_id", "count": 1}},
+	}
+}
+
+// milestoneLookup looks up as field the first milestone of the project
+// matching filter, by planned date in the given order.
+func milestoneLookup(as string, filter bson.M, order int) bson.M {
+	return bson.M{
+		"from": "project_milestones",
+		"let":  bson.M{"project": "$_id"},
+		"pipeline": bson.A{
+			bson.M{"$match": bson.M{"$and": bson.A{bson.M{"$expr": bson.M{"$eq": bson.A{"$projectid", "$$project"}}}, filter}}},
+			bson.M{"$sort": bson.D{{Key: "planneddate", Value: order}, {Key: "_id", Value: order}}},
+			bson.M{"$limit": 1},
+			bson.M{"$project": bson.M{"cost": 1}},
+		},
+		"as": as,
+	}
+}
+
+// currentCostExpr is the cost of the current milestone, the same as
+// analytics.CurrentCost: the first milestone not reached, or else the last
+// one. Projects without milestones fall back to their cost rows, the flagged
+// row or else the latest one.
+func currentCostExpr() bson.M {
+	rows := bson.M{"$ifNull": bson.A{"$metrics.totalprojectcostpermilestone", bson.A{}}}
+	latest := bson.M{"$reduce": bson.M{
+		"input":        rows,
+		"initialValue": nil,
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"$eq": bson.A{"$$value", nil}},
+				bson.M{"$gt": bson.A{"$$this.date", "$$value.date"}},
+			}},
+			"$$this",
+			"$$value",
+		}},
+	}}
+
+	fromRows := bson.M{"$let": bson.M{
+		"vars": bson.M{"flagged": bson.M{"$filter": bson.M{"input": rows, "cond": "$$this.currentmilstone"}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{bson.M{"$size": "$$flagged"}, 0}},
+			bson.M{"$arrayElemAt": bson.A{"$$flagged", 0}},
+			latest,
+		}},
+	}}
+
+	return bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{"case": bson.M{"$gt": bson.A{bson.M{"$size": "$currentmilestone"}, 0}}, "then": bson.M{"$arrayElemAt": bson.A{"$currentmilestone.cost", 0}}},
+			bson.M{"case": bson.M{"$gt": bson.A{bson.M{"$size": "$lastmilestone"}, 0}}, "then": bson.M{"$arrayElemAt": bson.A{"$lastmilestone.cost", 0}}},
+		},
+		"default": fromRows,
+	}}
+}
+
+// anticipatedCompletionExpr is the latest anticipated completion of the
+// workstreams in scope, the same as analytics.AnticipatedCompletion.
+func anticipatedCompletionExpr() bson.M {
+	workstreams := []string{"quantification", "costestimation", "probabilisticriskassessment", "basisofestimatereport"}
+
+	dates := bson.A{}
+	for _, workstream := range workstreams {
+		dates = append(dates, bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$scope." + workstream, true}},
+			"$metrics.anticipatedcompletiondate." + workstream,
+			nil,
+		}})
+	}
+
+	return bson.M{"$max": dates}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/utils"
+)
+
+// memoryPreferenceStorage keeps the preferences in memory.
+type memoryPreferenceStorage struct {
+	mu            sync.RWMutex
+	organisations []string
+}
+
+func NewMemoryPreferenceStorage() *memoryPreferenceStorage {
+	return &memoryPreferenceStorage{organisations: []string{}}
+}
+
+func (p *memoryPreferenceStorage) GetOrganisations() ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]string{}, p.organisations...), nil
+}
+
+func (p *memoryPreferenceStorage) AddOrganisation(organisation string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !utils.Contains(p.organisations, organisation) {
+		p.organisations = append(p.organisations, organisation)
+	}
+
+	return nil
+}
@@ -2,70 +2,107 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"time"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProjectStorage interface {
 	GetProject(hex string) (*data.Project, error)
 	GetProjects(filter bson.M) ([]*data.Project, error)
+	ListProjects(filter bson.M, opts ProjectListOptions) (*data.Page[*data.ProjectSummary], error)
+	PortfolioSummary(filter bson.M, opts ProjectListOptions) (*data.PortfolioSummary, error)
 	CreateProject(project *data.Project) (*data.Project, error)
-	UpdateProject(hex string, project *data.Project) (*data.Project, error)
-	UpdateMetrics(hex string, metrics *data.Metrics) (*data.Metrics, error)
-	MarkCompleted(hex string, date primitive.DateTime) (*data.Project, error)
-	DeleteProject(hex string) error
+	UpdateProject(hex string, project *data.Project, revision int) (*data.Project, error)
+	UpdateMetrics(hex string, metrics *data.Metrics, revision int, author data.Member, reason string) (*data.Metrics, error)
+	UpdateStatus(hex string, change data.StatusChange, completionDate primitive.DateTime) (*data.Project, error)
+	UpdateClientVisibility(hex string, sections []data.MetricsSection) (*data.Project, error)
+	DeleteProject(hex string, deletedBy string) error
+	GetTrashedProjects() ([]*data.Project, error)
+	RestoreProject(hex string) error
+	PurgeProject(hex string) error
+	PurgeTrashedProjects(before time.Time) (int64, error)
+	ArchiveExpired(now time.Time) ([]*data.Project, error)
+	GetExpiringProjects(before time.Time) ([]*data.Project, error)
+	MarkExpiryWarned(hex string, at time.Time) error
+	ExtendAccess(hex string, days int, by data.Member) (*data.Project, error)
 }
 
+// ProjectListOptions controls paging, sorting and filtering of ListProjects.
+// Zero values mean no filter.
+type ProjectListOptions struct {
+	Limit     int
+	Cursor    string
+	Sort      string
+	Desc      bool
+	Status    string
+	Region    string
+	Client    string
+	Lead      string
+	StartFrom time.Time
+	StartTo   time.Time
+}
+
+// projectSortFields maps the sort keys accepted by ListProjects to the stored
+// field names.
+var projectSortFields = map[string]string{
+	"name":      "name",
+	"startDate": "startdate",
+	"status":    "status",
+	"client":    "client",
+	"region":    "region",
+}
+
+var ErrInvalidSort = apperror.BadRequest("invalid sort field")
+var ErrInvalidCursor = apperror.BadRequest("invalid cursor")
+
+// ErrRevisionMismatch is returned when a project was changed by someone else
+// since the revision the caller based its update on.
+var ErrRevisionMismatch = apperror.PreconditionFailed("project revision mismatch")
+
+// ErrNotCompleted is returned when extending access to or reopening a project
+// that isn't completed or archived.
+var ErrNotCompleted = apperror.Conflict("project is not completed")
+
+// ErrStatusChanged is returned when a project's status was changed by someone
+// else since it was read.
+var ErrStatusChanged = apperror.Conflict("project status changed")
+
 type MongoProjectStorage struct {
 	db          *mongo.Database
 	userStorage UserStorage
+	history     MetricsHistoryStorage
 }
 
 func NewProjectStorage(db *mongo.Database, userStorage UserStorage) *MongoProjectStorage {
-	return &MongoProjectStorage{db: db, userStorage: userStorage}
+	return &MongoProjectStorage{db: db, userStorage: userStorage, history: NewMetricsHistoryStorage(db)}
 }
 
 func (p *MongoProjectStorage) GetProject(hex string) (*data.Project, error) {
-	users, err := p.userStorage.GetAll()
+	users, err := usersByID(p.userStorage)
 	if err != nil {
 		return nil, err
 	}
 
-	id, err := primitive.ObjectIDFromHex(hex)
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
 	project := &data.Project{}
-	err = p.db.Collection("projects").FindOne(context.TODO(), bson.M{"_id": id}).Decode(project)
+	err = p.db.Collection("projects").FindOne(context.TODO(), bson.M{"_id": id, "deletedat": nil}).Decode(project)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, "project")
 	}
 
-	for _, user := range users {
-		if user.ID == project.ClientRepresentative.ID {
-			project.ClientRepresentative.FullName = user.FullName
-			project.ClientRepresentative.ClientRole = user.ClientRole
-		} else if user.ID == project.Team.ProjectLead.ID {
-			project.Team.ProjectLead.FullName = user.FullName
-			project.Team.ProjectLead.Email = user.Email
-			project.Team.ProjectLead.Avatar = user.Avatar
-			project.Team.ProjectLead.Bio = user.Bio
-		} else {
-			for i, member := range project.Team.TeamMembers {
-				if user.ID == member.ID {
-					project.Team.TeamMembers[i].FullName = user.FullName
-					project.Team.TeamMembers[i].Email = user.Email
-					project.Team.TeamMembers[i].Avatar = user.Avatar
-					project.Team.TeamMembers[i].Bio = user.Bio
-				}
-			}
-		}
-	}
+	fillMembers(project, users)
 
 	// data.team.projectLead = getUserInfo(data.team.projectLead.id);
 	// data.team.teamMembers = data.team.teamMembers.map((m) => {
@@ -77,12 +114,12 @@ func (p *MongoProjectStorage) GetProject(hex string) (*data.Project, error) {
 }
 
 func (p *MongoProjectStorage) GetProjects(filter bson.M) ([]*data.Project, error) {
-	users, err := p.userStorage.GetAll()
+	users, err := usersByID(p.userStorage)
 	if err != nil {
 		return nil, err
 	}
 
-	cursor, err := p.db.Collection("projects").Find(context.TODO(), filter)
+	cursor, err := p.db.Collection("projects").Find(context.TODO(), bson.M{"$and": bson.A{filter, bson.M{"deletedat": nil}}})
 
 	if err != nil {
 		return nil, err
@@ -98,19 +135,12 @@ func (p *MongoProjectStorage) GetProjects(filter bson.M) ([]*data.Project, error
 		}
 
 		// "expired" projects shouldn't be shown
-		if project.Status == "completed" {
-			availableUntilDate := project.CompletionDate.Time().AddDate(0, 0, project.Scope.RemainsAccessibleForNDays)
-			if time.Now().After(availableUntilDate) {
-				continue
-			}
+		if project.AccessExpired(time.Now()) {
+			continue
 		}
 
-		// find user by id for project lead
-		for _, user := range users {
-			if user.ID == project.Team.ProjectLead.ID {
-				project.Team.ProjectLead.FullName = user.FullName
-				break
-			}
+		if user, ok := users[project.Team.ProjectLead.ID]; ok {
+			project.Team.ProjectLead.FullName = user.FullName
 		}
 
 		projects = append(projects, project)
@@ -119,6 +149,142 @@ func (p *MongoProjectStorage) GetProjects(filter bson.M) ([]*data.Project, error
 	return projects, nil
 }
 
+// ListProjects returns one page of project summaries matching filter and the
+// list options. Pages are keyed on the sort field and the project id, so the
+// cursor stays valid while projects are added or removed.
+func (p *MongoProjectStorage) ListProjects(filter bson.M, opts ProjectListOptions) (*data.Page[*data.ProjectSummary], error) {
+	sortField := "name"
+	if opts.Sort != "" {
+		field, ok := projectSortFields[opts.Sort]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
+		sortField = field
+	}
+
+	conditions := append(projectListConditions(filter, opts), bson.M{"deletedat": nil}, notExpiredFilter())
+
+	query := bson.M{"$and": conditions}
+	total, err := p.db.Collection("projects").CountDocuments(context.TODO(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Cursor != "" {
+		after, err := cursorFilter(opts.Cursor, sortField, opts.Desc)
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"$and": append(conditions, after)}
+	}
+
+	direction := 1
+	if opts.Desc {
+		direction = -1
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(opts.Limit) + 1).
+		SetProjection(bson.M{
+			"name":                                 1,
+			"client":                               1,
+			"region":                               1,
+			"ciprojectnumber":                      1,
+			"clientprojectnumber":                  1,
+			"team.projectlead":                     1,
+			"scope.estimatedcompletiondate":        1,
+			"startdate":                            1,
+			"completiondate":                       1,
+			"status":                               1,
+			"metrics.totalprojectcostpermilestone": 1,
+		})
+
+	cursor, err := p.db.Collection("projects").Find(context.TODO(), query, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	projects := []*data.Project{}
+	for cursor.Next(context.TODO()) {
+		project := &data.Project{}
+		err := cursor.Decode(project)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	page := &data.Page[*data.ProjectSummary]{Items: []*data.ProjectSummary{}, Total: total}
+	if len(projects) > opts.Limit {
+		projects = projects[:opts.Limit]
+		last := projects[len(projects)-1]
+		page.NextCursor, err = encodeCursor(sortValue(last, sortField), last.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(projects) == 0 {
+		return page, nil
+	}
+
+	users, err := usersByID(p.userStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, project := range projects {
+		ids = append(ids, project.ID)
+	}
+	milestones, err := milestonesByProject(p.db, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, project := range projects {
+		summary := project.Summary(milestones[project.ID])
+		if user, ok := users[summary.ProjectLead.ID]; ok {
+			summary.ProjectLead.FullName = user.FullName
+		}
+		page.Items = append(page.Items, summary)
+	}
+
+	return page, nil
+}
+
+// projectListConditions returns the conditions of filter and the filters in
+// the list options.
+func projectListConditions(filter bson.M, opts ProjectListOptions) bson.A {
+	conditions := bson.A{filter}
+	if opts.Status != "" {
+		conditions = append(conditions, bson.M{"status": statusCondition(opts.Status)})
+	}
+	if opts.Region != "" {
+		conditions = append(conditions, bson.M{"region": opts.Region})
+	}
+	if opts.Client != "" {
+		conditions = append(conditions, bson.M{"client": opts.Client})
+	}
+	if opts.Lead != "" {
+		conditions = append(conditions, bson.M{"team.projectlead.id": opts.Lead})
+	}
+	// archived projects are only listed when asked for
+	if opts.Status != data.StatusArchived {
+		conditions = append(conditions, bson.M{"status": bson.M{"$ne": data.StatusArchived}})
+	}
+	if !opts.StartFrom.IsZero() {
+		conditions = append(conditions, bson.M{"startdate": bson.M{"$gte": primitive.NewDateTimeFromTime(opts.StartFrom)}})
+	}
+	if !opts.StartTo.IsZero() {
+		conditions = append(conditions, bson.M{"startdate": bson.M{"$lte": primitive.NewDateTimeFromTime(opts.StartTo)}})
+	}
+
+	return conditions
+}
+
 // CreateProject creates a new project and returns the new project
 func (p *MongoProjectStorage) CreateProject(project *data.Project) (*data.Project, error) {
 	res, err := p.db.Collection("projects").InsertOne(context.TODO(), project)
@@ -130,60 +296,613 @@ func (p *MongoProjectStorage) CreateProject(project *data.Project) (*data.Projec
 	return project, nil
 }
 
-func (p *MongoProjectStorage) UpdateProject(hex string, project *data.Project) (*data.Project, error) {
-	id, err := primitive.ObjectIDFromHex(hex)
+// UpdateProject replaces the project if it is still at the given revision and
+// returns it as stored, otherwise ErrRevisionMismatch is returned and nothing
+// is written.
+func (p *MongoProjectStorage) UpdateProject(hex string, project *data.Project, revision int) (*data.Project, error) {
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
-	// ignore the id field
-	_, err = p.db.Collection("projects").UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": project})
+	// the revision and metrics version are only ever bumped by the storage,
+	// metrics, client visibility, deletion, status and the lifecycle,
+	// including the completion date access runs from, have their own
+	// endpoints
+	update, err := setFields(project, "revision", "metrics", "metricsversion", "clientvisiblesections", "deletedat", "deletedby", "status", "statushistory", "completiondate", "archivedat", "expirywarnedat")
 	if err != nil {
 		return nil, err
 	}
 
-	return project, nil
+	// ignore the id field
+	res := &data.Project{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = p.db.Collection("projects").FindOneAndUpdate(
+		context.TODO(),
+		revisionFilter(id, revision),
+		bson.M{"$set": update, "$inc": bson.M{"revision": 1}},
+		opts,
+	).Decode(res)
+	if err == mongo.ErrNoDocuments {
+		return nil, p.missingOrStale(id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
 
-func (p *MongoProjectStorage) UpdateMetrics(hex string, metrics *data.Metrics) (*data.Metrics, error) {
-	id, err := primitive.ObjectIDFromHex(hex)
+// UpdateMetrics replaces the metrics of a project and records the new metrics
+// as the next version in the project's metrics history. The snapshot is
+// written first and removed again when the metrics can't be, so no version is
+// ever stored without its history entry.
+func (p *MongoProjectStorage) UpdateMetrics(hex string, metrics *data.Metrics, revision int, author data.Member, reason string) (*data.Metrics, error) {
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = p.db.Collection("projects").UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"metrics": metrics}})
+	// the metrics version only changes along with the revision, so the next
+	// version is known for as long as the project is at this revision
+	current := &data.Project{}
+	opts := options.FindOne().SetProjection(bson.M{"metricsversion": 1})
+	err = p.db.Collection("projects").FindOne(context.TODO(), revisionFilter(id, revision), opts).Decode(current)
+	if err == mongo.ErrNoDocuments {
+		return nil, p.missingOrStale(id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := p.history.CreateSnapshot(&data.MetricsSnapshot{
+		ProjectID: id,
+		Version:   current.MetricsVersion + 1,
+		Author:    author,
+		Reason:    reason,
+		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
+		Metrics:   metrics,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	res, err := p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		revisionFilter(id, revision),
+		bson.M{"$set": bson.M{"metrics": metrics}, "$inc": bson.M{"metricsversion": 1, "revision": 1}},
+	)
+	if err == nil && res.MatchedCount == 0 {
+		err = p.missingOrStale(id)
+	}
+	if err != nil {
+		p.deleteSnapshot(snapshot.ID)
+		return nil, err
+	}
+
 	return metrics, nil
 }
 
-func (p *MongoProjectStorage) MarkCompleted(hex string, date primitive.DateTime) (*data.Project, error) {
-	id, err := primitive.ObjectIDFromHex(hex)
+// deleteSnapshot undoes the snapshot of a metrics update that failed.
+func (p *MongoProjectStorage) deleteSnapshot(id primitive.ObjectID) {
+	_, err := p.db.Collection("project_metrics_history").DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		fmt.Println("error removing the snapshot of a failed metrics update", id.Hex(), err)
+	}
+}
+
+// UpdateStatus moves a project from change.From to change.To and adds the
+// change to its status history. ErrStatusChanged is returned when the project
+// is no longer in change.From.
+func (p *MongoProjectStorage) UpdateStatus(hex string, change data.StatusChange, completionDate primitive.DateTime) (*data.Project, error) {
+	id, err := objectID(hex)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = p.db.Collection("projects").UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": bson.M{"status": "completed", "completiondate": date}})
+	set, unset := statusFields(change, completionDate)
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"statushistory": change},
+		"$inc":  bson.M{"revision": 1},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
 
+	res, err := p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil, "status": statusCondition(change.From)},
+		update,
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	if res.MatchedCount == 0 {
+		count, err := p.db.Collection("projects").CountDocuments(context.TODO(), bson.M{"_id": id, "deletedat": nil})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, apperror.NotFound("project")
+		}
+		return nil, ErrStatusChanged
+	}
+
 	return p.GetProject(hex)
 }
 
-func (p *MongoProjectStorage) DeleteProject(hex string) error {
-	id, err := primitive.ObjectIDFromHex(hex)
+// statusFields returns the fields to set and unset when making the status
+// change. Completing a project sets its completion date and moving it back in
+// progress clears it along with the rest of the lifecycle fields.
+func statusFields(change data.StatusChange, completionDate primitive.DateTime) (set bson.M, unset bson.M) {
+	set = bson.M{"status": change.To}
+	unset = bson.M{}
+
+	switch change.To {
+	case data.StatusCompleted:
+		set["completiondate"] = completionDate
+	case data.StatusArchived:
+		set["archivedat"] = change.ChangedAt
+	default:
+		if change.From == data.StatusCompleted || change.From == data.StatusArchived {
+			unset["completiondate"] = ""
+			unset["archivedat"] = ""
+			unset["expirywarnedat"] = ""
+		}
+	}
+
+	return set, unset
+}
+
+// statusCondition matches the projects in the given status. Projects created
+// before statuses were introduced have none and are active.
+func statusCondition(status string) interface{} {
+	if status == data.StatusActive {
+		return bson.M{"$in": bson.A{data.StatusActive, "", nil}}
+	}
+
+	return status
+}
+
+// UpdateClientVisibility replaces the sections the client representative has
+// been opted into seeing.
+func (p *MongoProjectStorage) UpdateClientVisibility(hex string, sections []data.MetricsSection) (*data.Project, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil},
+		bson.M{"$set": bson.M{"clientvisiblesections": sections}, "$inc": bson.M{"revision": 1}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetProject(hex)
+}
+
+// DeleteProject moves the project to the trash, it stays there until it is
+// restored or purged.
+func (p *MongoProjectStorage) DeleteProject(hex string, deletedBy string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil},
+		bson.M{"$set": bson.M{"deletedat": primitive.NewDateTimeFromTime(time.Now()), "deletedby": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("project")
+	}
+
+	return nil
+}
+
+func (p *MongoProjectStorage) GetTrashedProjects() ([]*data.Project, error) {
+	opts := options.Find().
+		SetSort(bson.M{"deletedat": -1}).
+		SetProjection(bson.M{"metrics": 0})
+
+	cursor, err := p.db.Collection("projects").Find(context.TODO(), bson.M{"deletedat": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	projects := []*data.Project{}
+	for cursor.Next(context.TODO()) {
+		project := &data.Project{}
+		err := cursor.Decode(project)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+func (p *MongoProjectStorage) RestoreProject(hex string) error {
+	id, err := objectID(hex)
 	if err != nil {
 		return err
 	}
 
-	_, err = p.db.Collection("projects").DeleteOne(context.TODO(), bson.M{"_id": id})
+	res, err := p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deletedat": "", "deletedby": ""}, "$inc": bson.M{"revision": 1}},
+	)
 	if err != nil {
 		return err
 	}
 
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("project")
+	}
+
 	return nil
 }
+
+// PurgeProject permanently deletes a trashed project along with its metrics
+// history.
+func (p *MongoProjectStorage) PurgeProject(hex string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("projects").DeleteOne(context.TODO(), bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return apperror.NotFound("project")
+	}
+
+	_, err = p.db.Collection("project_metrics_history").DeleteMany(context.TODO(), bson.M{"projectid": id})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Collection("project_milestones").DeleteMany(context.TODO(), bson.M{"projectid": id})
+	return err
+}
+
+// PurgeTrashedProjects permanently deletes the projects trashed before the
+// given time and returns how many were deleted.
+func (p *MongoProjectStorage) PurgeTrashedProjects(before time.Time) (int64, error) {
+	cursor, err := p.db.Collection("projects").Find(
+		context.TODO(),
+		bson.M{"deletedat": bson.M{"$ne": nil, "$lt": primitive.NewDateTimeFromTime(before)}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var purged int64
+	for cursor.Next(context.TODO()) {
+		project := &data.Project{}
+		err := cursor.Decode(project)
+		if err != nil {
+			return purged, err
+		}
+
+		err = p.PurgeProject(project.ID.Hex())
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// ArchiveExpired archives the completed projects whose access period ended
+// before now and returns them.
+func (p *MongoProjectStorage) ArchiveExpired(now time.Time) ([]*data.Project, error) {
+	projects, err := p.findCompleted(bson.M{"$expr": accessEndsBefore(now)})
+	if err != nil {
+		return nil, err
+	}
+
+	archivedAt := primitive.NewDateTimeFromTime(now)
+	change := data.StatusChange{
+		From:      data.StatusCompleted,
+		To:        data.StatusArchived,
+		ChangedBy: data.SystemMember,
+		ChangedAt: archivedAt,
+		Reason:    "access period ended",
+	}
+	archived := []*data.Project{}
+	for _, project := range projects {
+		// skip projects reopened or extended since they were read
+		res, err := p.db.Collection("projects").UpdateOne(
+			context.TODO(),
+			bson.M{"_id": project.ID, "status": data.StatusCompleted, "deletedat": nil, "$expr": accessEndsBefore(now)},
+			bson.M{
+				"$set":  bson.M{"status": data.StatusArchived, "archivedat": archivedAt},
+				"$push": bson.M{"statushistory": change},
+				"$inc":  bson.M{"revision": 1},
+			},
+		)
+		if err != nil {
+			return archived, err
+		}
+
+		if res.ModifiedCount > 0 {
+			project.Status = data.StatusArchived
+			project.ArchivedAt = &archivedAt
+			project.StatusHistory = append(project.StatusHistory, change)
+			project.Revision++
+			archived = append(archived, project)
+		}
+	}
+
+	return archived, nil
+}
+
+// GetExpiringProjects returns the completed projects whose access period ends
+// before the given time and whose lead and client representative haven't been
+// warned yet.
+func (p *MongoProjectStorage) GetExpiringProjects(before time.Time) ([]*data.Project, error) {
+	return p.findCompleted(bson.M{"expirywarnedat": nil, "$expr": accessEndsBefore(before)})
+}
+
+func (p *MongoProjectStorage) findCompleted(filter bson.M) ([]*data.Project, error) {
+	filter["status"] = data.StatusCompleted
+	filter["deletedat"] = nil
+
+	cursor, err := p.db.Collection("projects").Find(context.TODO(), filter, options.Find().SetProjection(bson.M{"metrics": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	projects := []*data.Project{}
+	for cursor.Next(context.TODO()) {
+		project := &data.Project{}
+		err := cursor.Decode(project)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+func (p *MongoProjectStorage) MarkExpiryWarned(hex string, at time.Time) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"expirywarnedat": primitive.NewDateTimeFromTime(at)}},
+	)
+	return err
+}
+
+// ExtendAccess lengthens the access period of a completed or archived project
+// by the given number of days. Archived projects are completed again, which is
+// recorded in their status history as made by the given member, and the lead
+// and client representative will be warned again before the new end.
+func (p *MongoProjectStorage) ExtendAccess(hex string, days int, by data.Member) (*data.Project, error) {
+	change := data.StatusChange{
+		From:      data.StatusArchived,
+		To:        data.StatusCompleted,
+		ChangedBy: by,
+		ChangedAt: primitive.NewDateTimeFromTime(time.Now()),
+		Reason:    "access extended",
+	}
+	archived := bson.M{"$eq": bson.A{"$status", data.StatusArchived}}
+
+	// a single update, so the project is never completed again without the
+	// extension for the lifecycle worker to archive
+	return p.updateCompleted(hex, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"status": data.StatusCompleted,
+			"statushistory": bson.M{"$cond": bson.A{
+				archived,
+				bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$statushistory", bson.A{}}}, bson.A{bson.M{"$literal": change}}}},
+				"$statushistory",
+			}},
+			"scope.remainsaccessibleforndays": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$scope.remainsaccessibleforndays", 0}}, days}},
+			"revision":                        bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$revision", 0}}, 1}},
+		}}},
+		{{Key: "$unset", Value: bson.A{"archivedat", "expirywarnedat"}}},
+	})
+}
+
+// updateCompleted applies update, a document or a pipeline, to a completed or
+// archived project and returns the updated project.
+func (p *MongoProjectStorage) updateCompleted(hex string, update interface{}) (*data.Project, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.db.Collection("projects").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil, "status": bson.M{"$in": bson.A{data.StatusCompleted, data.StatusArchived}}},
+		update,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.MatchedCount == 0 {
+		count, err := p.db.Collection("projects").CountDocuments(context.TODO(), bson.M{"_id": id, "deletedat": nil})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, apperror.NotFound("project")
+		}
+		return nil, ErrNotCompleted
+	}
+
+	return p.GetProject(hex)
+}
+
+// revisionFilter matches the project only while it is at the given revision.
+// Projects created before revisions were introduced have no revision field
+// and are treated as revision 0.
+func revisionFilter(id primitive.ObjectID, revision int) bson.M {
+	if revision == 0 {
+		return bson.M{"_id": id, "deletedat": nil, "revision": bson.M{"$in": bson.A{0, nil}}}
+	}
+
+	return bson.M{"_id": id, "deletedat": nil, "revision": revision}
+}
+
+// missingOrStale tells apart a conditional update that matched nothing because
+// the project doesn't exist from one that lost to a concurrent write.
+func (p *MongoProjectStorage) missingOrStale(id primitive.ObjectID) error {
+	count, err := p.db.Collection("projects").CountDocuments(context.TODO(), bson.M{"_id": id, "deletedat": nil})
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return apperror.NotFound("project")
+	}
+
+	return ErrRevisionMismatch
+}
+
+// fillMembers fills in the details of the people on the project from the user
+// directory.
+func fillMembers(project *data.Project, users map[string]*data.User) {
+	if user, ok := users[project.ClientRepresentative.ID]; ok {
+		project.ClientRepresentative.FullName = user.FullName
+		project.ClientRepresentative.ClientRole = user.ClientRole
+	}
+
+	if user, ok := users[project.Team.ProjectLead.ID]; ok {
+		project.Team.ProjectLead = memberFromUser(user)
+	}
+
+	for i, member := range project.Team.TeamMembers {
+		if user, ok := users[member.ID]; ok {
+			project.Team.TeamMembers[i] = memberFromUser(user)
+		}
+	}
+}
+
+func memberFromUser(user *data.User) data.Member {
+	return data.Member{
+		ID:       user.ID,
+		FullName: user.FullName,
+		Email:    user.Email,
+		Avatar:   user.Avatar,
+		Bio:      user.Bio,
+	}
+}
+
+// expired reports whether the project is completed and its access period is
+// over but it hasn't been archived yet, the same as notExpiredFilter.
+func expired(project *data.Project, now time.Time) bool {
+	return project.Status == data.StatusCompleted && project.AccessExpired(now)
+}
+
+// notExpiredFilter leaves out completed projects whose access period is over.
+// The lifecycle worker archives them, this covers the time until it runs.
+func notExpiredFilter() bson.M {
+	return bson.M{"$expr": bson.M{"$not": bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$status", data.StatusCompleted}},
+		accessEndsBefore(time.Now()),
+	}}}}
+}
+
+// accessEndsBefore is an expression matching the projects whose access period
+// ends before t.
+func accessEndsBefore(t time.Time) bson.M {
+	accessibleUntil := bson.M{"$add": bson.A{
+		"$completiondate",
+		bson.M{"$multiply": bson.A{"$scope.remainsaccessibleforndays", 24 * 60 * 60 * 1000}},
+	}}
+
+	return bson.M{"$lt": bson.A{accessibleUntil, t}}
+}
+
+func sortValue(project *data.Project, field string) interface{} {
+	switch field {
+	case "startdate":
+		return project.StartDate
+	case "status":
+		return project.Status
+	case "client":
+		return project.Client
+	case "region":
+		return project.Region
+	default:
+		return project.Name
+	}
+}
+
+type listCursor struct {
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// encodeCursor packs the sort value and id of the last item of a page into an
+// opaque string. bson keeps the type of the value, e.g. dates stay dates.
+func encodeCursor(value interface{}, id primitive.ObjectID) (string, error) {
+	raw, err := bson.Marshal(listCursor{Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(encoded string) (listCursor, error) {
+	cursor := listCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	err = bson.Unmarshal(raw, &cursor)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// cursorFilter matches the items that come after the cursor in the given sort
+// order.
+func cursorFilter(encoded, field string, desc bool) (bson.M, error) {
+	cursor, err := decodeCursor(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	op := "$gt"
+	if desc {
+		op = "$lt"
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: cursor.Value}},
+		bson.M{field: cursor.Value, "_id": bson.M{op: cursor.ID}},
+	}}, nil
+}
@@ -0,0 +1,692 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/analytics"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryProjectStorage keeps projects in memory, for tests and running the
+// API without Mongo. It takes the same filters as MongoProjectStorage. It
+// doesn't keep a metrics history. The milestones, which may be nil, decide
+// the current level of design and cost like the Mongo storage's.
+type memoryProjectStorage struct {
+	mu          sync.RWMutex
+	projects    map[primitive.ObjectID]*data.Project
+	userStorage UserStorage
+	milestones  MilestoneStorage
+}
+
+func NewMemoryProjectStorage(userStorage UserStorage, milestones MilestoneStorage) *memoryProjectStorage {
+	return &memoryProjectStorage{projects: map[primitive.ObjectID]*data.Project{}, userStorage: userStorage, milestones: milestones}
+}
+
+// live returns the stored project if it isn't in the trash. The caller must
+// hold the lock.
+func (p *memoryProjectStorage) live(hex string) (*data.Project, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	project, ok := p.projects[id]
+	if !ok || project.DeletedAt != nil {
+		return nil, apperror.NotFound("project")
+	}
+
+	return project, nil
+}
+
+// sorted returns the stored projects matching filter, oldest first. The
+// caller must hold the lock.
+func (p *memoryProjectStorage) sorted(filter bson.M) ([]*data.Project, error) {
+	projects := []*data.Project{}
+	for _, project := range p.projects {
+		doc, err := toDocument(project)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := matchFilter(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			projects = append(projects, project)
+		}
+	}
+
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ID.Hex() < projects[j].ID.Hex()
+	})
+
+	return projects, nil
+}
+
+func copyProject(project *data.Project) (*data.Project, error) {
+	ret := &data.Project{}
+	err := clone(project, ret)
+	return ret, err
+}
+
+func (p *memoryProjectStorage) GetProject(hex string) (*data.Project, error) {
+	users, err := usersByID(p.userStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	project, err := p.live(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := copyProject(project)
+	if err != nil {
+		return nil, err
+	}
+
+	fillMembers(ret, users)
+	return ret, nil
+}
+
+func (p *memoryProjectStorage) GetProjects(filter bson.M) ([]*data.Project, error) {
+	users, err := usersByID(p.userStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	projects, err := p.sorted(bson.M{"$and": bson.A{filter, bson.M{"deletedat": nil}}})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*data.Project{}
+	now := time.Now()
+	for _, project := range projects {
+		if project.AccessExpired(now) {
+			continue
+		}
+
+		project, err := copyProject(project)
+		if err != nil {
+			return nil, err
+		}
+
+		if user, ok := users[project.Team.ProjectLead.ID]; ok {
+			project.Team.ProjectLead.FullName = user.FullName
+		}
+		ret = append(ret, project)
+	}
+
+	return ret, nil
+}
+
+// ListProjects pages through the projects the same way as the Mongo storage,
+// cursors are interchangeable between the two.
+func (p *memoryProjectStorage) ListProjects(filter bson.M, opts ProjectListOptions) (*data.Page[*data.ProjectSummary], error) {
+	sortField := "name"
+	if opts.Sort != "" {
+		field, ok := projectSortFields[opts.Sort]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
+		sortField = field
+	}
+
+	var cursor *listCursor
+	if opts.Cursor != "" {
+		decoded, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &decoded
+	}
+
+	users, err := usersByID(p.userStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	conditions := append(projectListConditions(filter, opts), bson.M{"deletedat": nil})
+	matching, err := p.sorted(bson.M{"$and": conditions})
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []*data.Project{}
+	now := time.Now()
+	for _, project := range matching {
+		if !expired(project, now) {
+			projects = append(projects, project)
+		}
+	}
+
+	// compare orders a before b on the sort field and then the id
+	compare := func(aValue interface{}, aID primitive.ObjectID, b *data.Project) int {
+		cmp, _ := compareValues(aValue, sortValue(b, sortField))
+		if cmp == 0 {
+			cmp, _ = compareValues(aID, b.ID)
+		}
+		if opts.Desc {
+			cmp = -cmp
+		}
+		return cmp
+	}
+
+	sort.SliceStable(projects, func(i, j int) bool {
+		return compare(sortValue(projects[i], sortField), projects[i].ID, projects[j]) < 0
+	})
+
+	page := &data.Page[*data.ProjectSummary]{Items: []*data.ProjectSummary{}, Total: int64(len(projects))}
+
+	if cursor != nil {
+		after := []*data.Project{}
+		for _, project := range projects {
+			if compare(cursor.Value, cursor.ID, project) < 0 {
+				after = append(after, project)
+			}
+		}
+		projects = after
+	}
+
+	if len(projects) > opts.Limit {
+		projects = projects[:opts.Limit]
+		last := projects[len(projects)-1]
+		page.NextCursor, err = encodeCursor(sortValue(last, sortField), last.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, project := range projects {
+		var milestones []*data.Milestone
+		if p.milestones != nil {
+			milestones, err = p.milestones.GetMilestones(project.ID.Hex())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		summary := project.Summary(milestones)
+		if user, ok := users[summary.ProjectLead.ID]; ok {
+			summary.ProjectLead.FullName = user.FullName
+		}
+		page.Items = append(page.Items, summary)
+	}
+
+	return page, nil
+}
+
+func (p *memoryProjectStorage) PortfolioSummary(filter bson.M, opts ProjectListOptions) (*data.PortfolioSummary, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	conditions := append(projectListConditions(filter, opts), bson.M{"deletedat": nil})
+	matching, err := p.sorted(bson.M{"$and": conditions})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := newPortfolioSummary()
+	byStatus, byRegion, byClient := map[string]int{}, map[string]int{}, map[string]int{}
+	now := time.Now()
+	for _, project := range matching {
+		if expired(project, now) {
+			continue
+		}
+
+		summary.Projects++
+		byStatus[data.NormalizeStatus(project.Status)]++
+		byRegion[project.Region]++
+		byClient[project.Client]++
+
+		summary.Commercial.ContractedValue += project.Metrics.CommercialInformation.CIContractedValue
+		summary.Commercial.AccrualToDate += project.Metrics.CommercialInformation.CIAccrualToDate
+		var milestones []*data.Milestone
+		if p.milestones != nil {
+			milestones, err = p.milestones.GetMilestones(project.ID.Hex())
+			if err != nil {
+				return nil, err
+			}
+		}
+		if cost := analytics.CurrentCost(milestones, project.Metrics.TotalProjectCostPerMilestone); cost != nil {
+			summary.P50OutturnCost += cost.P50OutturnCost
+			summary.P90OutturnCost += cost.P90OutturnCost
+		}
+
+		if analytics.Overdue(&project.Metrics, &project.Scope) {
+			summary.Overdue = append(summary.Overdue, &data.OverdueProject{
+				ID:                        project.ID,
+				Name:                      project.Name,
+				Client:                    project.Client,
+				Region:                    project.Region,
+				EstimatedCompletionDate:   project.Scope.EstimatedCompletionDate,
+				AnticipatedCompletionDate: analytics.AnticipatedCompletion(&project.Metrics, &project.Scope),
+			})
+		}
+	}
+
+	summary.ByStatus = portfolioCounts(byStatus)
+	summary.ByRegion = portfolioCounts(byRegion)
+	summary.ByClient = portfolioCounts(byClient)
+
+	// the same order as the Mongo storage
+	sort.SliceStable(summary.Overdue, func(i, j int) bool {
+		return summary.Overdue[i].AnticipatedCompletionDate < summary.Overdue[j].AnticipatedCompletionDate
+	})
+
+	return summary, nil
+}
+
+// portfolioCounts sorts counts the same as countBy.
+func portfolioCounts(counts map[string]int) []data.PortfolioCount {
+	res := []data.PortfolioCount{}
+	for key, count := range counts {
+		res = append(res, data.PortfolioCount{Key: key, Count: count})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Key < res[j].Key
+	})
+
+	return res
+}
+
+func (p *memoryProjectStorage) CreateProject(project *data.Project) (*data.Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if project.ID.IsZero() {
+		project.ID = primitive.NewObjectID()
+	}
+
+	stored, err := copyProject(project)
+	if err != nil {
+		return nil, err
+	}
+
+	p.projects[project.ID] = stored
+	return project, nil
+}
+
+func (p *memoryProjectStorage) UpdateProject(hex string, project *data.Project, revision int) (*data.Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, err := p.live(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.Revision != revision {
+		return nil, ErrRevisionMismatch
+	}
+
+	updated, err := copyProject(project)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same fields the Mongo storage leaves alone
+	updated.ID = stored.ID
+	updated.Revision = revision + 1
+	updated.Metrics = stored.Metrics
+	updated.MetricsVersion = stored.MetricsVersion
+	updated.ClientVisibleSections = stored.ClientVisibleSections
+	updated.DeletedAt = nil
+	updated.DeletedBy = ""
+	updated.Status = stored.Status
+	updated.StatusHistory = stored.StatusHistory
+	updated.CompletionDate = stored.CompletionDate
+	updated.ArchivedAt = stored.ArchivedAt
+	updated.ExpiryWarnedAt = stored.ExpiryWarnedAt
+	p.projects[stored.ID] = updated
+
+	return copyProject(updated)
+}
+
+func (p *memoryProjectStorage) UpdateMetrics(hex string, metrics *data.Metrics, revision int, author data.Member, reason string) (*data.Metrics, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, err := p.live(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored.Revision != revision {
+		return nil, ErrRevisionMismatch
+	}
+
+	updated := data.Metrics{}
+	err = clone(metrics, &updated)
+	if err != nil {
+		return nil, err
+	}
+
+	stored.Metrics = updated
+	stored.MetricsVersion++
+	stored.Revision++
+	return metrics, nil
+}
+
+func (p *memoryProjectStorage) UpdateStatus(hex string, change data.StatusChange, completionDate primitive.DateTime) (*data.Project, error) {
+	p.mu.Lock()
+	project, err := p.live(hex)
+	if err == nil && data.NormalizeStatus(project.Status) != change.From {
+		err = ErrStatusChanged
+	}
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	// the same fields as statusFields
+	switch change.To {
+	case data.StatusCompleted:
+		project.CompletionDate = completionDate
+	case data.StatusArchived:
+		archivedAt := change.ChangedAt
+		project.ArchivedAt = &archivedAt
+	default:
+		if change.From == data.StatusCompleted || change.From == data.StatusArchived {
+			project.CompletionDate = 0
+			project.ArchivedAt = nil
+			project.ExpiryWarnedAt = nil
+		}
+	}
+	project.Status = change.To
+	project.StatusHistory = append(project.StatusHistory, change)
+	project.Revision++
+	p.mu.Unlock()
+
+	return p.GetProject(hex)
+}
+
+func (p *memoryProjectStorage) UpdateClientVisibility(hex string, sections []data.MetricsSection) (*data.Project, error) {
+	err := p.update(hex, func(project *data.Project) {
+		project.ClientVisibleSections = append([]data.MetricsSection{}, sections...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetProject(hex)
+}
+
+// update applies change to a live project and bumps its revision.
+func (p *memoryProjectStorage) update(hex string, change func(project *data.Project)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	project, err := p.live(hex)
+	if err != nil {
+		return err
+	}
+
+	change(project)
+	project.Revision++
+	return nil
+}
+
+func (p *memoryProjectStorage) DeleteProject(hex string, deletedBy string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	project, err := p.live(hex)
+	if err != nil {
+		return err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	project.DeletedAt = &now
+	project.DeletedBy = deletedBy
+	return nil
+}
+
+func (p *memoryProjectStorage) GetTrashedProjects() ([]*data.Project, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	projects := []*data.Project{}
+	for _, project := range p.projects {
+		if project.DeletedAt == nil {
+			continue
+		}
+
+		project, err := copyProject(project)
+		if err != nil {
+			return nil, err
+		}
+		project.Metrics = data.Metrics{}
+		projects = append(projects, project)
+	}
+
+	sort.Slice(projects, func(i, j int) bool {
+		return *projects[i].DeletedAt > *projects[j].DeletedAt
+	})
+
+	return projects, nil
+}
+
+// trashed returns the stored project if it is in the trash. The caller must
+// hold the lock.
+func (p *memoryProjectStorage) trashed(hex string) (*data.Project, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	project, ok := p.projects[id]
+	if !ok || project.DeletedAt == nil {
+		return nil, apperror.NotFound("project")
+	}
+
+	return project, nil
+}
+
+func (p *memoryProjectStorage) RestoreProject(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	project, err := p.trashed(hex)
+	if err != nil {
+		return err
+	}
+
+	project.DeletedAt = nil
+	project.DeletedBy = ""
+	project.Revision++
+	return nil
+}
+
+func (p *memoryProjectStorage) PurgeProject(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	project, err := p.trashed(hex)
+	if err != nil {
+		return err
+	}
+
+	delete(p.projects, project.ID)
+	return nil
+}
+
+func (p *memoryProjectStorage) PurgeTrashedProjects(before time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var purged int64
+	for id, project := range p.projects {
+		if project.DeletedAt != nil && project.DeletedAt.Time().Before(before) {
+			delete(p.projects, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (p *memoryProjectStorage) ArchiveExpired(now time.Time) ([]*data.Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	archivedAt := primitive.NewDateTimeFromTime(now)
+	archived := []*data.Project{}
+	for _, project := range p.projects {
+		if project.DeletedAt != nil || !expired(project, now) {
+			continue
+		}
+
+		project.Status = data.StatusArchived
+		project.ArchivedAt = &archivedAt
+		project.StatusHistory = append(project.StatusHistory, data.StatusChange{
+			From:      data.StatusCompleted,
+			To:        data.StatusArchived,
+			ChangedBy: data.SystemMember,
+			ChangedAt: archivedAt,
+			Reason:    "access period ended",
+		})
+		project.Revision++
+
+		copied, err := copyProject(project)
+		if err != nil {
+			return archived, err
+		}
+		archived = append(archived, copied)
+	}
+
+	return archived, nil
+}
+
+func (p *memoryProjectStorage) GetExpiringProjects(before time.Time) ([]*data.Project, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	projects := []*data.Project{}
+	for _, project := range p.projects {
+		if project.DeletedAt != nil || project.Status != data.StatusCompleted || project.ExpiryWarnedAt != nil {
+			continue
+		}
+		if !project.AccessExpiresAt().Before(before) {
+			continue
+		}
+
+		copied, err := copyProject(project)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, copied)
+	}
+
+	return projects, nil
+}
+
+func (p *memoryProjectStorage) MarkExpiryWarned(hex string, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	if project, ok := p.projects[id]; ok {
+		warnedAt := primitive.NewDateTimeFromTime(at)
+		project.ExpiryWarnedAt = &warnedAt
+	}
+
+	return nil
+}
+
+func (p *memoryProjectStorage) ExtendAccess(hex string, days int, by data.Member) (*data.Project, error) {
+	return p.updateCompleted(hex, func(project *data.Project) {
+		if project.Status == data.StatusArchived {
+			project.StatusHistory = append(project.StatusHistory, data.StatusChange{
+				From:      data.StatusArchived,
+				To:        data.StatusCompleted,
+				ChangedBy: by,
+				ChangedAt: primitive.NewDateTimeFromTime(time.Now()),
+				Reason:    "access extended",
+			})
+		}
+
+		project.Status = data.StatusCompleted
+		project.Scope.RemainsAccessibleForNDays += days
+		project.ArchivedAt = nil
+		project.ExpiryWarnedAt = nil
+	})
+}
+
+func (p *memoryProjectStorage) updateCompleted(hex string, change func(project *data.Project)) (*data.Project, error) {
+	p.mu.Lock()
+	project, err := p.live(hex)
+	if err == nil && project.Status != data.StatusCompleted && project.Status != data.StatusArchived {
+		err = ErrNotCompleted
+	}
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	change(project)
+	project.Revision++
+	p.mu.Unlock()
+
+	return p.GetProject(hex)
+}
+
+// usesBenchmark reports whether a live project compares itself against the
+// benchmark.
+func (p *memoryProjectStorage) usesBenchmark(id primitive.ObjectID) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, project := range p.projects {
+		if project.DeletedAt != nil {
+			continue
+		}
+		for _, benchmark := range project.Metrics.Benchmarking.Benchmarks {
+			if benchmark.BenchmarkID == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// removeBenchmark drops the references to a purged benchmark.
+func (p *memoryProjectStorage) removeBenchmark(id primitive.ObjectID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, project := range p.projects {
+		benchmarks := project.Metrics.Benchmarking.Benchmarks
+		for i := len(benchmarks) - 1; i >= 0; i-- {
+			if benchmarks[i].BenchmarkID == id {
+				benchmarks = append(benchmarks[:i], benchmarks[i+1:]...)
+			}
+		}
+		project.Metrics.Benchmarking.Benchmarks = benchmarks
+	}
+}
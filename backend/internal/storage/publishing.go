@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+)
+
+// publishingProjectStorage publishes the changes made through another
+// ProjectStorage to an event bus, once they are stored. Reads and the trash
+// go straight through.
+type publishingProjectStorage struct {
+	ProjectStorage
+	bus *events.Bus
+}
+
+func NewPublishingProjectStorage(st ProjectStorage, bus *events.Bus) *publishingProjectStorage {
+	return &publishingProjectStorage{ProjectStorage: st, bus: bus}
+}
+
+func (p *publishingProjectStorage) CreateProject(project *data.Project) (*data.Project, error) {
+	res, err := p.ProjectStorage.CreateProject(project)
+	if err != nil {
+		return nil, err
+	}
+
+	p.bus.Publish(events.Event{Type: events.ProjectCreated, Project: res})
+	return res, nil
+}
+
+func (p *publishingProjectStorage) UpdateProject(hex string, project *data.Project, revision int) (*data.Project, error) {
+	before := p.get(hex)
+	res, err := p.ProjectStorage.UpdateProject(hex, project, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// subscribers are sent the project as stored, not as it was sent
+	stored := p.get(hex)
+	if stored == nil {
+		stored = res
+	}
+	p.bus.Publish(events.Event{Type: events.ProjectUpdated, Project: stored, Before: before})
+	return res, nil
+}
+
+func (p *publishingProjectStorage) UpdateMetrics(hex string, metrics *data.Metrics, revision int, author data.Member, reason string) (*data.Metrics, error) {
+	res, err := p.ProjectStorage.UpdateMetrics(hex, metrics, revision, author, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if project := p.get(hex); project != nil {
+		p.bus.Publish(events.Event{Type: events.MetricsUpdated, Project: project, Actor: author})
+	}
+	return res, nil
+}
+
+func (p *publishingProjectStorage) UpdateStatus(hex string, change data.StatusChange, completionDate primitive.DateTime) (*data.Project, error) {
+	before := p.get(hex)
+	res, err := p.ProjectStorage.UpdateStatus(hex, change, completionDate)
+	if err != nil {
+		return nil, err
+	}
+
+	p.bus.Publish(events.Event{Type: events.StatusChanged, Project: res, Before: before, Status: &change, Actor: change.ChangedBy})
+	return res, nil
+}
+
+func (p *publishingProjectStorage) UpdateClientVisibility(hex string, sections []data.MetricsSection) (*data.Project, error) {
+	before := p.get(hex)
+	res, err := p.ProjectStorage.UpdateClientVisibility(hex, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	p.bus.Publish(events.Event{Type: events.ProjectUpdated, Project: res, Before: before})
+	return res, nil
+}
+
+// ArchiveExpired publishes the status change of every archived project.
+func (p *publishingProjectStorage) ArchiveExpired(now time.Time) ([]*data.Project, error) {
+	archived, err := p.ProjectStorage.ArchiveExpired(now)
+	for _, project := range archived {
+		change := data.StatusChange{From: data.StatusCompleted, To: data.StatusArchived, ChangedBy: data.SystemMember}
+		if n := len(project.StatusHistory); n > 0 {
+			change = project.StatusHistory[n-1]
+		}
+		p.bus.Publish(events.Event{Type: events.StatusChanged, Project: project, Status: &change, Actor: change.ChangedBy})
+	}
+
+	return archived, err
+}
+
+func (p *publishingProjectStorage) ExtendAccess(hex string, days int, by data.Member) (*data.Project, error) {
+	before := p.get(hex)
+	res, err := p.ProjectStorage.ExtendAccess(hex, days, by)
+	if err != nil {
+		return nil, err
+	}
+
+	p.bus.Publish(events.Event{Type: events.ProjectUpdated, Project: res, Before: before, Actor: by})
+	return res, nil
+}
+
+// get returns the project as it is before or after a change, nil when it
+// can't be read.
+func (p *publishingProjectStorage) get(hex string) *data.Project {
+	project, err := p.ProjectStorage.GetProject(hex)
+	if err != nil {
+		return nil
+	}
+	return project
+}
+
+// publishingBenchmarkStorage publishes the changes made to the benchmark
+// library through another BenchmarkStorage to an event bus.
+type publishingBenchmarkStorage struct {
+	BenchmarkStorage
+	bus *events.Bus
+}
+
+func NewPublishingBenchmarkStorage(st BenchmarkStorage, bus *events.Bus) *publishingBenchmarkStorage {
+	return &publishingBenchmarkStorage{BenchmarkStorage: st, bus: bus}
+}
+
+func (p *publishingBenchmarkStorage) Create(benchmark *data.Benchmark) (*data.Benchmark, error) {
+	res, err := p.BenchmarkStorage.Create(benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	p.publish(res, events.ActionCreated, "")
+	return res, nil
+}
+
+func (p *publishingBenchmarkStorage) Update(hex string, benchmark *data.Benchmark) (*data.Benchmark, error) {
+	res, err := p.BenchmarkStorage.Update(hex, benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	// the storages return the benchmark as given, without its id
+	if stored, err := p.BenchmarkStorage.GetById(hex); err == nil {
+		p.publish(stored, events.ActionUpdated, "")
+	}
+	return res, nil
+}
+
+func (p *publishingBenchmarkStorage) Delete(hex string, deletedBy string) error {
+	before, err := p.BenchmarkStorage.GetById(hex)
+	if err != nil {
+		return err
+	}
+
+	err = p.BenchmarkStorage.Delete(hex, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	p.publish(before, events.ActionDeleted, deletedBy)
+	return nil
+}
+
+func (p *publishingBenchmarkStorage) Restore(hex string) error {
+	err := p.BenchmarkStorage.Restore(hex)
+	if err != nil {
+		return err
+	}
+
+	if res, err := p.BenchmarkStorage.GetById(hex); err == nil {
+		p.publish(res, events.ActionRestored, "")
+	}
+	return nil
+}
+
+func (p *publishingBenchmarkStorage) publish(benchmark *data.Benchmark, action, actor string) {
+	p.bus.Publish(events.Event{Type: events.BenchmarkChanged, Benchmark: benchmark, Action: action, Actor: data.Member{ID: actor}})
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RefreshTokenStorage keeps the refresh tokens of self-issued sessions. Tokens
+// are single use, refreshing revokes the token and hands out a new one.
+type RefreshTokenStorage interface {
+	Create(userID string) (string, error)
+	Rotate(token string) (userID string, next string, err error)
+	Revoke(token string) error
+}
+
+var ErrInvalidRefreshToken = apperror.Unauthorized("invalid or expired refresh token")
+
+// refreshToken is a refresh token as stored, only its hash is kept.
+type refreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Hash      string
+	UserID    string
+	CreatedAt primitive.DateTime
+	ExpiresAt primitive.DateTime
+	RevokedAt *primitive.DateTime
+}
+
+type mongoRefreshTokenStorage struct {
+	db  *mongo.Database
+	ttl time.Duration
+}
+
+func NewRefreshTokenStorage(db *mongo.Database, ttl time.Duration) (*mongoRefreshTokenStorage, error) {
+	// expired tokens are removed by Mongo itself
+	_, err := db.Collection("refresh_tokens").Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"expiresat": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoRefreshTokenStorage{db: db, ttl: ttl}, nil
+}
+
+func (p *mongoRefreshTokenStorage) Create(userID string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = p.db.Collection("refresh_tokens").InsertOne(context.TODO(), &refreshToken{
+		Hash:      hashToken(token),
+		UserID:    userID,
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(p.ttl)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Rotate revokes the token and returns its user along with a new token. A
+// token that was already used means it leaked, so every token of the user is
+// revoked.
+func (p *mongoRefreshTokenStorage) Rotate(token string) (string, string, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	current := &refreshToken{}
+	err := p.db.Collection("refresh_tokens").FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"hash": hashToken(token), "revokedat": nil, "expiresat": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"revokedat": now}},
+	).Decode(current)
+	if err == mongo.ErrNoDocuments {
+		p.revokeReused(token)
+		return "", "", ErrInvalidRefreshToken
+	} else if err != nil {
+		return "", "", err
+	}
+
+	next, err := p.Create(current.UserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return current.UserID, next, nil
+}
+
+func (p *mongoRefreshTokenStorage) revokeReused(token string) {
+	reused := &refreshToken{}
+	err := p.db.Collection("refresh_tokens").FindOne(
+		context.TODO(),
+		bson.M{"hash": hashToken(token), "revokedat": bson.M{"$ne": nil}},
+	).Decode(reused)
+	if err != nil {
+		return
+	}
+
+	_, err = p.db.Collection("refresh_tokens").UpdateMany(
+		context.TODO(),
+		bson.M{"userid": reused.UserID, "revokedat": nil},
+		bson.M{"$set": bson.M{"revokedat": primitive.NewDateTimeFromTime(time.Now())}},
+	)
+	if err != nil {
+		fmt.Println("error revoking refresh tokens of", reused.UserID, err)
+	}
+}
+
+func (p *mongoRefreshTokenStorage) Revoke(token string) error {
+	_, err := p.db.Collection("refresh_tokens").UpdateOne(
+		context.TODO(),
+		bson.M{"hash": hashToken(token), "revokedat": nil},
+		bson.M{"$set": bson.M{"revokedat": primitive.NewDateTimeFromTime(time.Now())}},
+	)
+
+	return err
+}
@@ -3,19 +3,52 @@ package storage
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
 )
 
 type UserStorage interface {
 	GetById(hex string) (*data.User, error)
 	GetAll() ([]*data.User, error)
+	Search(query, role, organisation string, page int) (*data.Page[*data.User], error)
 	Create(user *data.User) (*data.User, error)
 	Update(hex string, user *data.User) (*data.User, error)
-	Delete(hex string) error
+	Delete(hex string, deletedBy string) error
+	GetTrashed() ([]*data.User, error)
+	Restore(hex string) error
+	Purge(hex string) error
+	PurgeTrashed(before time.Time) (int64, error)
+}
+
+// ErrUserDeleted is returned when looking up a user that is in the trash.
+var ErrUserDeleted = apperror.NotFound("user")
+
+// auth0Error turns an error response of the management API into an error the
+// client can act on. Auth0's own failures, including rejecting our token or
+// rate limiting us, are upstream errors.
+func auth0Error(status int, message string) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return apperror.Upstream("auth0", errors.New(message))
+	case status == http.StatusNotFound:
+		return apperror.NotFound("user")
+	case status == http.StatusConflict:
+		return apperror.Conflict(message)
+	case status >= 400 && status < 500:
+		return apperror.BadRequest(message)
+	}
+
+	return apperror.Upstream("auth0", errors.New(message))
 }
 
 type auth0Storage struct {
@@ -26,18 +59,24 @@ type auth0Storage struct {
 	PStorage     PreferenceStorage
 	MemberRoleId string
 	ClientRoleId string
+
+	tokenMu        sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
 }
 
 type Auth0User struct {
-	Email        string `json:"email"`
-	Name         string `json:"name"`
-	Nickname     string `json:"nickname,omitempty"`
-	Picture      string `json:"picture,omitempty"`
-	UpdatedAt    string `json:"updated_at,omitempty"`
-	UserID       string `json:"user_id,omitempty"`
-	LastLogin    string `json:"last_login,omitempty"`
-	Connection   string `json:"connection,omitempty"`
-	Password     string `json:"password,omitempty"`
+	Email        string            `json:"email"`
+	Name         string            `json:"name"`
+	Nickname     string            `json:"nickname,omitempty"`
+	Picture      string            `json:"picture,omitempty"`
+	UpdatedAt    string            `json:"updated_at,omitempty"`
+	UserID       string            `json:"user_id,omitempty"`
+	LastLogin    string            `json:"last_login,omitempty"`
+	Connection   string            `json:"connection,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	Blocked      bool              `json:"blocked,omitempty"`
+	AppMetadata  *auth0AppMetadata `json:"app_metadata,omitempty"`
 	UserMetadata struct {
 		UserRole     string `json:"user_role"`
 		Bio          string `json:"bio"`
@@ -46,6 +85,11 @@ type Auth0User struct {
 	} `json:"user_metadata"`
 }
 
+type auth0AppMetadata struct {
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
 func NewUserStorage(Domain, ClientID, ClientSecret, Audience string, pst PreferenceStorage) (UserStorage, error) {
 	storage := &auth0Storage{
 		Audience:     Audience,
@@ -79,7 +123,7 @@ func NewUserStorage(Domain, ClientID, ClientSecret, Audience string, pst Prefere
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return nil, err
+		return nil, apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -119,7 +163,16 @@ func NewUserStorage(Domain, ClientID, ClientSecret, Audience string, pst Prefere
 
 }
 
+// getToken returns a Management API token, reusing the previous one until it
+// is about to expire.
 func (p *auth0Storage) getToken() (string, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	if p.token != "" && time.Now().Add(time.Minute).Before(p.tokenExpiresAt) {
+		return p.token, nil
+	}
+
 	url := fmt.Sprintf("https://%s/oauth/token", p.Domain)
 
 	data := map[string]string{
@@ -145,7 +198,7 @@ func (p *auth0Storage) getToken() (string, error) {
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		fmt.Println("do", err)
-		return "", err
+		return "", apperror.Upstream("auth0", err)
 	}
 
 	defer res.Body.Close()
@@ -158,6 +211,7 @@ func (p *auth0Storage) getToken() (string, error) {
 	type auth0Token struct {
 		AccessToken string `json:"access_token"`
 		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
 	}
 	token := &auth0Token{}
 	err = json.Unmarshal(body, token)
@@ -166,17 +220,14 @@ func (p *auth0Storage) getToken() (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("%s %s", token.TokenType, token.AccessToken), nil
-}
+	p.token = fmt.Sprintf("%s %s", token.TokenType, token.AccessToken)
+	p.tokenExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
 
-func (p *auth0Storage) GetById(hex string) (*data.User, error) {
-	fmt.Println("get by id", hex)
-	token, err := p.getToken()
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
+	return p.token, nil
+}
 
+// getAuth0User returns the user as stored in Auth0, trashed or not.
+func (p *auth0Storage) getAuth0User(hex, token string) (*Auth0User, error) {
 	url := fmt.Sprintf("https://%s/api/v2/users/%s", p.Domain, hex)
 	fmt.Println("url", url)
 	method := "GET"
@@ -194,7 +245,7 @@ func (p *auth0Storage) GetById(hex string) (*data.User, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return nil, err
+		return nil, apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -204,6 +255,12 @@ func (p *auth0Storage) GetById(hex string) (*data.User, error) {
 		return nil, err
 	}
 
+	if res.StatusCode == http.StatusBadRequest {
+		return nil, apperror.InvalidID(errors.New(string(body)))
+	} else if res.StatusCode != http.StatusOK {
+		return nil, auth0Error(res.StatusCode, string(body))
+	}
+
 	fmt.Println("body", string(body))
 	// fmt.Println(string(body))
 	user := &Auth0User{}
@@ -214,6 +271,26 @@ func (p *auth0Storage) GetById(hex string) (*data.User, error) {
 	}
 	fmt.Println("user", user)
 
+	return user, nil
+}
+
+func (p *auth0Storage) GetById(hex string) (*data.User, error) {
+	fmt.Println("get by id", hex)
+	token, err := p.getToken()
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	user, err := p.getAuth0User(hex, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.deleted() {
+		return nil, ErrUserDeleted
+	}
+
 	// convert auth user to data user
 	userData := &data.User{
 		ID:           user.UserID,
@@ -230,6 +307,11 @@ func (p *auth0Storage) GetById(hex string) (*data.User, error) {
 	return userData, nil
 }
 
+// auth0PerPage is the largest page size the Management API allows.
+const auth0PerPage = 100
+
+// GetAll returns every user, paging through /api/v2/users or, past the users
+// Auth0 pages through, exporting them.
 func (p *auth0Storage) GetAll() ([]*data.User, error) {
 	token, err := p.getToken()
 	if err != nil {
@@ -237,12 +319,111 @@ func (p *auth0Storage) GetAll() ([]*data.User, error) {
 		return nil, err
 	}
 
-	url := fmt.Sprintf("https://%s/api/v2/users", p.Domain)
-	method := "GET"
+	users, err := p.allUsers(token)
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
+	ret := []*data.User{}
+	for _, u := range users {
+		if !u.deleted() {
+			ret = append(ret, u.toUser())
+		}
+	}
+
+	return ret, nil
+}
 
+func (p *auth0Storage) allUsers(token string) ([]*Auth0User, error) {
+	users := []*Auth0User{}
+	for page := 0; ; page++ {
+		params := url.Values{}
+		params.Set("page", strconv.Itoa(page))
+		params.Set("per_page", strconv.Itoa(auth0PerPage))
+
+		res, err := p.listUsers(params, token)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.Total > auth0PageLimit {
+			return p.exportUsers(token)
+		}
+
+		users = append(users, res.Users...)
+
+		if len(res.Users) == 0 || len(users) >= res.Total {
+			break
+		}
+	}
+
+	return users, nil
+}
+
+// Search returns one page of the users matching the free text query, user
+// type and organisation, using the Management API Lucene syntax. Empty
+// arguments are ignored. NextCursor holds the next page number, if any.
+func (p *auth0Storage) Search(query, role, organisation string, page int) (*data.Page[*data.User], error) {
+	token, err := p.getToken()
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	terms := []string{}
+	if query = strings.TrimSpace(query); query != "" {
+		q := escapeLucene(query)
+		terms = append(terms, fmt.Sprintf("(name:%s* OR email:%s*)", q, q))
+	}
+	if role != "" {
+		terms = append(terms, fmt.Sprintf(`user_metadata.user_role:"%s"`, escapeLuceneQuoted(role)))
+	}
+	if organisation != "" {
+		terms = append(terms, fmt.Sprintf(`user_metadata.organisation:"%s"`, escapeLuceneQuoted(organisation)))
+	}
+
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(page))
+	params.Set("per_page", strconv.Itoa(auth0PerPage))
+	params.Set("search_engine", "v3")
+	if len(terms) > 0 {
+		params.Set("q", strings.Join(terms, " AND "))
+	}
+
+	res, err := p.listUsers(params, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// trashed users are left out here rather than in the query, so the total
+	// may count a few of them
+	ret := &data.Page[*data.User]{Items: []*data.User{}, Total: int64(res.Total)}
+	for _, u := range res.Users {
+		if !u.deleted() {
+			ret.Items = append(ret.Items, u.toUser())
+		}
+	}
+
+	if (page+1)*auth0PerPage < res.Total {
+		ret.NextCursor = strconv.Itoa(page + 1)
+	}
+
+	return ret, nil
+}
+
+type auth0UsersPage struct {
+	Users []*Auth0User `json:"users"`
+	Total int          `json:"total"`
+}
+
+// listUsers fetches a single page of /api/v2/users with the given query
+// params, always including the total count.
+func (p *auth0Storage) listUsers(params url.Values, token string) (*auth0UsersPage, error) {
+	params.Set("include_totals", "true")
+	endpoint := fmt.Sprintf("https://%s/api/v2/users?%s", p.Domain, params.Encode())
+
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
@@ -253,7 +434,7 @@ func (p *auth0Storage) GetAll() ([]*data.User, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return nil, err
+		return nil, apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -262,32 +443,70 @@ func (p *auth0Storage) GetAll() ([]*data.User, error) {
 		fmt.Println(err)
 		return nil, err
 	}
-	// fmt.Println(string(body))
-	users := []*Auth0User{}
-	err = json.Unmarshal(body, &users)
+
+	if res.StatusCode != 200 {
+		response := &struct {
+			Message string `json:"message"`
+		}{}
+
+		_ = json.Unmarshal(body, response)
+
+		fmt.Println("Error listing users", response.Message)
+		return nil, auth0Error(res.StatusCode, response.Message)
+	}
+
+	page := &auth0UsersPage{}
+	err = json.Unmarshal(body, page)
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
 	}
 
-	// convert auth user to data user
-	ret := []*data.User{}
-	for _, u := range users {
-		ret = append(ret, &data.User{
-			ID:           u.UserID,
-			Type:         u.UserMetadata.UserRole,
-			FullName:     u.Name,
-			Email:        u.Email,
-			Password:     u.Password,
-			Avatar:       u.Picture,
-			Bio:          u.UserMetadata.Bio,
-			Organisation: u.UserMetadata.Organisation,
-			ClientRole:   u.UserMetadata.ClientRole,
-			LastAccess:   u.LastLogin,
-		})
+	return page, nil
+}
+
+func (u *Auth0User) deleted() bool {
+	return u.AppMetadata != nil && u.AppMetadata.DeletedAt != ""
+}
+
+func (u *Auth0User) toUser() *data.User {
+	user := &data.User{
+		ID:           u.UserID,
+		Type:         u.UserMetadata.UserRole,
+		FullName:     u.Name,
+		Email:        u.Email,
+		Password:     u.Password,
+		Avatar:       u.Picture,
+		Bio:          u.UserMetadata.Bio,
+		Organisation: u.UserMetadata.Organisation,
+		ClientRole:   u.UserMetadata.ClientRole,
+		LastAccess:   u.LastLogin,
 	}
 
-	return ret, nil
+	if u.AppMetadata != nil {
+		user.DeletedAt = u.AppMetadata.DeletedAt
+		user.DeletedBy = u.AppMetadata.DeletedBy
+	}
+
+	return user
+}
+
+// escapeLucene escapes a term so it can be used unquoted, e.g. with
+// wildcards, in a Lucene query.
+func escapeLucene(term string) string {
+	var b strings.Builder
+	for _, r := range term {
+		if strings.ContainsRune(`+-&|!(){}[]^"~*?:\/ `, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeLuceneQuoted escapes a value used inside a quoted Lucene phrase.
+func escapeLuceneQuoted(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
 }
 
 func (p *auth0Storage) requestPasswordChange(email, token string) error {
@@ -319,7 +538,7 @@ func (p *auth0Storage) requestPasswordChange(email, token string) error {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -341,7 +560,7 @@ func (p *auth0Storage) requestPasswordChange(email, token string) error {
 		_ = json.Unmarshal(body, response)
 
 		fmt.Println("Error requesting password change", response.Message)
-		return fmt.Errorf(response.Message)
+		return auth0Error(res.StatusCode, response.Message)
 	}
 
 	fmt.Println("request password change body", string(body))
@@ -376,7 +595,7 @@ func (p *auth0Storage) assignRole(user_id, role, token string) error {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -398,7 +617,7 @@ func (p *auth0Storage) assignRole(user_id, role, token string) error {
 		_ = json.Unmarshal(body, response)
 
 		fmt.Println("Error setting user roles", response.Message)
-		return fmt.Errorf(response.Message)
+		return auth0Error(res.StatusCode, response.Message)
 	}
 
 	fmt.Println("assing role body", string(body))
@@ -457,7 +676,7 @@ func (p *auth0Storage) Create(user *data.User) (*data.User, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return nil, err
+		return nil, apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -479,7 +698,7 @@ func (p *auth0Storage) Create(user *data.User) (*data.User, error) {
 		_ = json.Unmarshal(body, response)
 
 		fmt.Println("Error creating user", response.Message)
-		return nil, fmt.Errorf(response.Message)
+		return nil, auth0Error(res.StatusCode, response.Message)
 	}
 
 	fmt.Println("create user body", string(body))
@@ -581,7 +800,7 @@ func (p *auth0Storage) Update(hex string, user *data.User) (*data.User, error) {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return nil, err
+		return nil, apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -603,7 +822,7 @@ func (p *auth0Storage) Update(hex string, user *data.User) (*data.User, error) {
 		_ = json.Unmarshal(body, response)
 
 		fmt.Println("Error updating user", response.Message)
-		return nil, fmt.Errorf(response.Message)
+		return nil, auth0Error(res.StatusCode, response.Message)
 	}
 
 	fmt.Println("update user body", string(body))
@@ -634,7 +853,146 @@ func (p *auth0Storage) Update(hex string, user *data.User) (*data.User, error) {
 	return ret, nil
 }
 
-func (p *auth0Storage) Delete(hex string) error {
+// Delete moves the user to the trash: the user is blocked from logging in and
+// hidden from every read until restored or purged.
+func (p *auth0Storage) Delete(hex string, deletedBy string) error {
+	token, err := p.getToken()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return p.patchUser(hex, map[string]interface{}{
+		"blocked": true,
+		"app_metadata": map[string]string{
+			"deleted_at": time.Now().UTC().Format(time.RFC3339),
+			"deleted_by": deletedBy,
+		},
+	}, token)
+}
+
+func (p *auth0Storage) GetTrashed() ([]*data.User, error) {
+	token, err := p.getToken()
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+
+	users, err := p.allUsers(token)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*data.User{}
+	for _, u := range users {
+		if u.deleted() {
+			ret = append(ret, u.toUser())
+		}
+	}
+
+	return ret, nil
+}
+
+func (p *auth0Storage) Restore(hex string) error {
+	token, err := p.getToken()
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	err = p.requireTrashed(hex, token)
+	if err != nil {
+		return err
+	}
+
+	// null removes the keys from app_metadata
+	return p.patchUser(hex, map[string]interface{}{
+		"blocked": false,
+		"app_metadata": map[string]interface{}{
+			"deleted_at": nil,
+			"deleted_by": nil,
+		},
+	}, token)
+}
+
+// PurgeTrashed permanently deletes the users trashed before the given time.
+func (p *auth0Storage) PurgeTrashed(before time.Time) (int64, error) {
+	users, err := p.GetTrashed()
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, u := range users {
+		deletedAt, err := time.Parse(time.RFC3339, u.DeletedAt)
+		if err != nil || deletedAt.After(before) {
+			continue
+		}
+
+		err = p.Purge(u.ID)
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (p *auth0Storage) patchUser(hex string, payload interface{}, token string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://%s/api/v2/users/%s", p.Domain, hex)
+	req, err := http.NewRequest("PATCH", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Authorization", token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return apperror.Upstream("auth0", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		response := &struct {
+			Message string `json:"message"`
+		}{}
+
+		_ = json.NewDecoder(res.Body).Decode(response)
+
+		fmt.Println("Error updating user", response.Message)
+		return auth0Error(res.StatusCode, response.Message)
+	}
+
+	return nil
+}
+
+// requireTrashed returns a NotFound error unless the user is in the trash, so
+// live users can't be restored or purged.
+func (p *auth0Storage) requireTrashed(hex, token string) error {
+	user, err := p.getAuth0User(hex, token)
+	if err != nil {
+		return err
+	}
+
+	if !user.deleted() {
+		return apperror.NotFound("user")
+	}
+
+	return nil
+}
+
+// Purge permanently deletes a trashed user from Auth0.
+func (p *auth0Storage) Purge(hex string) error {
 	fmt.Println("delete by id", hex)
 	token, err := p.getToken()
 	if err != nil {
@@ -642,6 +1000,11 @@ func (p *auth0Storage) Delete(hex string) error {
 		return err
 	}
 
+	err = p.requireTrashed(hex, token)
+	if err != nil {
+		return err
+	}
+
 	url := fmt.Sprintf("https://%s/api/v2/users/%s", p.Domain, hex)
 	fmt.Println("url", url)
 	method := "DELETE"
@@ -658,7 +1021,7 @@ func (p *auth0Storage) Delete(hex string) error {
 	res, err := client.Do(req)
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return apperror.Upstream("auth0", err)
 	}
 	defer res.Body.Close()
 
@@ -680,7 +1043,7 @@ func (p *auth0Storage) Delete(hex string) error {
 		_ = json.Unmarshal(body, response)
 
 		fmt.Println("Error deleting user", response.Message)
-		return fmt.Errorf(response.Message)
+		return auth0Error(res.StatusCode, response.Message)
 	}
 
 	fmt.Println("body", res)
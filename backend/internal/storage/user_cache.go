@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+)
+
+// UserDirectory is implemented by user storages that can look users up by id
+// without a round trip to the identity provider.
+type UserDirectory interface {
+	GetDirectory() (map[string]*data.User, error)
+}
+
+// cachedUserStorage keeps an in-memory copy of the user list of another
+// UserStorage. The copy is refreshed in the background every ttl and dropped
+// whenever a user is created, updated or deleted through it.
+type cachedUserStorage struct {
+	UserStorage
+	ttl time.Duration
+
+	mu       sync.RWMutex
+	users    []*data.User
+	byID     map[string]*data.User
+	loadedAt time.Time
+	// generation is bumped on every invalidation so a load that started
+	// before a write doesn't put the old users back.
+	generation int
+
+	loading sync.Mutex
+	done    chan struct{}
+}
+
+func NewCachedUserStorage(st UserStorage, ttl time.Duration) *cachedUserStorage {
+	cache := &cachedUserStorage{UserStorage: st, ttl: ttl, done: make(chan struct{})}
+	go cache.refreshLoop()
+	return cache
+}
+
+// Close stops the background refresh.
+func (c *cachedUserStorage) Close() {
+	close(c.done)
+}
+
+func (c *cachedUserStorage) refreshLoop() {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if _, _, err := c.load(); err != nil {
+				fmt.Println("error refreshing user directory", err)
+			}
+		}
+	}
+}
+
+func (c *cachedUserStorage) load() ([]*data.User, map[string]*data.User, error) {
+	c.mu.RLock()
+	generation := c.generation
+	c.mu.RUnlock()
+
+	users, err := c.UserStorage.GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byID := make(map[string]*data.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.users = users
+		c.byID = byID
+		c.loadedAt = time.Now()
+	}
+
+	return users, byID, nil
+}
+
+func (c *cachedUserStorage) fresh() bool {
+	return c.byID != nil && time.Since(c.loadedAt) < c.ttl
+}
+
+// directory returns the cached users, loading them first if the cache is empty
+// or stale. Concurrent callers share a single load.
+func (c *cachedUserStorage) directory() ([]*data.User, map[string]*data.User, error) {
+	c.mu.RLock()
+	if c.fresh() {
+		defer c.mu.RUnlock()
+		return c.users, c.byID, nil
+	}
+	c.mu.RUnlock()
+
+	c.loading.Lock()
+	defer c.loading.Unlock()
+
+	c.mu.RLock()
+	if c.fresh() {
+		defer c.mu.RUnlock()
+		return c.users, c.byID, nil
+	}
+	c.mu.RUnlock()
+
+	return c.load()
+}
+
+func (c *cachedUserStorage) invalidate() {
+	c.mu.Lock()
+	c.byID = nil
+	c.users = nil
+	c.generation++
+	c.mu.Unlock()
+}
+
+func (c *cachedUserStorage) GetDirectory() (map[string]*data.User, error) {
+	_, byID, err := c.directory()
+	return byID, err
+}
+
+func (c *cachedUserStorage) GetAll() ([]*data.User, error) {
+	users, _, err := c.directory()
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*data.User{}, users...), nil
+}
+
+func (c *cachedUserStorage) GetById(hex string) (*data.User, error) {
+	_, byID, err := c.directory()
+	if err == nil {
+		if user, ok := byID[hex]; ok {
+			return user, nil
+		}
+	}
+
+	return c.UserStorage.GetById(hex)
+}
+
+func (c *cachedUserStorage) Create(user *data.User) (*data.User, error) {
+	defer c.invalidate()
+	return c.UserStorage.Create(user)
+}
+
+func (c *cachedUserStorage) Update(hex string, user *data.User) (*data.User, error) {
+	defer c.invalidate()
+	return c.UserStorage.Update(hex, user)
+}
+
+func (c *cachedUserStorage) Delete(hex string, deletedBy string) error {
+	defer c.invalidate()
+	return c.UserStorage.Delete(hex, deletedBy)
+}
+
+func (c *cachedUserStorage) Restore(hex string) error {
+	defer c.invalidate()
+	return c.UserStorage.Restore(hex)
+}
+
+func (c *cachedUserStorage) Purge(hex string) error {
+	defer c.invalidate()
+	return c.UserStorage.Purge(hex)
+}
+
+func (c *cachedUserStorage) PurgeTrashed(before time.Time) (int64, error) {
+	defer c.invalidate()
+	return c.UserStorage.PurgeTrashed(before)
+}
+
+// usersByID returns the users of st indexed by id, using the cached directory
+// when st has one.
+func usersByID(st UserStorage) (map[string]*data.User, error) {
+	if dir, ok := st.(UserDirectory); ok {
+		return dir.GetDirectory()
+	}
+
+	users, err := st.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*data.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	return byID, nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// auth0PageLimit is the most users Auth0 pages through for a query, past it
+// users can only be had from a users export job.
+const auth0PageLimit = 1000
+
+// exportPollInterval is how often a users export job is checked on, and
+// exportTimeout how long it may take to complete.
+var (
+	exportPollInterval = 2 * time.Second
+	exportTimeout      = 5 * time.Minute
+)
+
+// exportFields are the fields of the exported users, those of Auth0User read
+// by toUser and deleted.
+var exportFields = []string{"user_id", "email", "name", "picture", "blocked", "last_login", "user_metadata", "app_metadata"}
+
+type auth0Job struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Location string `json:"location"`
+}
+
+// exportUsers returns every user from a users export job, which unlike
+// /api/v2/users isn't limited to the first 1000 users.
+func (p *auth0Storage) exportUsers(token string) ([]*Auth0User, error) {
+	fields := []map[string]string{}
+	for _, field := range exportFields {
+		fields = append(fields, map[string]string{"name": field})
+	}
+
+	job := &auth0Job{}
+	err := p.jobRequest(http.MethodPost, "/api/v2/jobs/users-exports", map[string]interface{}{"format": "json", "fields": fields}, token, job)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(exportTimeout)
+	for job.Status != "completed" {
+		if job.Status == "failed" {
+			return nil, apperror.Upstream("auth0", fmt.Errorf("users export %s failed", job.ID))
+		}
+		if time.Now().After(deadline) {
+			return nil, apperror.Upstream("auth0", fmt.Errorf("users export %s timed out", job.ID))
+		}
+
+		time.Sleep(exportPollInterval)
+		err = p.jobRequest(http.MethodGet, "/api/v2/jobs/"+url.PathEscape(job.ID), nil, token, job)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return downloadExport(job.Location)
+}
+
+// jobRequest sends payload, when not nil, to a jobs endpoint of the
+// Management API and decodes the job it answers with into job.
+func (p *auth0Storage) jobRequest(method, path string, payload interface{}, token string, job *auth0Job) error {
+	var body io.Reader
+	if payload != nil {
+		buf, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	client := &http.Client{}
+	req, err := http.NewRequest(method, fmt.Sprintf("https://%s%s", p.Domain, path), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return apperror.Upstream("auth0", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		response := &struct {
+			Message string `json:"message"`
+		}{}
+		_ = json.Unmarshal(resBody, response)
+
+		fmt.Println("Error exporting users", response.Message)
+		return auth0Error(res.StatusCode, response.Message)
+	}
+
+	return json.Unmarshal(resBody, job)
+}
+
+// downloadExport reads the users of a completed export, a gzipped file with
+// a JSON user per line.
+func downloadExport(location string) ([]*Auth0User, error) {
+	res, err := http.Get(location)
+	if err != nil {
+		return nil, apperror.Upstream("auth0", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, apperror.Upstream("auth0", fmt.Errorf("downloading the users export answered %s", res.Status))
+	}
+
+	reader, err := gzip.NewReader(res.Body)
+	if err != nil {
+		return nil, apperror.Upstream("auth0", err)
+	}
+	defer reader.Close()
+
+	users := []*Auth0User{}
+	decoder := json.NewDecoder(reader)
+	for {
+		user := &Auth0User{}
+		err := decoder.Decode(user)
+		if errors.Is(err, io.EOF) {
+			return users, nil
+		} else if err != nil {
+			return nil, apperror.Upstream("auth0", err)
+		}
+		users = append(users, user)
+	}
+}
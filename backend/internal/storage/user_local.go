@@ -0,0 +1,537 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// localPerPage is the page size of Search, the same as the Auth0 storage.
+const localPerPage = 100
+
+// passwordResetTTL is how long a password reset token can be used for.
+const passwordResetTTL = 24 * time.Hour
+
+var ErrInvalidCredentials = apperror.Unauthorized("invalid email or password")
+var ErrInvalidResetToken = apperror.BadRequest("invalid or expired password reset token")
+
+// CredentialStorage is implemented by user storages that hold the users'
+// passwords themselves rather than leaving them to an identity provider.
+type CredentialStorage interface {
+	Authenticate(email, password string) (*data.User, []string, error)
+	GetWithRoles(hex string) (*data.User, []string, error)
+	RequestPasswordReset(email string) error
+	ResetPassword(token, password string) error
+}
+
+// PasswordResetNotifier is told about every password reset requested for a
+// local user, it is expected to send the token to the user.
+type PasswordResetNotifier func(user *data.User, token string) error
+
+// localUser is a user as stored in the users collection.
+type localUser struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Type         string
+	FullName     string
+	Email        string
+	PasswordHash string
+	Roles        []string
+	Avatar       string
+	Bio          string
+	Organisation string
+	ClientRole   string
+	LastLogin    string
+	CreatedAt    primitive.DateTime
+
+	// only the hash of the reset token is kept
+	PasswordResetHash      string
+	PasswordResetExpiresAt primitive.DateTime
+
+	DeletedAt *primitive.DateTime
+	DeletedBy string
+}
+
+func (u *localUser) toUser() *data.User {
+	user := &data.User{
+		ID:           u.ID.Hex(),
+		Type:         u.Type,
+		FullName:     u.FullName,
+		Email:        u.Email,
+		Avatar:       u.Avatar,
+		Bio:          u.Bio,
+		Organisation: u.Organisation,
+		ClientRole:   u.ClientRole,
+		LastAccess:   u.LastLogin,
+		DeletedBy:    u.DeletedBy,
+	}
+
+	if u.DeletedAt != nil {
+		user.DeletedAt = u.DeletedAt.Time().UTC().Format(time.RFC3339)
+	}
+
+	return user
+}
+
+// mongoUserStorage keeps users in Mongo instead of an identity provider, so the
+// API can run without an Auth0 tenant.
+type mongoUserStorage struct {
+	db       *mongo.Database
+	pStorage PreferenceStorage
+	notify   PasswordResetNotifier
+}
+
+func NewLocalUserStorage(db *mongo.Database, pst PreferenceStorage, notify PasswordResetNotifier) (*mongoUserStorage, error) {
+	if notify == nil {
+		notify = logPasswordReset
+	}
+
+	_, err := db.Collection("users").Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"email": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoUserStorage{db: db, pStorage: pst, notify: notify}, nil
+}
+
+// logPasswordReset is the notifier used when none is configured. It never
+// logs the token, which would let anyone reading the logs reset the password,
+// so the user has to ask again once a notifier is set up.
+func logPasswordReset(user *data.User, token string) error {
+	fmt.Println("password reset requested for", user.Email, "but no notifier is configured to send it")
+	return nil
+}
+
+// rolesFor returns the roles a new user of the given type is given, the same
+// as the member and client roles assigned in Auth0.
+func rolesFor(userType string) []string {
+	switch userType {
+	case "member", "client":
+		return []string{userType}
+	}
+	return []string{}
+}
+
+func (p *mongoUserStorage) findOne(filter bson.M) (*localUser, error) {
+	user := &localUser{}
+	err := p.db.Collection("users").FindOne(context.TODO(), filter).Decode(user)
+	if err != nil {
+		return nil, notFound(err, "user")
+	}
+
+	return user, nil
+}
+
+func (p *mongoUserStorage) find(filter bson.M, opts ...*options.FindOptions) ([]*data.User, error) {
+	cursor, err := p.db.Collection("users").Find(context.TODO(), filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	users := []*data.User{}
+	for cursor.Next(context.TODO()) {
+		user := &localUser{}
+		err := cursor.Decode(user)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user.toUser())
+	}
+
+	return users, nil
+}
+
+func (p *mongoUserStorage) GetById(hex string) (*data.User, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := p.findOne(bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DeletedAt != nil {
+		return nil, ErrUserDeleted
+	}
+
+	return user.toUser(), nil
+}
+
+// GetWithRoles returns a user that isn't in the trash along with their roles.
+func (p *mongoUserStorage) GetWithRoles(hex string) (*data.User, []string, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := p.findOne(bson.M{"_id": id, "deletedat": nil})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user.toUser(), user.Roles, nil
+}
+
+func (p *mongoUserStorage) GetAll() ([]*data.User, error) {
+	return p.find(bson.M{"deletedat": nil}, options.Find().SetSort(bson.M{"fullname": 1}))
+}
+
+// Search returns one page of the users whose name or email starts with query,
+// filtered by user type and organisation. Empty arguments are ignored.
+// NextCursor holds the next page number, if any.
+func (p *mongoUserStorage) Search(query, role, organisation string, page int) (*data.Page[*data.User], error) {
+	filter := bson.M{"deletedat": nil}
+	if query = strings.TrimSpace(query); query != "" {
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"fullname": prefix}, bson.M{"email": prefix}}
+	}
+	if role != "" {
+		filter["type"] = role
+	}
+	if organisation != "" {
+		filter["organisation"] = organisation
+	}
+
+	total, err := p.db.Collection("users").CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "fullname", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64(page * localPerPage)).
+		SetLimit(localPerPage)
+
+	users, err := p.find(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &data.Page[*data.User]{Items: users, Total: total}
+	if int64((page+1)*localPerPage) < total {
+		ret.NextCursor = strconv.Itoa(page + 1)
+	}
+
+	return ret, nil
+}
+
+// Create stores the user with an unusable random password and requests a
+// password reset so they can choose their own, like the Auth0 storage does.
+func (p *mongoUserStorage) Create(user *data.User) (*data.User, error) {
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &localUser{
+		Type:         user.Type,
+		FullName:     user.FullName,
+		Email:        strings.ToLower(strings.TrimSpace(user.Email)),
+		PasswordHash: string(hash),
+		Roles:        rolesFor(user.Type),
+		Avatar:       user.Avatar,
+		Bio:          user.Bio,
+		Organisation: user.Organisation,
+		ClientRole:   user.ClientRole,
+		CreatedAt:    primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	res, err := p.db.Collection("users").InsertOne(context.TODO(), created)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, apperror.Conflict("a user with this email already exists")
+	} else if err != nil {
+		return nil, err
+	}
+	created.ID = res.InsertedID.(primitive.ObjectID)
+
+	err = p.RequestPasswordReset(created.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := created.toUser()
+	if ret.Type == "client" {
+		p.pStorage.AddOrganisation(ret.Organisation)
+	}
+
+	return ret, nil
+}
+
+// Update changes the user's profile. As with Auth0, roles are only assigned
+// when the user is created.
+func (p *mongoUserStorage) Update(hex string, user *data.User) (*data.User, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil},
+		bson.M{"$set": bson.M{
+			"type":         user.Type,
+			"fullname":     user.FullName,
+			"email":        strings.ToLower(strings.TrimSpace(user.Email)),
+			"avatar":       user.Avatar,
+			"bio":          user.Bio,
+			"organisation": user.Organisation,
+			"clientrole":   user.ClientRole,
+		}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, apperror.Conflict("a user with this email already exists")
+	} else if err != nil {
+		return nil, err
+	}
+
+	if res.MatchedCount == 0 {
+		return nil, apperror.NotFound("user")
+	}
+
+	ret, err := p.GetById(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Type == "client" {
+		p.pStorage.AddOrganisation(ret.Organisation)
+	}
+
+	return ret, nil
+}
+
+// Delete moves the user to the trash, they can't log in until restored.
+func (p *mongoUserStorage) Delete(hex string, deletedBy string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": nil},
+		bson.M{"$set": bson.M{"deletedat": primitive.NewDateTimeFromTime(time.Now()), "deletedby": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("user")
+	}
+
+	return nil
+}
+
+func (p *mongoUserStorage) GetTrashed() ([]*data.User, error) {
+	return p.find(bson.M{"deletedat": bson.M{"$ne": nil}}, options.Find().SetSort(bson.M{"deletedat": -1}))
+}
+
+func (p *mongoUserStorage) Restore(hex string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deletedat": "", "deletedby": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return apperror.NotFound("user")
+	}
+
+	return nil
+}
+
+func (p *mongoUserStorage) Purge(hex string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("users").DeleteOne(context.TODO(), bson.M{"_id": id, "deletedat": bson.M{"$ne": nil}})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return apperror.NotFound("user")
+	}
+
+	return nil
+}
+
+// PurgeTrashed permanently deletes the users trashed before the given time.
+func (p *mongoUserStorage) PurgeTrashed(before time.Time) (int64, error) {
+	res, err := p.db.Collection("users").DeleteMany(
+		context.TODO(),
+		bson.M{"deletedat": bson.M{"$ne": nil, "$lt": primitive.NewDateTimeFromTime(before)}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// RequestPasswordReset creates a single use reset token for the user and hands
+// it to the notifier. Unknown emails are ignored so they can't be probed.
+func (p *mongoUserStorage) RequestPasswordReset(email string) error {
+	user, err := p.findOne(bson.M{"email": strings.ToLower(strings.TrimSpace(email)), "deletedat": nil})
+	if apperror.IsKind(err, apperror.KindNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{
+			"passwordresethash":      hashToken(token),
+			"passwordresetexpiresat": primitive.NewDateTimeFromTime(time.Now().Add(passwordResetTTL)),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return p.notify(user.toUser(), token)
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset.
+func (p *mongoUserStorage) ResetPassword(token, password string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return apperror.Validation(map[string]string{"password": "password is too long"})
+	} else if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{
+			"passwordresethash":      hashToken(token),
+			"passwordresetexpiresat": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+			"deletedat":              nil,
+		},
+		bson.M{
+			"$set":   bson.M{"passwordhash": string(hash)},
+			"$unset": bson.M{"passwordresethash": "", "passwordresetexpiresat": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrInvalidResetToken
+	}
+
+	return nil
+}
+
+// Authenticate checks the email and password of a user and returns the user
+// along with their roles.
+func (p *mongoUserStorage) Authenticate(email, password string) (*data.User, []string, error) {
+	user, err := p.findOne(bson.M{"email": strings.ToLower(strings.TrimSpace(email)), "deletedat": nil})
+	if apperror.IsKind(err, apperror.KindNotFound) {
+		return nil, nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	user.LastLogin = time.Now().UTC().Format(time.RFC3339)
+	_, err = p.db.Collection("users").UpdateOne(context.TODO(), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"lastlogin": user.LastLogin}})
+	if err != nil {
+		fmt.Println("error recording last login", err)
+	}
+
+	return user.toUser(), user.Roles, nil
+}
+
+// EnsureAdmin creates an admin with the given email and password unless a user
+// with that email already exists, so a fresh database can be logged into.
+func (p *mongoUserStorage) EnsureAdmin(email, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	_, err = p.db.Collection("users").UpdateOne(
+		context.TODO(),
+		bson.M{"email": email},
+		bson.M{"$setOnInsert": &localUser{
+			Type:         "member",
+			FullName:     "Administrator",
+			Email:        email,
+			PasswordHash: string(hash),
+			Roles:        []string{"admin", "member"},
+			CreatedAt:    primitive.NewDateTimeFromTime(time.Now()),
+		}},
+		options.Update().SetUpsert(true),
+	)
+
+	return err
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
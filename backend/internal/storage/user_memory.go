@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryUserStorage keeps users in memory. It doesn't hold passwords, tests
+// sign their own tokens for whichever user and roles they need.
+type memoryUserStorage struct {
+	mu       sync.RWMutex
+	users    map[string]*memoryUser
+	pStorage PreferenceStorage
+}
+
+type memoryUser struct {
+	user      data.User
+	deletedAt time.Time
+}
+
+func NewMemoryUserStorage(pst PreferenceStorage) *memoryUserStorage {
+	return &memoryUserStorage{users: map[string]*memoryUser{}, pStorage: pst}
+}
+
+func (u *memoryUser) toUser() *data.User {
+	user := u.user
+	if !u.deletedAt.IsZero() {
+		user.DeletedAt = u.deletedAt.UTC().Format(time.RFC3339)
+	}
+	return &user
+}
+
+// get returns the stored user if it is in the trash or not, as asked. The
+// caller must hold the lock.
+func (p *memoryUserStorage) get(id string, trashed bool) (*memoryUser, error) {
+	user, ok := p.users[id]
+	if !ok || user.deletedAt.IsZero() == trashed {
+		return nil, apperror.NotFound("user")
+	}
+
+	return user, nil
+}
+
+// find returns the users for which keep is true, sorted by name. The caller
+// must hold the lock.
+func (p *memoryUserStorage) find(keep func(user *memoryUser) bool) []*data.User {
+	users := []*data.User{}
+	for _, user := range p.users {
+		if keep(user) {
+			users = append(users, user.toUser())
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].FullName != users[j].FullName {
+			return users[i].FullName < users[j].FullName
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users
+}
+
+// emailTaken reports whether another user already has the email. The caller
+// must hold the lock.
+func (p *memoryUserStorage) emailTaken(email, except string) bool {
+	for id, user := range p.users {
+		if id != except && user.user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *memoryUserStorage) GetById(hex string) (*data.User, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	user, ok := p.users[hex]
+	if !ok {
+		return nil, apperror.NotFound("user")
+	}
+
+	if !user.deletedAt.IsZero() {
+		return nil, ErrUserDeleted
+	}
+
+	return user.toUser(), nil
+}
+
+func (p *memoryUserStorage) GetAll() ([]*data.User, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.find(func(user *memoryUser) bool { return user.deletedAt.IsZero() }), nil
+}
+
+// Search pages through the users the same way as the local Mongo storage.
+func (p *memoryUserStorage) Search(query, role, organisation string, page int) (*data.Page[*data.User], error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	p.mu.RLock()
+	users := p.find(func(user *memoryUser) bool {
+		if !user.deletedAt.IsZero() {
+			return false
+		}
+		if query != "" &&
+			!strings.HasPrefix(strings.ToLower(user.user.FullName), query) &&
+			!strings.HasPrefix(strings.ToLower(user.user.Email), query) {
+			return false
+		}
+		if role != "" && user.user.Type != role {
+			return false
+		}
+		return organisation == "" || user.user.Organisation == organisation
+	})
+	p.mu.RUnlock()
+
+	total := int64(len(users))
+	start := min(page*localPerPage, len(users))
+	end := min(start+localPerPage, len(users))
+
+	ret := &data.Page[*data.User]{Items: users[start:end], Total: total}
+	if int64((page+1)*localPerPage) < total {
+		ret.NextCursor = strconv.Itoa(page + 1)
+	}
+
+	return ret, nil
+}
+
+func (p *memoryUserStorage) Create(user *data.User) (*data.User, error) {
+	p.mu.Lock()
+
+	stored := *user
+	if stored.ID == "" {
+		stored.ID = primitive.NewObjectID().Hex()
+	}
+	stored.Email = strings.ToLower(strings.TrimSpace(stored.Email))
+	stored.Password = ""
+	stored.DeletedAt = ""
+	stored.DeletedBy = ""
+
+	if p.emailTaken(stored.Email, "") {
+		p.mu.Unlock()
+		return nil, apperror.Conflict("a user with this email already exists")
+	}
+
+	p.users[stored.ID] = &memoryUser{user: stored}
+	p.mu.Unlock()
+
+	if stored.Type == "client" {
+		p.pStorage.AddOrganisation(stored.Organisation)
+	}
+
+	ret := stored
+	return &ret, nil
+}
+
+func (p *memoryUserStorage) Update(hex string, user *data.User) (*data.User, error) {
+	p.mu.Lock()
+
+	stored, err := p.get(hex, false)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(user.Email))
+	if p.emailTaken(email, hex) {
+		p.mu.Unlock()
+		return nil, apperror.Conflict("a user with this email already exists")
+	}
+
+	// the same fields the local Mongo storage updates
+	stored.user.Type = user.Type
+	stored.user.FullName = user.FullName
+	stored.user.Email = email
+	stored.user.Avatar = user.Avatar
+	stored.user.Bio = user.Bio
+	stored.user.Organisation = user.Organisation
+	stored.user.ClientRole = user.ClientRole
+	ret := stored.toUser()
+	p.mu.Unlock()
+
+	if ret.Type == "client" {
+		p.pStorage.AddOrganisation(ret.Organisation)
+	}
+
+	return ret, nil
+}
+
+func (p *memoryUserStorage) Delete(hex string, deletedBy string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	user, err := p.get(hex, false)
+	if err != nil {
+		return err
+	}
+
+	user.deletedAt = time.Now()
+	user.user.DeletedBy = deletedBy
+	return nil
+}
+
+func (p *memoryUserStorage) GetTrashed() ([]*data.User, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	users := p.find(func(user *memoryUser) bool { return !user.deletedAt.IsZero() })
+	sort.SliceStable(users, func(i, j int) bool {
+		return p.users[users[i].ID].deletedAt.After(p.users[users[j].ID].deletedAt)
+	})
+
+	return users, nil
+}
+
+func (p *memoryUserStorage) Restore(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	user, err := p.get(hex, true)
+	if err != nil {
+		return err
+	}
+
+	user.deletedAt = time.Time{}
+	user.user.DeletedBy = ""
+	return nil
+}
+
+func (p *memoryUserStorage) Purge(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.get(hex, true)
+	if err != nil {
+		return err
+	}
+
+	delete(p.users, hex)
+	return nil
+}
+
+func (p *memoryUserStorage) PurgeTrashed(before time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var purged int64
+	for id, user := range p.users {
+		if !user.deletedAt.IsZero() && user.deletedAt.Before(before) {
+			delete(p.users, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
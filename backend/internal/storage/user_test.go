@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// serveAuth0 points an auth0Storage at handler, which is also sent the token
+// requests.
+func serveAuth0(t *testing.T, handler http.HandlerFunc) (*auth0Storage, *httptest.Server) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// the storage talks https to the default transport
+	transport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	return &auth0Storage{Domain: server.Listener.Addr().String()}, server
+}
+
+// fakeAuth0 serves the Management API endpoints used to restore and purge
+// users, recording the writes made.
+func fakeAuth0(t *testing.T, users map[string]*Auth0User) (*auth0Storage, *[]string) {
+	writes := &[]string{}
+	st, _ := serveAuth0(t, func(w http.ResponseWriter, r *http.Request) {
+		user, ok := users[strings.TrimPrefix(r.URL.Path, "/api/v2/users/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(user)
+			return
+		}
+
+		*writes = append(*writes, r.Method+" "+user.UserID)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{}"))
+	})
+
+	return st, writes
+}
+
+func TestAuth0OnlyTrashedUsersArePurgedOrRestored(t *testing.T) {
+	st, writes := fakeAuth0(t, map[string]*Auth0User{
+		"live":    {UserID: "live", Email: "live@example.com"},
+		"trashed": {UserID: "trashed", Email: "trashed@example.com", Blocked: true, AppMetadata: &auth0AppMetadata{DeletedAt: "2024-06-01T00:00:00Z", DeletedBy: "admin"}},
+	})
+
+	for _, op := range []func(string) error{st.Purge, st.Restore} {
+		err := op("live")
+		var appErr *apperror.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, apperror.KindNotFound, appErr.Kind)
+	}
+	assert.Empty(t, *writes)
+
+	require.NoError(t, st.Restore("trashed"))
+	require.NoError(t, st.Purge("trashed"))
+	assert.Equal(t, []string{"PATCH trashed", "DELETE trashed"}, *writes)
+}
+
+func TestAuth0GetAllExportsPastThePagingLimit(t *testing.T) {
+	interval := exportPollInterval
+	exportPollInterval = 0
+	t.Cleanup(func() { exportPollInterval = interval })
+
+	var server *httptest.Server
+	polls := 0
+	st, server := serveAuth0(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/users":
+			json.NewEncoder(w).Encode(map[string]interface{}{"users": []*Auth0User{{UserID: "first"}}, "total": auth0PageLimit + 1})
+		case "/api/v2/jobs/users-exports":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(auth0Job{ID: "job-1", Status: "pending"})
+		case "/api/v2/jobs/job-1":
+			polls++
+			json.NewEncoder(w).Encode(auth0Job{ID: "job-1", Status: "completed", Location: server.URL + "/export.json.gz"})
+		case "/export.json.gz":
+			gz := gzip.NewWriter(w)
+			for i := 0; i <= auth0PageLimit; i++ {
+				fmt.Fprintf(gz, `{"user_id":"user-%d","email":"user-%d@example.com"}`+"\n", i, i)
+			}
+			fmt.Fprintln(gz, `{"user_id":"trashed","app_metadata":{"deleted_at":"2024-06-01T00:00:00Z"}}`)
+			gz.Close()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	users, err := st.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, 1, polls)
+	require.Len(t, users, auth0PageLimit+1)
+	assert.Equal(t, "user-1000", users[auth0PageLimit].ID)
+	assert.Equal(t, "user-1000@example.com", users[auth0PageLimit].Email)
+}
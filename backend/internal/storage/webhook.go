@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// WebhookStorage holds the webhooks and their delivery log.
+type WebhookStorage interface {
+	GetWebhooks() ([]*data.Webhook, error)
+	GetWebhook(hex string) (*data.Webhook, error)
+	CreateWebhook(webhook *data.Webhook) (*data.Webhook, error)
+	// UpdateWebhook changes the url, description, events and active flag
+	// of a webhook, the others are kept.
+	UpdateWebhook(hex string, webhook *data.Webhook) (*data.Webhook, error)
+	// DeleteWebhook deletes the webhook and its deliveries.
+	DeleteWebhook(hex string) error
+
+	EnqueueDelivery(delivery *data.WebhookDelivery) (*data.WebhookDelivery, error)
+	GetDelivery(hex string) (*data.WebhookDelivery, error)
+	// GetDeliveries returns the latest deliveries of a webhook, newest
+	// first.
+	GetDeliveries(webhookHex string, limit int) ([]*data.WebhookDelivery, error)
+	// ClaimDueDelivery returns the pending delivery due the longest and
+	// pushes it back by lease, so other senders skip it while it is being
+	// posted. It returns nil when no delivery is due.
+	ClaimDueDelivery(now time.Time, lease time.Duration) (*data.WebhookDelivery, error)
+	MarkDeliverySucceeded(id primitive.ObjectID, at time.Time, responseStatus int, responseBody string) error
+	// MarkDeliveryFailed counts a failed attempt, the delivery is retried
+	// at retryAt or given up on when it is nil.
+	MarkDeliveryFailed(id primitive.ObjectID, responseStatus int, responseBody, reason string, retryAt *time.Time) error
+}
+
+type mongoWebhookStorage struct {
+	db *mongo.Database
+}
+
+func NewWebhookStorage(db *mongo.Database) *mongoWebhookStorage {
+	return &mongoWebhookStorage{db: db}
+}
+
+func (p *mongoWebhookStorage) GetWebhooks() ([]*data.Webhook, error) {
+	cursor, err := p.db.Collection("webhooks").Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	webhooks := []*data.Webhook{}
+	err = cursor.All(context.TODO(), &webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (p *mongoWebhookStorage) GetWebhook(hex string) (*data.Webhook, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &data.Webhook{}
+	err = p.db.Collection("webhooks").FindOne(context.TODO(), bson.M{"_id": id}).Decode(webhook)
+	if err != nil {
+		return nil, notFound(err, "webhook")
+	}
+
+	return webhook, nil
+}
+
+func (p *mongoWebhookStorage) CreateWebhook(webhook *data.Webhook) (*data.Webhook, error) {
+	webhook.ID = primitive.NilObjectID
+	webhook.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	res, err := p.db.Collection("webhooks").InsertOne(context.TODO(), webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.ID = res.InsertedID.(primitive.ObjectID)
+	return webhook, nil
+}
+
+func (p *mongoWebhookStorage) UpdateWebhook(hex string, webhook *data.Webhook) (*data.Webhook, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &data.Webhook{}
+	err = p.db.Collection("webhooks").FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"url":         webhook.URL,
+			"description": webhook.Description,
+			"events":      webhook.Events,
+			"active":      webhook.Active,
+			"updatedat":   primitive.NewDateTimeFromTime(time.Now()),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(res)
+	if err != nil {
+		return nil, notFound(err, "webhook")
+	}
+
+	return res, nil
+}
+
+func (p *mongoWebhookStorage) DeleteWebhook(hex string) error {
+	id, err := objectID(hex)
+	if err != nil {
+		return err
+	}
+
+	res, err := p.db.Collection("webhooks").DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return apperror.NotFound("webhook")
+	}
+
+	_, err = p.db.Collection("webhook_deliveries").DeleteMany(context.TODO(), bson.M{"webhookid": id})
+	return err
+}
+
+func (p *mongoWebhookStorage) EnqueueDelivery(delivery *data.WebhookDelivery) (*data.WebhookDelivery, error) {
+	delivery.ID = primitive.NilObjectID
+	delivery.Status = data.DeliveryPending
+	delivery.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if delivery.NextAttemptAt == 0 {
+		delivery.NextAttemptAt = delivery.CreatedAt
+	}
+
+	res, err := p.db.Collection("webhook_deliveries").InsertOne(context.TODO(), delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.ID = res.InsertedID.(primitive.ObjectID)
+	return delivery, nil
+}
+
+func (p *mongoWebhookStorage) GetDelivery(hex string) (*data.WebhookDelivery, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &data.WebhookDelivery{}
+	err = p.db.Collection("webhook_deliveries").FindOne(context.TODO(), bson.M{"_id": id}).Decode(delivery)
+	if err != nil {
+		return nil, notFound(err, "delivery")
+	}
+
+	return delivery, nil
+}
+
+func (p *mongoWebhookStorage) GetDeliveries(webhookHex string, limit int) ([]*data.WebhookDelivery, error) {
+	id, err := objectID(webhookHex)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := p.db.Collection("webhook_deliveries").Find(context.TODO(), bson.M{"webhookid": id}, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	deliveries := []*data.WebhookDelivery{}
+	err = cursor.All(context.TODO(), &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (p *mongoWebhookStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*data.WebhookDelivery, error) {
+	delivery := &data.WebhookDelivery{}
+	err := p.db.Collection("webhook_deliveries").FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"status": data.DeliveryPending, "nextattemptat": bson.M{"$lte": primitive.NewDateTimeFromTime(now)}},
+		bson.M{"$set": bson.M{"nextattemptat": primitive.NewDateTimeFromTime(now.Add(lease))}},
+		options.FindOneAndUpdate().SetSort(bson.M{"nextattemptat": 1}),
+	).Decode(delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (p *mongoWebhookStorage) MarkDeliverySucceeded(id primitive.ObjectID, at time.Time, responseStatus int, responseBody string) error {
+	_, err := p.db.Collection("webhook_deliveries").UpdateByID(context.TODO(), id, bson.M{
+		"$set": bson.M{
+			"status":         data.DeliverySucceeded,
+			"deliveredat":    primitive.NewDateTimeFromTime(at),
+			"responsestatus": responseStatus,
+			"responsebody":   responseBody,
+			"lasterror":      "",
+		},
+		"$inc": bson.M{"attempts": 1},
+	})
+	return err
+}
+
+func (p *mongoWebhookStorage) MarkDeliveryFailed(id primitive.ObjectID, responseStatus int, responseBody, reason string, retryAt *time.Time) error {
+	set := bson.M{"responsestatus": responseStatus, "responsebody": responseBody, "lasterror": reason}
+	if retryAt == nil {
+		set["status"] = data.DeliveryFailed
+	} else {
+		set["nextattemptat"] = primitive.NewDateTimeFromTime(*retryAt)
+	}
+
+	_, err := p.db.Collection("webhook_deliveries").UpdateByID(context.TODO(), id, bson.M{"$set": set, "$inc": bson.M{"attempts": 1}})
+	return err
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/apperror"
+)
+
+// memoryWebhookStorage keeps webhooks and their deliveries in memory.
+type memoryWebhookStorage struct {
+	mu         sync.RWMutex
+	webhooks   map[primitive.ObjectID]*data.Webhook
+	deliveries map[primitive.ObjectID]*data.WebhookDelivery
+}
+
+func NewMemoryWebhookStorage() *memoryWebhookStorage {
+	return &memoryWebhookStorage{
+		webhooks:   map[primitive.ObjectID]*data.Webhook{},
+		deliveries: map[primitive.ObjectID]*data.WebhookDelivery{},
+	}
+}
+
+func (p *memoryWebhookStorage) GetWebhooks() ([]*data.Webhook, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	webhooks := []*data.Webhook{}
+	for _, webhook := range p.webhooks {
+		webhooks = append(webhooks, copyWebhook(webhook))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID.Hex() < webhooks[j].ID.Hex() })
+
+	return webhooks, nil
+}
+
+func (p *memoryWebhookStorage) GetWebhook(hex string) (*data.Webhook, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	webhook, err := p.get(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyWebhook(webhook), nil
+}
+
+// get returns the stored webhook. The caller must hold the lock.
+func (p *memoryWebhookStorage) get(hex string) (*data.Webhook, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, ok := p.webhooks[id]
+	if !ok {
+		return nil, apperror.NotFound("webhook")
+	}
+
+	return webhook, nil
+}
+
+func (p *memoryWebhookStorage) CreateWebhook(webhook *data.Webhook) (*data.Webhook, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	webhook.UpdatedAt = webhook.CreatedAt
+
+	p.webhooks[webhook.ID] = copyWebhook(webhook)
+	return webhook, nil
+}
+
+func (p *memoryWebhookStorage) UpdateWebhook(hex string, webhook *data.Webhook) (*data.Webhook, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stored, err := p.get(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	stored.URL = webhook.URL
+	stored.Description = webhook.Description
+	stored.Events = append([]data.WebhookEvent{}, webhook.Events...)
+	stored.Active = webhook.Active
+	stored.UpdatedAt = primitive.NewDateTimeFromTime(time.Now())
+
+	return copyWebhook(stored), nil
+}
+
+func (p *memoryWebhookStorage) DeleteWebhook(hex string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	webhook, err := p.get(hex)
+	if err != nil {
+		return err
+	}
+
+	delete(p.webhooks, webhook.ID)
+	for id, delivery := range p.deliveries {
+		if delivery.WebhookID == webhook.ID {
+			delete(p.deliveries, id)
+		}
+	}
+	return nil
+}
+
+func (p *memoryWebhookStorage) EnqueueDelivery(delivery *data.WebhookDelivery) (*data.WebhookDelivery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delivery.ID = primitive.NewObjectID()
+	delivery.Status = data.DeliveryPending
+	delivery.CreatedAt = primitive.NewDateTimeFromTime(time.Now())
+	if delivery.NextAttemptAt == 0 {
+		delivery.NextAttemptAt = delivery.CreatedAt
+	}
+
+	stored := *delivery
+	p.deliveries[delivery.ID] = &stored
+	return delivery, nil
+}
+
+func (p *memoryWebhookStorage) GetDelivery(hex string) (*data.WebhookDelivery, error) {
+	id, err := objectID(hex)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	delivery, ok := p.deliveries[id]
+	if !ok {
+		return nil, apperror.NotFound("delivery")
+	}
+
+	res := *delivery
+	return &res, nil
+}
+
+func (p *memoryWebhookStorage) GetDeliveries(webhookHex string, limit int) ([]*data.WebhookDelivery, error) {
+	id, err := objectID(webhookHex)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	deliveries := []*data.WebhookDelivery{}
+	for _, delivery := range p.deliveries {
+		if delivery.WebhookID == id {
+			res := *delivery
+			deliveries = append(deliveries, &res)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID.Hex() > deliveries[j].ID.Hex() })
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (p *memoryWebhookStorage) ClaimDueDelivery(now time.Time, lease time.Duration) (*data.WebhookDelivery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	due := primitive.NewDateTimeFromTime(now)
+	var claimed *data.WebhookDelivery
+	for _, delivery := range p.deliveries {
+		if delivery.Status != data.DeliveryPending || delivery.NextAttemptAt > due {
+			continue
+		}
+		if claimed == nil || delivery.NextAttemptAt < claimed.NextAttemptAt {
+			claimed = delivery
+		}
+	}
+
+	if claimed == nil {
+		return nil, nil
+	}
+
+	res := *claimed
+	claimed.NextAttemptAt = primitive.NewDateTimeFromTime(now.Add(lease))
+	return &res, nil
+}
+
+func (p *memoryWebhookStorage) MarkDeliverySucceeded(id primitive.ObjectID, at time.Time, responseStatus int, responseBody string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if delivery, ok := p.deliveries[id]; ok {
+		deliveredAt := primitive.NewDateTimeFromTime(at)
+		delivery.Status = data.DeliverySucceeded
+		delivery.DeliveredAt = &deliveredAt
+		delivery.Attempts++
+		delivery.ResponseStatus = responseStatus
+		delivery.ResponseBody = responseBody
+		delivery.LastError = ""
+	}
+	return nil
+}
+
+func (p *memoryWebhookStorage) MarkDeliveryFailed(id primitive.ObjectID, responseStatus int, responseBody, reason string, retryAt *time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delivery, ok := p.deliveries[id]
+	if !ok {
+		return nil
+	}
+
+	delivery.Attempts++
+	delivery.ResponseStatus = responseStatus
+	delivery.ResponseBody = responseBody
+	delivery.LastError = reason
+	if retryAt == nil {
+		delivery.Status = data.DeliveryFailed
+	} else {
+		delivery.NextAttemptAt = primitive.NewDateTimeFromTime(*retryAt)
+	}
+	return nil
+}
+
+func copyWebhook(webhook *data.Webhook) *data.Webhook {
+	copied := *webhook
+	copied.Events = append([]data.WebhookEvent{}, webhook.Events...)
+	return &copied
+}
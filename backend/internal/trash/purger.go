@@ -0,0 +1,65 @@
+package trash
+
+import (
+	"fmt"
+	"time"
+)
+
+// PurgeFunc permanently deletes the items trashed before the given time and
+// returns how many were deleted.
+type PurgeFunc func(before time.Time) (int64, error)
+
+// Purger periodically deletes the items that have been in the trash for
+// longer than the retention period.
+type Purger struct {
+	retention time.Duration
+	interval  time.Duration
+	purges    map[string]PurgeFunc
+	done      chan struct{}
+}
+
+func NewPurger(retention, interval time.Duration, purges map[string]PurgeFunc) *Purger {
+	return &Purger{
+		retention: retention,
+		interval:  interval,
+		purges:    purges,
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs a purge straight away and then every interval until Close is
+// called.
+func (p *Purger) Start() {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.Purge()
+
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Purger) Close() {
+	close(p.done)
+}
+
+// Purge deletes the items of every kind trashed before the retention period.
+func (p *Purger) Purge() {
+	before := time.Now().Add(-p.retention)
+	for name, purge := range p.purges {
+		n, err := purge(before)
+		if err != nil {
+			fmt.Println("error purging trashed", name, err)
+		}
+		if n > 0 {
+			fmt.Println("purged", n, "trashed", name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package webhooks posts project and benchmark events to the endpoints
+// registered by admins. Events are queued as deliveries by the Dispatcher and
+// posted by the Sender, which signs them and retries the failed ones.
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// Payload is the JSON body posted to webhooks.
+type Payload struct {
+	Event      data.WebhookEvent `json:"event"`
+	OccurredAt time.Time         `json:"occurredAt"`
+	Actor      *data.Member      `json:"actor,omitempty"`
+	Project    *data.Project     `json:"project,omitempty"`
+	// Status is the status change of project.completed events.
+	Status *data.StatusChange `json:"status,omitempty"`
+	// Benchmark and Action are set on benchmark.changed events, the action
+	// is created, updated, deleted or restored.
+	Benchmark *data.Benchmark `json:"benchmark,omitempty"`
+	Action    string          `json:"action,omitempty"`
+	// Webhook is set on pings.
+	Webhook *data.Webhook `json:"webhook,omitempty"`
+}
+
+// Dispatcher queues a delivery of every event to the webhooks subscribed to
+// it.
+type Dispatcher struct {
+	storage storage.WebhookStorage
+}
+
+func NewDispatcher(storage storage.WebhookStorage) *Dispatcher {
+	return &Dispatcher{storage: storage}
+}
+
+// Handle queues the deliveries of an event, it is meant to be subscribed to
+// the event bus.
+func (d *Dispatcher) Handle(e events.Event) {
+	payload, ok := payloadOf(e)
+	if !ok {
+		return
+	}
+
+	webhooks, err := d.storage.GetWebhooks()
+	if err != nil {
+		fmt.Println("error reading webhooks to deliver", payload.Event, err)
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Println("error encoding webhook payload", payload.Event, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(payload.Event) {
+			continue
+		}
+
+		_, err := d.storage.EnqueueDelivery(&data.WebhookDelivery{WebhookID: webhook.ID, Event: payload.Event, Payload: string(body)})
+		if err != nil {
+			fmt.Println("error queuing", payload.Event, "for webhook", webhook.ID.Hex(), err)
+		}
+	}
+}
+
+// payloadOf returns the payload of an event, false for the events webhooks
+// aren't told about. Status changes other than completions are updates.
+func payloadOf(e events.Event) (*Payload, bool) {
+	payload := &Payload{OccurredAt: e.At, Project: e.Project}
+	if e.Actor.ID != "" {
+		actor := e.Actor
+		payload.Actor = &actor
+	}
+
+	switch e.Type {
+	case events.ProjectCreated:
+		payload.Event = data.WebhookProjectCreated
+	case events.ProjectUpdated:
+		payload.Event = data.WebhookProjectUpdated
+	case events.MetricsUpdated:
+		payload.Event = data.WebhookMetricsUpdated
+	case events.StatusChanged:
+		payload.Event = data.WebhookProjectUpdated
+		if e.Status != nil && e.Status.To == data.StatusCompleted {
+			payload.Event = data.WebhookProjectCompleted
+			payload.Status = e.Status
+		}
+	case events.BenchmarkChanged:
+		payload.Event = data.WebhookBenchmarkChanged
+		payload.Benchmark = e.Benchmark
+		payload.Action = e.Action
+	default:
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// Ping queues a ping to the webhook, to test it. Pings are sent to inactive
+// webhooks too.
+func Ping(st storage.WebhookStorage, webhook *data.Webhook) (*data.WebhookDelivery, error) {
+	described := *webhook
+	described.Secret = ""
+
+	body, err := json.Marshal(&Payload{Event: data.WebhookPing, OccurredAt: time.Now(), Webhook: &described})
+	if err != nil {
+		return nil, err
+	}
+
+	return st.EnqueueDelivery(&data.WebhookDelivery{WebhookID: webhook.ID, Event: data.WebhookPing, Payload: string(body)})
+}
+
+// Replay queues a new delivery of the payload of another one.
+func Replay(st storage.WebhookStorage, delivery *data.WebhookDelivery) (*data.WebhookDelivery, error) {
+	replayOf := delivery.ID
+	if delivery.ReplayOf != nil {
+		replayOf = *delivery.ReplayOf
+	}
+
+	return st.EnqueueDelivery(&data.WebhookDelivery{
+		WebhookID: delivery.WebhookID,
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+		ReplayOf:  &replayOf,
+	})
+}
+
+// NewSecret returns a random secret to sign the deliveries of a webhook with.
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
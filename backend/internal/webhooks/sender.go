@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+// The headers of deliveries. The signature is the hex encoded HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the secret of the webhook.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// sendLease is how long a delivery being posted is hidden from other
+	// senders, it must be longer than the client timeout.
+	sendLease = 2 * time.Minute
+	// maxAttempts is the number of posts after which a delivery is given up
+	// on.
+	maxAttempts = 8
+	// retryBackoff is the wait before the first retry, it doubles with every
+	// failed attempt.
+	retryBackoff = 30 * time.Second
+	// maxResponseBody is how much of the response is kept in the log.
+	maxResponseBody = 1024
+)
+
+// Sign returns the signature of a delivery, as sent in HeaderSignature.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender periodically posts the due deliveries, retrying the failed ones with
+// an exponential backoff. Deliveries succeed when the webhook answers with a
+// 2xx status.
+type Sender struct {
+	storage  storage.WebhookStorage
+	client   *http.Client
+	interval time.Duration
+	done     chan struct{}
+}
+
+// NewSender returns a sender posting with client, one with a 10 seconds
+// timeout when it is nil.
+func NewSender(storage storage.WebhookStorage, client *http.Client, interval time.Duration) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Sender{
+		storage:  storage,
+		client:   client,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs the sender straight away and then every interval until Close is
+// called.
+func (s *Sender) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.Run(time.Now())
+
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Sender) Close() {
+	close(s.done)
+}
+
+// Run posts the deliveries due at now and returns how many succeeded.
+func (s *Sender) Run(now time.Time) int {
+	succeeded := 0
+	for {
+		delivery, err := s.storage.ClaimDueDelivery(now, sendLease)
+		if err != nil {
+			fmt.Println("error reading webhook deliveries", err)
+			return succeeded
+		}
+		if delivery == nil {
+			return succeeded
+		}
+
+		status, body, err := s.post(delivery, now)
+		if err == nil {
+			succeeded++
+			err = s.storage.MarkDeliverySucceeded(delivery.ID, now, status, body)
+			if err != nil {
+				fmt.Println("error marking delivery", delivery.ID.Hex(), "as succeeded", err)
+			}
+			continue
+		}
+
+		var retryAt *time.Time
+		if attempts := delivery.Attempts + 1; attempts < maxAttempts {
+			at := now.Add(retryBackoff << (attempts - 1))
+			retryAt = &at
+		} else {
+			fmt.Println("giving up on delivery", delivery.ID.Hex(), "of", delivery.Event, err)
+		}
+
+		err = s.storage.MarkDeliveryFailed(delivery.ID, status, body, err.Error(), retryAt)
+		if err != nil {
+			fmt.Println("error marking delivery", delivery.ID.Hex(), "as failed", err)
+		}
+	}
+}
+
+// post sends the delivery to its webhook and returns the response status and
+// the start of its body.
+func (s *Sender) post(delivery *data.WebhookDelivery, now time.Time) (int, string, error) {
+	webhook, err := s.storage.GetWebhook(delivery.WebhookID.Hex())
+	if err != nil {
+		return 0, "", err
+	}
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "project-dashboard-webhooks")
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, string(response), fmt.Errorf("webhook answered %s", res.Status)
+	}
+
+	return res.StatusCode, string(response), nil
+}
@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Infinities-ICT-Solutions/project-dashboard/data"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/events"
+	"github.com/Infinities-ICT-Solutions/project-dashboard/internal/storage"
+)
+
+func createWebhook(t *testing.T, st storage.WebhookStorage, url string, active bool, subscribed ...data.WebhookEvent) *data.Webhook {
+	webhook, err := st.CreateWebhook(&data.Webhook{URL: url, Events: subscribed, Active: active, Secret: "secret"})
+	require.NoError(t, err)
+	return webhook
+}
+
+func TestDispatcherHandle(t *testing.T) {
+	st := storage.NewMemoryWebhookStorage()
+	all := createWebhook(t, st, "https://all.example.com", true, data.WebhookEvents...)
+	completed := createWebhook(t, st, "https://completed.example.com", true, data.WebhookProjectCompleted)
+	inactive := createWebhook(t, st, "https://inactive.example.com", false, data.WebhookEvents...)
+
+	dispatcher := NewDispatcher(st)
+	project := &data.Project{Name: "Alpha"}
+	lead := data.Member{ID: "lead-1"}
+
+	dispatcher.Handle(events.Event{Type: events.ProjectCreated, Project: project})
+	dispatcher.Handle(events.Event{Type: events.StatusChanged, Project: project, Actor: lead, Status: &data.StatusChange{To: data.StatusOnHold}})
+	dispatcher.Handle(events.Event{Type: events.StatusChanged, Project: project, Actor: lead, Status: &data.StatusChange{To: data.StatusCompleted}})
+	dispatcher.Handle(events.Event{Type: events.BenchmarkChanged, Benchmark: &data.Benchmark{Name: "Road"}, Action: events.ActionDeleted})
+
+	eventsOf := func(webhook *data.Webhook) []data.WebhookEvent {
+		deliveries, err := st.GetDeliveries(webhook.ID.Hex(), 10)
+		require.NoError(t, err)
+
+		res := []data.WebhookEvent{}
+		for i := len(deliveries) - 1; i >= 0; i-- {
+			res = append(res, deliveries[i].Event)
+		}
+		return res
+	}
+
+	assert.Equal(t, []data.WebhookEvent{data.WebhookProjectCreated, data.WebhookProjectUpdated, data.WebhookProjectCompleted, data.WebhookBenchmarkChanged}, eventsOf(all))
+	assert.Equal(t, []data.WebhookEvent{data.WebhookProjectCompleted}, eventsOf(completed))
+	assert.Empty(t, eventsOf(inactive))
+
+	deliveries, err := st.GetDeliveries(completed.ID.Hex(), 10)
+	require.NoError(t, err)
+	payload := &Payload{}
+	require.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), payload))
+	assert.Equal(t, "Alpha", payload.Project.Name)
+	assert.Equal(t, "lead-1", payload.Actor.ID)
+	assert.Equal(t, data.StatusCompleted, payload.Status.To)
+}
+
+// receiver records the signed deliveries it is sent, answering with status.
+type receiver struct {
+	mu     sync.Mutex
+	status int
+	events []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if req.Header.Get(HeaderSignature) != Sign("secret", timestamp, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, req.Header.Get(HeaderEvent))
+	w.WriteHeader(r.status)
+	w.Write([]byte("thanks"))
+}
+
+func TestSenderRetries(t *testing.T) {
+	rec := &receiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	st := storage.NewMemoryWebhookStorage()
+	webhook := createWebhook(t, st, server.URL, true, data.WebhookEvents...)
+	delivery, err := Ping(st, webhook)
+	require.NoError(t, err)
+
+	sender := NewSender(st, server.Client(), time.Minute)
+	now := time.Now()
+
+	assert.Equal(t, 0, sender.Run(now))
+	stored, err := st.GetDelivery(delivery.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, data.DeliveryPending, stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, stored.ResponseStatus)
+	assert.Equal(t, "thanks", stored.ResponseBody)
+
+	// not due before the backoff
+	assert.Equal(t, 0, sender.Run(now.Add(retryBackoff/2)))
+
+	rec.status = http.StatusOK
+	assert.Equal(t, 1, sender.Run(now.Add(retryBackoff)))
+	stored, err = st.GetDelivery(delivery.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, data.DeliverySucceeded, stored.Status)
+	assert.Equal(t, 2, stored.Attempts)
+	assert.NotNil(t, stored.DeliveredAt)
+	assert.Equal(t, []string{"ping", "ping"}, rec.events)
+
+	// a replay is a new delivery of the same payload
+	replay, err := Replay(st, stored)
+	require.NoError(t, err)
+	assert.Equal(t, delivery.ID, *replay.ReplayOf)
+	assert.Equal(t, stored.Payload, replay.Payload)
+	assert.Equal(t, 1, sender.Run(now.Add(time.Hour)))
+}
+
+func TestSenderGivesUp(t *testing.T) {
+	rec := &receiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	st := storage.NewMemoryWebhookStorage()
+	delivery, err := Ping(st, createWebhook(t, st, server.URL, true, data.WebhookEvents...))
+	require.NoError(t, err)
+
+	sender := NewSender(st, server.Client(), time.Minute)
+	now := time.Now()
+	for i := 0; i < maxAttempts; i++ {
+		sender.Run(now)
+		now = now.Add(retryBackoff << i)
+	}
+
+	stored, err := st.GetDelivery(delivery.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, maxAttempts, stored.Attempts)
+	assert.Equal(t, data.DeliveryFailed, stored.Status)
+	assert.Equal(t, "webhook answered 500 Internal Server Error", stored.LastError)
+}
@@ -1,7 +1,12 @@
 import axios, { AxiosInstance } from "axios";
 
 import { type Benchmark } from "@/types/benchmark";
-import { type Project, ProjectSchema } from "@/types/project";
+import {
+  type Page,
+  type Project,
+  type ProjectSummary,
+  ProjectSchema
+} from "@/types/project";
 import { type User } from "@/types/user";
 
 import { token } from "@/store/auth";
@@ -35,11 +40,21 @@ class ProjectService {
       }
     };
 
-    const data = await this.httpClient
-      .get<Project[]>("/projects", config)
-      .then((response) => response.data);
-
-    return data;
+    const projects: ProjectSummary[] = [];
+    let cursor: string | undefined = undefined;
+    do {
+      const page: Page<ProjectSummary> = await this.httpClient
+        .get<Page<ProjectSummary>>("/projects", {
+          ...config,
+          params: { limit: 200, cursor }
+        })
+        .then((response) => response.data);
+
+      projects.push(...page.items);
+      cursor = page.nextCursor;
+    } while (cursor);
+
+    return projects;
   }
 
   async create(data: any) {
@@ -54,7 +69,8 @@ class ProjectService {
   async update(id: string, data: any) {
     const config = {
       headers: {
-        Authorization: `Bearer ${token.value}`
+        Authorization: `Bearer ${token.value}`,
+        "If-Match": `"${data.revision ?? 0}"`
       }
     };
     return this.httpClient
@@ -73,10 +89,11 @@ class ProjectService {
       .then((response: any) => response.data);
   }
 
-  async updateMetrics(id: string, data: any) {
+  async updateMetrics(id: string, data: any, revision: number) {
     const config = {
       headers: {
-        Authorization: `Bearer ${token.value}`
+        Authorization: `Bearer ${token.value}`,
+        "If-Match": `"${revision}"`
       }
     };
     return this.httpClient
@@ -178,9 +195,19 @@ class UserService {
         Authorization: `Bearer ${token.value}`
       }
     };
-    return this.httpClient
-      .get<User[]>("/users", config)
-      .then((response) => response.data);
+
+    const users: User[] = [];
+    let page: string | undefined = undefined;
+    do {
+      const res: Page<User> = await this.httpClient
+        .get<Page<User>>("/users", { ...config, params: { page } })
+        .then((response) => response.data);
+
+      users.push(...res.items);
+      page = res.nextCursor;
+    } while (page);
+
+    return users;
   }
 
   async create(data: User) {
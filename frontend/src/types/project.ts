@@ -174,10 +174,32 @@ export const ProjectSchema = z.object({
   startDate: z.coerce.date(), // Assuming date as string in ISO format
   completionDate: z.coerce.date(), // Assuming date as string in ISO format
   status: z.string(),
-  metrics: MetricsSchema
+  metrics: MetricsSchema,
+  revision: z.number().default(0)
 });
 export type Project = z.infer<typeof ProjectSchema>;
 
+export type ProjectSummary = {
+  id: string;
+  name: string;
+  client: string;
+  region: string;
+  ciProjectNumber: string;
+  clientProjectNumber: string;
+  projectLead: Member;
+  startDate: Date;
+  completionDate: Date;
+  estimatedCompletionDate: Date;
+  status: string;
+  currentLevelOfDesign: string;
+};
+
+export type Page<T> = {
+  items: T[];
+  total: number;
+  nextCursor?: string;
+};
+
 export const EmptyProject: Project = {
   id: "",
   name: "",
@@ -244,5 +266,6 @@ export const EmptyProject: Project = {
       cubicMetreRateForEarthworksPerM3: 0,
       benchmarks: null
     }
-  }
+  },
+  revision: 0
 };